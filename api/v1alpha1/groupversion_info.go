@@ -0,0 +1,23 @@
+// Package v1alpha1 contains the API types of the library, e.g. the PolicyBinding kind used to store back references to policies
+// +kubebuilder:object:generate=true
+// +groupName=kuadrant.io
+package v1alpha1
+
+//go:generate go run sigs.k8s.io/controller-tools/cmd/controller-gen@v0.12.0 object paths=./...
+//go:generate go run sigs.k8s.io/controller-tools/cmd/controller-gen@v0.12.0 crd paths=./... output:crd:artifacts:config=../../config/crd
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	// GroupVersion is the group version of the API types
+	GroupVersion = schema.GroupVersion{Group: "kuadrant.io", Version: "v1alpha1"}
+
+	// SchemeBuilder adds the API types to a scheme
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	// AddToScheme adds the API types to a scheme
+	AddToScheme = SchemeBuilder.AddToScheme
+)
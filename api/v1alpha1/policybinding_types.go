@@ -0,0 +1,51 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+// PolicyReference is the key of a policy bound to a network object
+type PolicyReference struct {
+	// +kubebuilder:validation:MinLength=1
+	Namespace string `json:"namespace"`
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// PolicyBindingSpec lists the policies of a kind that target a network object, directly or indirectly
+type PolicyBindingSpec struct {
+	// TargetRef is the network object the policies are bound to
+	TargetRef gatewayapiv1alpha2.PolicyTargetReference `json:"targetRef"`
+	// PolicyKind is the kind of the policies
+	// +kubebuilder:validation:MinLength=1
+	PolicyKind string `json:"policyKind"`
+	// Policies are the keys of the policies bound to the network object
+	// +optional
+	Policies []PolicyReference `json:"policies,omitempty"`
+}
+
+// PolicyBinding stores the back references from a network object to the policies of a kind that target it,
+// as an alternative to the back reference annotations, in the namespace of the network object.
+// Unlike annotations, the number of back references is not limited by the size of the metadata of the network object
+// and the access to the back references can be restricted independently from the access to the network object.
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Namespaced
+type PolicyBinding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec PolicyBindingSpec `json:"spec,omitempty"`
+}
+
+// PolicyBindingList is a list of PolicyBindings
+// +kubebuilder:object:root=true
+type PolicyBindingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PolicyBinding `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PolicyBinding{}, &PolicyBindingList{})
+}
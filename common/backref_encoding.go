@@ -0,0 +1,200 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// BackReferenceEncoding is the format of the back reference annotation
+type BackReferenceEncoding string
+
+const (
+	// JSONBackReferenceEncoding is a JSON array of policy keys, e.g. [{"Namespace":"ns","Name":"policy"}]. The default encoding.
+	JSONBackReferenceEncoding BackReferenceEncoding = "JSON"
+	// CompactBackReferenceEncoding is a sorted comma-separated list of policy keys, e.g. ns/policy-1,ns/policy-2
+	CompactBackReferenceEncoding BackReferenceEncoding = "Compact"
+	// CompressedBackReferenceEncoding is the compact encoding, gzipped and base64-encoded, with the gzip: prefix
+	CompressedBackReferenceEncoding BackReferenceEncoding = "Compressed"
+)
+
+const compressedBackReferencesPrefix = "gzip:"
+
+// MaxAnnotationsSize is the maximum total size of the annotations of an object accepted by the API server
+const MaxAnnotationsSize = apivalidation.TotalAnnotationSizeLimitB
+
+// EncodedReferrer is a Referrer that stores its back references with an encoding other than the default JSON one.
+// BackReferencesFromObject reads any of the encodings, regardless of the one of the referrer.
+type EncodedReferrer interface {
+	Referrer
+	// BackReferenceEncoding returns the encoding of the back reference annotation
+	BackReferenceEncoding() BackReferenceEncoding
+}
+
+// AnnotationsTooLargeError is the error of setting back references that would make the annotations of an object
+// exceed the maximum size accepted by the API server
+type AnnotationsTooLargeError struct {
+	Object client.ObjectKey
+	Size   int
+	Limit  int
+}
+
+func (e *AnnotationsTooLargeError) Error() string {
+	return fmt.Sprintf("annotations of %s would be too large: %d bytes, must have at most %d bytes", e.Object, e.Size, e.Limit)
+}
+
+// EncodeBackReferences encodes the back references for the back reference annotation
+func EncodeBackReferences(refs []client.ObjectKey, encoding BackReferenceEncoding) (string, error) {
+	switch encoding {
+	case "", JSONBackReferenceEncoding:
+		serialized, err := json.Marshal(refs)
+		return string(serialized), err
+	case CompactBackReferenceEncoding:
+		return encodeCompactBackReferences(refs), nil
+	case CompressedBackReferenceEncoding:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write([]byte(encodeCompactBackReferences(refs))); err != nil {
+			return "", err
+		}
+		if err := w.Close(); err != nil {
+			return "", err
+		}
+		return compressedBackReferencesPrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+	default:
+		return "", fmt.Errorf("unknown back reference encoding %q", encoding)
+	}
+}
+
+// DecodeBackReferences decodes the value of a back reference annotation in any of the encodings.
+// Policy keys without namespace in the compact encodings default to the given namespace.
+func DecodeBackReferences(value, defaultNamespace string) ([]client.ObjectKey, error) {
+	value = strings.TrimSpace(value)
+
+	switch {
+	case value == "":
+		return make([]client.ObjectKey, 0), nil
+	case strings.HasPrefix(value, "["):
+		var refs []client.ObjectKey
+		if err := json.Unmarshal([]byte(value), &refs); err != nil {
+			return nil, err
+		}
+		return refs, nil
+	case strings.HasPrefix(value, compressedBackReferencesPrefix):
+		compressed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, compressedBackReferencesPrefix))
+		if err != nil {
+			return nil, err
+		}
+		r, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		// bounded, so a small annotation cannot decompress into an arbitrarily large value
+		decompressed, err := io.ReadAll(io.LimitReader(r, int64(MaxAnnotationsSize)+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(decompressed) > MaxAnnotationsSize {
+			return nil, fmt.Errorf("compressed back references exceed %d bytes", MaxAnnotationsSize)
+		}
+		return decodeCompactBackReferences(string(decompressed), defaultNamespace)
+	default:
+		return decodeCompactBackReferences(value, defaultNamespace)
+	}
+}
+
+// decodeCompactBackReferences decodes a comma-separated list of policy keys, failing unless every entry is a valid
+// namespace/name or name key, so corrupt values in other encodings are not mistaken for the compact one
+func decodeCompactBackReferences(value, defaultNamespace string) ([]client.ObjectKey, error) {
+	refs := make([]client.ObjectKey, 0)
+	for _, ref := range strings.Split(value, ",") {
+		ref = strings.TrimSpace(ref)
+		parts := strings.Split(ref, string(types.Separator))
+		if len(parts) > 2 {
+			return nil, fmt.Errorf("invalid back reference %q", ref)
+		}
+		if len(parts) == 2 {
+			if errs := validation.IsDNS1123Label(parts[0]); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid back reference %q: %s", ref, strings.Join(errs, ", "))
+			}
+		}
+		if errs := validation.IsDNS1123Subdomain(parts[len(parts)-1]); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid back reference %q: %s", ref, strings.Join(errs, ", "))
+		}
+		refs = append(refs, NamespacedNameToObjectKey(ref, defaultNamespace))
+	}
+	return refs, nil
+}
+
+// CanonicalBackReferences returns the canonical form of a set of back references: policy keys without namespace set to the
+// default namespace, deduplicated and sorted by namespace and name. Writing back references in canonical form keeps
+// the stored values stable regardless of the order in which policies are added, so they can be compared as strings.
+func CanonicalBackReferences(refs []client.ObjectKey, defaultNamespace string) []client.ObjectKey {
+	seen := make(map[client.ObjectKey]struct{}, len(refs))
+	canonical := make([]client.ObjectKey, 0, len(refs))
+	for _, ref := range refs {
+		if ref.Namespace == "" {
+			ref.Namespace = defaultNamespace
+		}
+		if _, ok := seen[ref]; ok {
+			continue
+		}
+		seen[ref] = struct{}{}
+		canonical = append(canonical, ref)
+	}
+	sort.Slice(canonical, func(i, j int) bool {
+		if canonical[i].Namespace != canonical[j].Namespace {
+			return canonical[i].Namespace < canonical[j].Namespace
+		}
+		return canonical[i].Name < canonical[j].Name
+	})
+	return canonical
+}
+
+// SetBackReferencesInObject sets the back references in the annotation of an object, in canonical form (see CanonicalBackReferences)
+// and with the encoding of the referrer.
+// Returns an AnnotationsTooLargeError, leaving the object untouched, if the annotations would exceed MaxAnnotationsSize.
+func SetBackReferencesInObject(obj client.Object, referrer Referrer, refs []client.ObjectKey) error {
+	encoding := JSONBackReferenceEncoding
+	if encodedReferrer, ok := referrer.(EncodedReferrer); ok {
+		encoding = encodedReferrer.BackReferenceEncoding()
+	}
+
+	value, err := EncodeBackReferences(CanonicalBackReferences(refs, obj.GetNamespace()), encoding)
+	if err != nil {
+		return err
+	}
+
+	annotations := ReadAnnotationsFromObject(obj)
+	size := 0
+	for name, v := range annotations {
+		if name != referrer.BackReferenceAnnotationName() {
+			size += len(name) + len(v)
+		}
+	}
+	size += len(referrer.BackReferenceAnnotationName()) + len(value)
+	if size > MaxAnnotationsSize {
+		return &AnnotationsTooLargeError{Object: client.ObjectKeyFromObject(obj), Size: size, Limit: MaxAnnotationsSize}
+	}
+
+	annotations[referrer.BackReferenceAnnotationName()] = value
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+func encodeCompactBackReferences(refs []client.ObjectKey) string {
+	keys := Map(refs, client.ObjectKey.String)
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
@@ -0,0 +1,136 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type encodedPolicyKindStub struct {
+	PolicyKindStub
+	encoding BackReferenceEncoding
+}
+
+func (p *encodedPolicyKindStub) BackReferenceEncoding() BackReferenceEncoding {
+	return p.encoding
+}
+
+func TestBackReferenceEncodings(t *testing.T) {
+	refs := []client.ObjectKey{{Namespace: "gw-ns", Name: "policy-2"}, {Namespace: "app-ns", Name: "policy-1"}}
+
+	t.Run("when the encoding is compact then the back references are sorted", func(t *testing.T) {
+		value, err := EncodeBackReferences(refs, CompactBackReferenceEncoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != "app-ns/policy-1,gw-ns/policy-2" {
+			t.Errorf("unexpected compact encoding: %s", value)
+		}
+	})
+
+	for _, encoding := range []BackReferenceEncoding{JSONBackReferenceEncoding, CompactBackReferenceEncoding, CompressedBackReferenceEncoding} {
+		t.Run(fmt.Sprintf("when the back references are encoded as %s then BackReferencesFromObject reads them transparently", encoding), func(t *testing.T) {
+			obj := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1"}}
+			if err := SetBackReferencesInObject(obj, &encodedPolicyKindStub{encoding: encoding}, refs); err != nil {
+				t.Fatal(err)
+			}
+			decoded := BackReferencesFromObject(obj, &PolicyKindStub{})
+			if len(decoded) != len(refs) || !Contains(decoded, refs[0]) || !Contains(decoded, refs[1]) {
+				t.Errorf("expected back references %v, but got %v", refs, decoded)
+			}
+		})
+	}
+
+	t.Run("when the compact back references have no namespace then default to the namespace of the object", func(t *testing.T) {
+		obj := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1", Annotations: map[string]string{"kuadrant.io/testpolicies": "policy-1"}}}
+		if decoded := BackReferencesFromObject(obj, &PolicyKindStub{}); len(decoded) != 1 || decoded[0] != (client.ObjectKey{Namespace: "gw-ns", Name: "policy-1"}) {
+			t.Errorf("unexpected back references: %v", decoded)
+		}
+	})
+
+	t.Run("when the annotation is corrupt then ignore it", func(t *testing.T) {
+		for _, value := range []string{`[{"Namespace":"gw-ns","Name":"policy-1"`, `{"Namespace":"gw-ns","Name":"policy-1"}`, "gw-ns/policy-1,not a/valid key", "a/b/c", "gzip:not-base64"} {
+			obj := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1", Annotations: map[string]string{"kuadrant.io/testpolicies": value}}}
+			if decoded := BackReferencesFromObject(obj, &PolicyKindStub{}); len(decoded) != 0 {
+				t.Errorf("expected no back references from %s, but got %v", value, decoded)
+			}
+		}
+	})
+
+	t.Run("when the compressed back references decompress beyond the maximum size then fail", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write([]byte(strings.Repeat("gw-ns/policy-1,", MaxAnnotationsSize/10))); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecodeBackReferences("gzip:"+base64.StdEncoding.EncodeToString(buf.Bytes()), "gw-ns"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("when the annotations would be too large then fail with a typed error and leave the object untouched", func(t *testing.T) {
+		obj := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "gw-ns",
+				Name:        "gw-1",
+				Annotations: map[string]string{"large": strings.Repeat("x", MaxAnnotationsSize-100)},
+			},
+		}
+		err := SetBackReferencesInObject(obj, &PolicyKindStub{}, refs)
+		var sizeErr *AnnotationsTooLargeError
+		if !errors.As(err, &sizeErr) || sizeErr.Limit != MaxAnnotationsSize || sizeErr.Size <= MaxAnnotationsSize {
+			t.Fatalf("expected annotations too large error, but got %v", err)
+		}
+		if _, found := obj.GetAnnotations()["kuadrant.io/testpolicies"]; found {
+			t.Error("expected no back reference annotation")
+		}
+
+		if err := SetBackReferencesInObject(obj, &encodedPolicyKindStub{encoding: CompactBackReferenceEncoding}, refs[:1]); err != nil {
+			t.Errorf("expected compact back references to fit, but got %v", err)
+		}
+	})
+}
+
+func TestCanonicalBackReferences(t *testing.T) {
+	refs := []client.ObjectKey{
+		{Namespace: "gw-ns", Name: "policy-2"},
+		{Name: "policy-1"},
+		{Namespace: "app-ns", Name: "policy-3"},
+		{Namespace: "gw-ns", Name: "policy-1"},
+		{Namespace: "gw-ns", Name: "policy-2"},
+	}
+
+	canonical := Map(CanonicalBackReferences(refs, "gw-ns"), client.ObjectKey.String)
+	if expected := "app-ns/policy-3,gw-ns/policy-1,gw-ns/policy-2"; strings.Join(canonical, ",") != expected {
+		t.Errorf("expected canonical back references %s, but got %v", expected, canonical)
+	}
+
+	t.Run("when the back references are written in different orders then the annotations are equal", func(t *testing.T) {
+		obj1 := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1"}}
+		obj2 := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1"}}
+		if err := SetBackReferencesInObject(obj1, &PolicyKindStub{}, refs); err != nil {
+			t.Fatal(err)
+		}
+		if err := SetBackReferencesInObject(obj2, &PolicyKindStub{}, ReverseSlice(refs)); err != nil {
+			t.Fatal(err)
+		}
+		value := obj1.GetAnnotations()["kuadrant.io/testpolicies"]
+		if value != obj2.GetAnnotations()["kuadrant.io/testpolicies"] {
+			t.Errorf("expected equal annotations, but got %s and %s", value, obj2.GetAnnotations()["kuadrant.io/testpolicies"])
+		}
+		if value != `[{"Namespace":"app-ns","Name":"policy-3"},{"Namespace":"gw-ns","Name":"policy-1"},{"Namespace":"gw-ns","Name":"policy-2"}]` {
+			t.Errorf("unexpected annotation: %s", value)
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package common
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+// HTTPRouteParentRefsIndexField is the name of the field index of the httproutes by the gateways referred in their parentRefs
+const HTTPRouteParentRefsIndexField = "spec.parentRefs"
+
+// IndexHTTPRouteParentRefs registers in the field indexer (e.g. the manager's) an index of the httproutes by the gateways referred in their parentRefs
+func IndexHTTPRouteParentRefs(ctx context.Context, indexer client.FieldIndexer) error {
+	return indexer.IndexField(ctx, &gatewayapiv1beta1.HTTPRoute{}, HTTPRouteParentRefsIndexField, HTTPRouteParentRefsIndexerFunc)
+}
+
+// HTTPRouteParentRefsIndexerFunc extracts the values of the parentRefs index from an httproute, i.e. the <namespace>/<name> keys of the parent gateways
+func HTTPRouteParentRefsIndexerFunc(obj client.Object) []string {
+	route, ok := obj.(*gatewayapiv1beta1.HTTPRoute)
+	if !ok {
+		return nil
+	}
+	return Map(HTTPRouteParentGatewayKeys(route), func(gwKey client.ObjectKey) string { return gwKey.String() })
+}
+
+// HTTPRouteParentGatewayKeys returns the keys of the gateways referred in the parentRefs of a route
+func HTTPRouteParentGatewayKeys(route *gatewayapiv1beta1.HTTPRoute) []client.ObjectKey {
+	gwKeys := make([]client.ObjectKey, 0)
+	for _, parentRef := range route.Spec.CommonRouteSpec.ParentRefs {
+		if parentRef.Kind != nil && *parentRef.Kind != "Gateway" {
+			continue
+		}
+		gwKey := client.ObjectKey{Name: string(parentRef.Name), Namespace: route.Namespace}
+		if parentRef.Namespace != nil {
+			gwKey.Namespace = string(*parentRef.Namespace)
+		}
+		gwKeys = append(gwKeys, gwKey)
+	}
+	return gwKeys
+}
@@ -0,0 +1,31 @@
+package common
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+// AttachmentMode tells how a policy attaches to the Gateway API network objects
+type AttachmentMode string
+
+const (
+	// DirectAttachment policies affect their target network objects only
+	DirectAttachment AttachmentMode = "Direct"
+	// InheritedAttachment policies also affect the gateways in the hierarchy of their target network objects,
+	// whose annotations list the policies back
+	InheritedAttachment AttachmentMode = "Inherited"
+)
+
+// Policy is a Referrer object that exposes its target references and attachment mode,
+// so the library can reconcile the back references to the policy with just the policy object.
+type Policy interface {
+	client.Object
+	Referrer
+	// GetTargetRefs returns the references to the network objects targeted by the policy
+	GetTargetRefs() []gatewayapiv1alpha2.PolicyTargetReference
+	// GetGroupVersionKind returns the group, version and kind of the policy, regardless of the type meta being set
+	GetGroupVersionKind() schema.GroupVersionKind
+	// GetAttachmentMode returns whether the policy attaches directly to its targets or is also inherited by the gateways of the targets
+	GetAttachmentMode() AttachmentMode
+}
@@ -1,7 +1,8 @@
 package common
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -13,19 +14,63 @@ type Referrer interface {
 	BackReferenceAnnotationName() string
 }
 
-// BackReferencesFromObject returns the names of the policies listed in the annotations of a target ref object.
+// DirectReferrer is a Referrer that also marks the objects it targets directly with an annotation.
+type DirectReferrer interface {
+	Referrer
+	// DirectReferenceAnnotationName returns the name of the annotation in a directly targeted object that contains the key of the referrer object.
+	DirectReferenceAnnotationName() string
+}
+
+// BackReferencesFromObject returns the names of the policies listed in the annotations of a target ref object,
+// in any of the back reference encodings.
 func BackReferencesFromObject(obj client.Object, referrer Referrer) []client.ObjectKey {
 	backRefs, found := ReadAnnotationsFromObject(obj)[referrer.BackReferenceAnnotationName()]
 	if !found {
 		return make([]client.ObjectKey, 0)
 	}
 
-	var refs []client.ObjectKey
-
-	err := json.Unmarshal([]byte(backRefs), &refs)
+	refs, err := DecodeBackReferences(backRefs, obj.GetNamespace())
 	if err != nil {
 		return make([]client.ObjectKey, 0)
 	}
 
 	return refs
 }
+
+// DirectReferenceFromObject returns the name of the policy that directly targets an object, as stored in the annotations of the object.
+// The second return value is false if the referrer is not a DirectReferrer or the object is not directly targeted by any policy.
+func DirectReferenceFromObject(obj client.Object, referrer Referrer) (client.ObjectKey, bool) {
+	directReferrer, ok := referrer.(DirectReferrer)
+	if !ok {
+		return client.ObjectKey{}, false
+	}
+
+	ref, found := ReadAnnotationsFromObject(obj)[directReferrer.DirectReferenceAnnotationName()]
+	if !found || ref == "" {
+		return client.ObjectKey{}, false
+	}
+
+	return NamespacedNameToObjectKey(ref, obj.GetNamespace()), true
+}
+
+// ErrUnsupportedBackReferenceTarget is the error of a back reference store that cannot store back references in a kind of network object
+var ErrUnsupportedBackReferenceTarget = errors.New("unsupported back reference target")
+
+// BackReferenceReader reads the back references from the network objects to the policies of a kind, wherever they are stored
+type BackReferenceReader interface {
+	// BackReferences returns the keys of the policies of the kind of the referrer that target the object
+	BackReferences(ctx context.Context, obj client.Object, referrer Referrer) ([]client.ObjectKey, error)
+}
+
+// ReadBackReferences reads the back references from an object to the policies of the kind of the referrer with the reader.
+// The back references are read from the annotations of the object if the reader is nil or cannot store back references in the object.
+func ReadBackReferences(ctx context.Context, reader BackReferenceReader, obj client.Object, referrer Referrer) ([]client.ObjectKey, error) {
+	if reader == nil {
+		return BackReferencesFromObject(obj, referrer), nil
+	}
+	refs, err := reader.BackReferences(ctx, obj, referrer)
+	if errors.Is(err, ErrUnsupportedBackReferenceTarget) {
+		return BackReferencesFromObject(obj, referrer), nil
+	}
+	return refs, err
+}
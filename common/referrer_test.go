@@ -1,6 +1,9 @@
 package common
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
 
 	corev1 "k8s.io/api/core/v1"
@@ -31,3 +34,80 @@ func TestBackReferencesFromObject(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestDirectReferenceFromObject(t *testing.T) {
+	obj := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "gw-ns",
+			Name:        "gw-1",
+			Annotations: map[string]string{"kuadrant.io/testpolicy-direct-backref": "app-ns/policy-1"},
+		},
+	}
+
+	ref, found := DirectReferenceFromObject(obj, &PolicyKindStub{})
+	if !found {
+		t.Fatal("direct reference expected to be found")
+	}
+	if ref != (client.ObjectKey{Namespace: "app-ns", Name: "policy-1"}) {
+		t.Errorf("direct reference (%s) does not match expected (app-ns/policy-1)", ref)
+	}
+
+	obj.SetAnnotations(map[string]string{"kuadrant.io/testpolicy-direct-backref": "policy-2"})
+	if ref, _ := DirectReferenceFromObject(obj, &PolicyKindStub{}); ref != (client.ObjectKey{Namespace: "gw-ns", Name: "policy-2"}) {
+		t.Errorf("direct reference (%s) does not match expected (gw-ns/policy-2)", ref)
+	}
+
+	obj.SetAnnotations(nil)
+	if _, found := DirectReferenceFromObject(obj, &PolicyKindStub{}); found {
+		t.Error("direct reference expected not to be found")
+	}
+}
+
+type backReferenceReaderStub struct {
+	refs []client.ObjectKey
+	err  error
+}
+
+func (r *backReferenceReaderStub) BackReferences(_ context.Context, _ client.Object, _ Referrer) ([]client.ObjectKey, error) {
+	return r.refs, r.err
+}
+
+func TestReadBackReferences(t *testing.T) {
+	obj := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "gw-ns",
+			Name:        "gw-1",
+			Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-1"}]`},
+		},
+	}
+	policyKind := &PolicyKindStub{}
+	annotated := client.ObjectKey{Namespace: "app-ns", Name: "policy-1"}
+	stored := client.ObjectKey{Namespace: "app-ns", Name: "policy-2"}
+
+	t.Run("when there is no reader then read the annotations", func(t *testing.T) {
+		refs, err := ReadBackReferences(context.Background(), nil, obj, policyKind)
+		if err != nil || len(refs) != 1 || refs[0] != annotated {
+			t.Errorf("expected %v, but got %v (err: %v)", []client.ObjectKey{annotated}, refs, err)
+		}
+	})
+
+	t.Run("when there is a reader then read with the reader", func(t *testing.T) {
+		refs, err := ReadBackReferences(context.Background(), &backReferenceReaderStub{refs: []client.ObjectKey{stored}}, obj, policyKind)
+		if err != nil || len(refs) != 1 || refs[0] != stored {
+			t.Errorf("expected %v, but got %v (err: %v)", []client.ObjectKey{stored}, refs, err)
+		}
+	})
+
+	t.Run("when the reader does not support the object then read the annotations", func(t *testing.T) {
+		refs, err := ReadBackReferences(context.Background(), &backReferenceReaderStub{err: fmt.Errorf("%w: no status", ErrUnsupportedBackReferenceTarget)}, obj, policyKind)
+		if err != nil || len(refs) != 1 || refs[0] != annotated {
+			t.Errorf("expected %v, but got %v (err: %v)", []client.ObjectKey{annotated}, refs, err)
+		}
+	})
+
+	t.Run("when the reader fails then return the error", func(t *testing.T) {
+		if _, err := ReadBackReferences(context.Background(), &backReferenceReaderStub{err: errors.New("boom")}, obj, policyKind); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
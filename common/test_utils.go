@@ -1,5 +1,12 @@
 package common
 
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
 type PolicyKindStub struct{}
 
 func (tpk *PolicyKindStub) Kind() string {
@@ -9,3 +16,106 @@ func (tpk *PolicyKindStub) Kind() string {
 func (tpk *PolicyKindStub) BackReferenceAnnotationName() string {
 	return "kuadrant.io/testpolicies"
 }
+
+func (tpk *PolicyKindStub) DirectReferenceAnnotationName() string {
+	return "kuadrant.io/testpolicy-direct-backref"
+}
+
+// PolicyStub is a policy object of the PolicyKindStub kind
+type PolicyStub struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              PolicyStubSpec   `json:"spec,omitempty"`
+	Status            PolicyStubStatus `json:"status,omitempty"`
+}
+
+type PolicyStubSpec struct {
+	TargetRef gatewayapiv1alpha2.PolicyTargetReference `json:"targetRef"`
+	// TargetRefs, if set, are the target references of the policy instead of TargetRef
+	TargetRefs     []gatewayapiv1alpha2.PolicyTargetReference `json:"targetRefs,omitempty"`
+	AttachmentMode AttachmentMode                             `json:"attachmentMode,omitempty"`
+}
+
+type PolicyStubStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+var _ Policy = &PolicyStub{}
+
+func (p *PolicyStub) Kind() string {
+	return (&PolicyKindStub{}).Kind()
+}
+
+func (p *PolicyStub) BackReferenceAnnotationName() string {
+	return (&PolicyKindStub{}).BackReferenceAnnotationName()
+}
+
+func (p *PolicyStub) DirectReferenceAnnotationName() string {
+	return (&PolicyKindStub{}).DirectReferenceAnnotationName()
+}
+
+func (p *PolicyStub) GetTargetRefs() []gatewayapiv1alpha2.PolicyTargetReference {
+	if len(p.Spec.TargetRefs) > 0 {
+		return p.Spec.TargetRefs
+	}
+	return []gatewayapiv1alpha2.PolicyTargetReference{p.Spec.TargetRef}
+}
+
+func (p *PolicyStub) GetGroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: "kuadrant.io", Version: "v1", Kind: p.Kind()}
+}
+
+// GetAttachmentMode defaults to InheritedAttachment
+func (p *PolicyStub) GetAttachmentMode() AttachmentMode {
+	if p.Spec.AttachmentMode == "" {
+		return InheritedAttachment
+	}
+	return p.Spec.AttachmentMode
+}
+
+func (p *PolicyStub) DeepCopyObject() runtime.Object {
+	out := &PolicyStub{TypeMeta: p.TypeMeta}
+	p.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	p.Spec.TargetRef.DeepCopyInto(&out.Spec.TargetRef)
+	if p.Spec.TargetRefs != nil {
+		out.Spec.TargetRefs = make([]gatewayapiv1alpha2.PolicyTargetReference, len(p.Spec.TargetRefs))
+		for i := range p.Spec.TargetRefs {
+			p.Spec.TargetRefs[i].DeepCopyInto(&out.Spec.TargetRefs[i])
+		}
+	}
+	out.Spec.AttachmentMode = p.Spec.AttachmentMode
+	if p.Status.Conditions != nil {
+		out.Status.Conditions = make([]metav1.Condition, len(p.Status.Conditions))
+		for i := range p.Status.Conditions {
+			p.Status.Conditions[i].DeepCopyInto(&out.Status.Conditions[i])
+		}
+	}
+	return out
+}
+
+func (p *PolicyStub) GetConditions() []metav1.Condition {
+	return p.Status.Conditions
+}
+
+func (p *PolicyStub) SetConditions(conditions []metav1.Condition) {
+	p.Status.Conditions = conditions
+}
+
+// PolicyStubList is a list of PolicyStub objects
+type PolicyStubList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PolicyStub `json:"items"`
+}
+
+func (l *PolicyStubList) DeepCopyObject() runtime.Object {
+	out := &PolicyStubList{TypeMeta: l.TypeMeta}
+	l.ListMeta.DeepCopyInto(&out.ListMeta)
+	if l.Items != nil {
+		out.Items = make([]PolicyStub, len(l.Items))
+		for i := range l.Items {
+			out.Items[i] = *l.Items[i].DeepCopyObject().(*PolicyStub)
+		}
+	}
+	return out
+}
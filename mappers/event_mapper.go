@@ -1,8 +1,15 @@
 package mappers
 
 import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
 	"github.com/go-logr/logr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/kuadrant/controller-runtime-ext/common"
@@ -12,6 +19,163 @@ type EventMapper interface {
 	MapToPolicy(client.Object, common.Referrer) []reconcile.Request
 }
 
+// contextualEventMapper is an EventMapper that can also map events within a context
+type contextualEventMapper interface {
+	EventMapper
+	mapToPolicy(context.Context, client.Object, common.Referrer) []reconcile.Request
+	// mapToPolicies maps an event to the policies of several kinds at once, indexed by kind of policy,
+	// looking up the objects related to the event only once for all the kinds of policies
+	mapToPolicies(context.Context, client.Object, []common.Referrer) map[string][]reconcile.Request
+	options() mapperOptions
+}
+
+// MapFunc binds an event mapper to a kind of policy, returning a context-aware function to use with handler.EnqueueRequestsFromMapFunc.
+// For the mappers of this package, the logger in the context of the event, if any, prevails over the one set with WithLogger.
+func MapFunc(mapper EventMapper, policyKind common.Referrer) handler.MapFunc {
+	if m, ok := mapper.(contextualEventMapper); ok {
+		return func(ctx context.Context, obj client.Object) []reconcile.Request {
+			return m.mapToPolicy(ctx, obj, policyKind)
+		}
+	}
+	return func(_ context.Context, obj client.Object) []reconcile.Request {
+		return mapper.MapToPolicy(obj, policyKind)
+	}
+}
+
+// NewEventMapper returns an event mapper for objects of type T (e.g. *gatewayapiv1beta1.Gateway, *gatewayapiv1alpha2.TCPRoute, *corev1.Service or any custom resource),
+// that maps events to the policies referred back from the objects, in their annotations or in the stores set WithBackReferenceStores
+func NewEventMapper[T client.Object](o ...mapperOption) EventMapper {
+	return newEventMapper[T](o...)
+}
+
+func newEventMapper[T client.Object](o ...mapperOption) *eventMapper[T] {
+	m := &eventMapper[T]{opts: apply(o...), kind: kindName[T]()}
+	if m.opts.lastKnownState {
+		m.index = newTargetIndex()
+	}
+	return m
+}
+
+var _ contextualEventMapper = &eventMapper[client.Object]{}
+
+// relatedPoliciesFunc returns the policies of a kind referenced from the objects related to the object of an event
+type relatedPoliciesFunc func(policyKind common.Referrer) []client.ObjectKey
+
+type eventMapper[T client.Object] struct {
+	opts mapperOptions
+	kind string
+
+	// relatedPolicies optionally looks up, once per event, the objects related to the object of the event,
+	// returning the function that finds the policies of a kind referenced from them, besides the ones referred back from the object
+	relatedPolicies func(ctx context.Context, obj T, logger logr.Logger) relatedPoliciesFunc
+
+	// index keeps the last known state of the mapped objects, to map events from deleted objects
+	index *targetIndex
+}
+
+func (m *eventMapper[T]) MapToPolicy(obj client.Object, policyKind common.Referrer) []reconcile.Request {
+	return m.mapToPolicy(context.Background(), obj, policyKind)
+}
+
+func (m *eventMapper[T]) mapToPolicy(ctx context.Context, obj client.Object, policyKind common.Referrer) []reconcile.Request {
+	return m.mapToPolicies(ctx, obj, []common.Referrer{policyKind})[policyKind.Kind()]
+}
+
+func (m *eventMapper[T]) mapToPolicies(ctx context.Context, obj client.Object, policyKinds []common.Referrer) map[string][]reconcile.Request {
+	logger := m.opts.logger
+	if ctxLogger, err := logr.FromContext(ctx); err == nil {
+		logger = ctxLogger
+	}
+	logger = logger.WithValues(m.kind, client.ObjectKeyFromObject(obj))
+
+	requests := make(map[string][]reconcile.Request, len(policyKinds))
+
+	typedObj, ok := obj.(T)
+	if !ok {
+		for _, policyKind := range policyKinds {
+			recordEventMapped(m.kind, policyKind.Kind())
+			recordMappingError(m.kind, policyKind.Kind(), typeMismatchErrorReason)
+			requests[policyKind.Kind()] = []reconcile.Request{}
+		}
+		logger.Info(fmt.Sprintf("cannot map %s related event to kuadrant policy", m.kind), "error", fmt.Sprintf("%T is not a %T", obj, *new(T)))
+		return requests
+	}
+
+	var relatedPolicies relatedPoliciesFunc
+	if m.relatedPolicies != nil {
+		relatedPolicies = m.relatedPolicies(ctx, typedObj, logger)
+	}
+
+	for _, policyKind := range policyKinds {
+		requests[policyKind.Kind()] = m.mapObjectToPolicy(ctx, typedObj, policyKind, relatedPolicies, logger)
+	}
+
+	return requests
+}
+
+// mapObjectToPolicy maps an event to the policies of a kind, referred back from the object or referenced from the objects related to it
+func (m *eventMapper[T]) mapObjectToPolicy(ctx context.Context, obj T, policyKind common.Referrer, relatedPolicies relatedPoliciesFunc, logger logr.Logger) []reconcile.Request {
+	recordEventMapped(m.kind, policyKind.Kind())
+
+	requests := make([]reconcile.Request, 0)
+
+	for _, policyKey := range m.opts.backReferences(ctx, obj, policyKind, m.kind, logger) {
+		request := reconcile.Request{NamespacedName: policyKey}
+		if common.Contains(requests, request) {
+			continue
+		}
+		logger.V(1).Info(fmt.Sprintf("kuadrant policy possibly affected by the %s related event found", m.kind), policyKind.Kind(), policyKey)
+		requests = append(requests, request)
+	}
+
+	if relatedPolicies != nil {
+		for _, policyKey := range relatedPolicies(policyKind) {
+			request := reconcile.Request{NamespacedName: policyKey}
+			if common.Contains(requests, request) {
+				continue
+			}
+			requests = append(requests, request)
+		}
+	}
+
+	if m.index != nil {
+		key := targetIndexKey{kind: m.kind, policyKind: policyKind.Kind(), target: client.ObjectKeyFromObject(obj)}
+		mapped := len(requests)
+		requests = m.index.requestsFromLastKnownState(ctx, key, obj, requests)
+		for _, request := range requests[mapped:] {
+			logger.V(1).Info(fmt.Sprintf("kuadrant policy possibly affected by the deleted %s found in its last known state", m.kind), policyKind.Kind(), request.NamespacedName)
+		}
+	}
+
+	if len(requests) == 0 {
+		logger.V(1).Info(fmt.Sprintf("no kuadrant policy possibly affected by the %s related event", m.kind))
+	}
+
+	return recordRequestsProduced(m.kind, policyKind.Kind(), requests)
+}
+
+func (m *eventMapper[T]) options() mapperOptions {
+	return m.opts
+}
+
+// kindName returns the lowercase name of the type of object, e.g. "gateway" for *gatewayapiv1beta1.Gateway
+func kindName[T client.Object]() string {
+	t := reflect.TypeOf(*new(T))
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return strings.ToLower(t.Name())
+}
+
+// objectKindName returns the lowercase name of the type of an object, e.g. "gateway" for a *gatewayapiv1beta1.Gateway
+func objectKindName(obj client.Object) string {
+	t := reflect.TypeOf(obj)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return strings.ToLower(t.Name())
+}
+
 // options
 
 // TODO(@guicassolato): unit test
@@ -21,16 +185,77 @@ func WithLogger(logger logr.Logger) mapperOption {
 	})
 }
 
+// WithTransitiveMapping makes the gateway event mapper also map events to the policies referenced from the HTTPRoutes attached to the gateway,
+// so route-level policies react to gateway changes. The client is used to look up the routes and must be indexed with IndexHTTPRouteParentRefs.
+func WithTransitiveMapping(k8sClient client.Reader) mapperOption {
+	return newFuncMapperOption(func(o *mapperOptions) {
+		o.routeReader = k8sClient
+	})
+}
+
+// WithLastKnownState makes the mapper keep a small in-memory reverse index of the objects to the policies last mapped from them,
+// so events from deleted objects whose back references were already stripped are still mapped to the right policies.
+// Use it along with EnqueueRequestsFromMapper, so the mapper is told about delete events.
+func WithLastKnownState() mapperOption {
+	return newFuncMapperOption(func(o *mapperOptions) {
+		o.lastKnownState = true
+	})
+}
+
+// WithMaxRequests caps the number of requests from a single event that the event handlers returned by EnqueueRequestsFromMapper add to the workqueue at once.
+// The requests exceeding the cap are not dropped, but deferred for the overflow delay (see WithOverflowDelay), logged and counted
+// in the kuadrant_event_mapper_requests_deferred_total metric. Zero (default) means no cap.
+func WithMaxRequests(max int) mapperOption {
+	return newFuncMapperOption(func(o *mapperOptions) {
+		o.maxRequests = max
+	})
+}
+
+// WithOverflowDelay sets how long the requests exceeding the cap set WithMaxRequests are deferred for. Defaults to DefaultOverflowDelay.
+func WithOverflowDelay(delay time.Duration) mapperOption {
+	return newFuncMapperOption(func(o *mapperOptions) {
+		o.overflowDelay = delay
+	})
+}
+
+// WithCoalescingWindow makes the event handlers returned by EnqueueRequestsFromMapper delay the requests mapped by the mapper for the duration of the window,
+// so the requests to the same policy produced by bursts of events within the window are coalesced into one by the workqueue
+func WithCoalescingWindow(window time.Duration) mapperOption {
+	return newFuncMapperOption(func(o *mapperOptions) {
+		o.coalescingWindow = window
+	})
+}
+
+// WithBackReferenceStores makes the mapper read the back references from the network objects to the policies with the reader,
+// typically the back reference stores of the policy controllers, instead of from the annotations of the objects.
+// Objects the stores cannot hold back references in are still read from their annotations.
+func WithBackReferenceStores(stores common.BackReferenceReader) mapperOption {
+	return newFuncMapperOption(func(o *mapperOptions) {
+		o.backReferenceReader = stores
+	})
+}
+
 type mapperOption interface {
 	apply(*mapperOptions)
 }
 
 type mapperOptions struct {
-	logger logr.Logger
+	logger              logr.Logger
+	routeReader         client.Reader
+	backReferenceReader common.BackReferenceReader
+	lastKnownState      bool
+
+	maxRequests      int
+	overflowDelay    time.Duration
+	coalescingWindow time.Duration
 }
 
+// DefaultOverflowDelay is how long the requests exceeding the cap set WithMaxRequests are deferred for, unless set WithOverflowDelay
+const DefaultOverflowDelay = time.Second
+
 var defaultMapperOptions = mapperOptions{
-	logger: logr.Discard(),
+	logger:        logr.Discard(),
+	overflowDelay: DefaultOverflowDelay,
 }
 
 func newFuncMapperOption(f func(*mapperOptions)) *funcMapperOption {
@@ -54,3 +279,15 @@ func apply(opt ...mapperOption) mapperOptions {
 	}
 	return opts
 }
+
+// backReferences reads the back references from an object to the policies of a kind, with the back reference reader if set.
+// Errors are logged and counted, and treated as no back references.
+func (o mapperOptions) backReferences(ctx context.Context, obj client.Object, policyKind common.Referrer, kind string, logger logr.Logger) []client.ObjectKey {
+	refs, err := common.ReadBackReferences(ctx, o.backReferenceReader, obj, policyKind)
+	if err != nil {
+		recordMappingError(kind, policyKind.Kind(), lookupErrorReason)
+		logger.Info(fmt.Sprintf("cannot read the back references of the %s", objectKindName(obj)), "error", err)
+		return make([]client.ObjectKey, 0)
+	}
+	return refs
+}
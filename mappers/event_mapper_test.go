@@ -0,0 +1,108 @@
+package mappers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func TestEventMapper(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "app-ns",
+			Name:        "svc-1",
+			Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-1"},{"Namespace":"app-ns","Name":"policy-2"},{"Namespace":"app-ns","Name":"policy-1"}]`},
+		},
+	}
+
+	t.Run("when the object is of the type of the mapper then map to the policies referred back from the object, deduplicated", func(t *testing.T) {
+		requests := NewEventMapper[*corev1.Service]().MapToPolicy(service, &common.PolicyKindStub{})
+		expected := []reconcile.Request{
+			{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-1"}},
+			{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-2"}},
+		}
+		if !reflect.DeepEqual(requests, expected) {
+			t.Errorf("expected requests %v, but got %v", expected, requests)
+		}
+	})
+
+	t.Run("when the mapper reads from back reference stores then map to the policies in the stores", func(t *testing.T) {
+		stores := &backReferenceReaderStub{refs: []client.ObjectKey{{Namespace: "app-ns", Name: "policy-3"}}}
+		requests := NewEventMapper[*corev1.Service](WithBackReferenceStores(stores)).MapToPolicy(service, &common.PolicyKindStub{})
+		expected := []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-3"}}}
+		if !reflect.DeepEqual(requests, expected) {
+			t.Errorf("expected requests %v, but got %v", expected, requests)
+		}
+	})
+
+	t.Run("when the back reference stores fail then map to no policy", func(t *testing.T) {
+		requests := NewEventMapper[*corev1.Service](WithBackReferenceStores(&backReferenceReaderStub{err: errors.New("boom")})).MapToPolicy(service, &common.PolicyKindStub{})
+		if len(requests) != 0 {
+			t.Errorf("expected no requests, but got %v", requests)
+		}
+	})
+
+	t.Run("when the object is not of the type of the mapper then map to no policy", func(t *testing.T) {
+		requests := NewEventMapper[*gatewayapiv1beta1.Gateway]().MapToPolicy(service, &common.PolicyKindStub{})
+		if len(requests) != 0 {
+			t.Errorf("expected no requests, but got %v", requests)
+		}
+	})
+}
+
+type backReferenceReaderStub struct {
+	refs []client.ObjectKey
+	err  error
+}
+
+func (r *backReferenceReaderStub) BackReferences(_ context.Context, _ client.Object, _ common.Referrer) ([]client.ObjectKey, error) {
+	return r.refs, r.err
+}
+
+func TestKindName(t *testing.T) {
+	if name := kindName[*gatewayapiv1beta1.Gateway](); name != "gateway" {
+		t.Errorf("expected kind name gateway, but got %s", name)
+	}
+	if name := kindName[*gatewayapiv1beta1.HTTPRoute](); name != "httproute" {
+		t.Errorf("expected kind name httproute, but got %s", name)
+	}
+	if name := kindName[*corev1.Service](); name != "service" {
+		t.Errorf("expected kind name service, but got %s", name)
+	}
+}
+
+func TestMapFunc(t *testing.T) {
+	gateway := &gatewayapiv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "gw-ns",
+			Name:        "gw-1",
+			Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-1"}]`},
+		},
+	}
+
+	var logged bool
+	logger := funcr.New(func(prefix, args string) { logged = true }, funcr.Options{Verbosity: 1})
+	ctx := logr.NewContext(context.Background(), logger)
+
+	mapFunc := MapFunc(NewGatewayEventMapper(), &common.PolicyKindStub{})
+	requests := mapFunc(ctx, gateway)
+
+	expected := []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-1"}}}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected requests %v, but got %v", expected, requests)
+	}
+	if !logged {
+		t.Error("expected the logger from the context to be used")
+	}
+}
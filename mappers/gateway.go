@@ -1,10 +1,10 @@
 package mappers
 
 import (
-	"fmt"
+	"context"
 
+	"github.com/go-logr/logr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
 	"github.com/kuadrant/controller-runtime-ext/common"
@@ -12,33 +12,68 @@ import (
 
 // TODO(@guicassolato): unit test
 func NewGatewayEventMapper(o ...mapperOption) EventMapper {
-	return &gatewayEventMapper{opts: apply(o...)}
+	m := newEventMapper[*gatewayapiv1beta1.Gateway](o...)
+	if m.opts.routeReader != nil {
+		m.relatedPolicies = httpRoutePolicies(m.opts)
+	}
+	return m
 }
 
-type gatewayEventMapper struct {
-	opts mapperOptions
+// HTTPRouteParentRefsIndexField is the name of the field index of the httproutes by the gateways referred in their parentRefs
+const HTTPRouteParentRefsIndexField = common.HTTPRouteParentRefsIndexField
+
+// IndexHTTPRouteParentRefs registers in the field indexer (e.g. the manager's) an index of the httproutes by the gateways referred in their parentRefs,
+// required by the mappers set WithTransitiveMapping and by reconcilers.ComputePolicyDiffsForGateway
+func IndexHTTPRouteParentRefs(ctx context.Context, indexer client.FieldIndexer) error {
+	return common.IndexHTTPRouteParentRefs(ctx, indexer)
 }
 
-// TODO(@guicassolato): unit test
-func (m *gatewayEventMapper) MapToPolicy(obj client.Object, policyKind common.Referrer) []reconcile.Request {
-	logger := m.opts.logger.WithValues("gateway", client.ObjectKeyFromObject(obj))
+// HTTPRouteParentRefsIndexerFunc extracts the values of the parentRefs index from an httproute, i.e. the <namespace>/<name> keys of the parent gateways
+func HTTPRouteParentRefsIndexerFunc(obj client.Object) []string {
+	return common.HTTPRouteParentRefsIndexerFunc(obj)
+}
 
-	gateway, ok := obj.(*gatewayapiv1beta1.Gateway)
-	if !ok {
-		logger.Info("cannot map gateway related event to kuadrant policy", "error", fmt.Sprintf("%T is not a *gatewayapiv1beta1.Gateway", obj))
-		return []reconcile.Request{}
+// attachedHTTPRoutes looks up the httproutes whose parentRefs point to a gateway, by the parentRefs index
+func attachedHTTPRoutes(ctx context.Context, k8sClient client.Reader, gwKey client.ObjectKey) ([]gatewayapiv1beta1.HTTPRoute, error) {
+	routeList := &gatewayapiv1beta1.HTTPRouteList{}
+	if err := k8sClient.List(ctx, routeList, client.MatchingFields{HTTPRouteParentRefsIndexField: gwKey.String()}); err != nil {
+		return nil, err
 	}
+	return routeList.Items, nil
+}
 
-	requests := make([]reconcile.Request, 0)
-
-	for _, policyKey := range common.BackReferencesFromObject(gateway, policyKind) {
-		logger.V(1).Info("kuadrant policy possibly affected by the gateway related event found", policyKind.Kind(), policyKey)
-		requests = append(requests, reconcile.Request{NamespacedName: policyKey})
+// routePolicyKeys returns the keys of the policies referred back from a route, including the policy that targets the route directly, if any
+func routePolicyKeys(ctx context.Context, route *gatewayapiv1beta1.HTTPRoute, policyKind common.Referrer, opts mapperOptions, kind string, logger logr.Logger) []client.ObjectKey {
+	policyKeys := opts.backReferences(ctx, route, policyKind, kind, logger)
+	if policyKey, found := common.DirectReferenceFromObject(route, policyKind); found && !common.Contains(policyKeys, policyKey) {
+		policyKeys = append(policyKeys, policyKey)
 	}
+	return policyKeys
+}
 
-	if len(requests) == 0 {
-		logger.V(1).Info("no kuadrant policy possibly affected by the gateway related event")
-	}
+// httpRoutePolicies returns a function that looks up the httproutes whose parentRefs point to a gateway with the route reader of the options,
+// and finds the policies of a kind referenced from them
+func httpRoutePolicies(opts mapperOptions) func(context.Context, *gatewayapiv1beta1.Gateway, logr.Logger) relatedPoliciesFunc {
+	return func(ctx context.Context, gateway *gatewayapiv1beta1.Gateway, logger logr.Logger) relatedPoliciesFunc {
+		routes, err := attachedHTTPRoutes(ctx, opts.routeReader, client.ObjectKeyFromObject(gateway))
+		return func(policyKind common.Referrer) []client.ObjectKey {
+			if err != nil {
+				recordMappingError("gateway", policyKind.Kind(), lookupErrorReason)
+				logger.Info("cannot map gateway related event to kuadrant policies attached to httproutes", "error", err)
+				return nil
+			}
 
-	return requests
+			policyKeys := make([]client.ObjectKey, 0)
+			for i := range routes {
+				route := &routes[i]
+				for _, policyKey := range routePolicyKeys(ctx, route, policyKind, opts, "gateway", logger) {
+					if !common.Contains(policyKeys, policyKey) {
+						logger.V(1).Info("kuadrant policy possibly affected by the gateway related event found via httproute", policyKind.Kind(), policyKey, "httproute", client.ObjectKeyFromObject(route))
+						policyKeys = append(policyKeys, policyKey)
+					}
+				}
+			}
+			return policyKeys
+		}
+	}
 }
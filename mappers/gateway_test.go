@@ -2,8 +2,118 @@ package mappers
 
 import (
 	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
 )
 
 func TestNewGatewayEventMapper(t *testing.T) {
 	_ = NewHTTPRouteEventMapper()
 }
+
+func TestGatewayEventMapperWithTransitiveMapping(t *testing.T) {
+	err := gatewayapiv1beta1.AddToScheme(scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gwNamespace := gatewayapiv1beta1.Namespace("gw-ns")
+
+	gateway := &gatewayapiv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "gw-ns",
+			Name:        "gw-1",
+			Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"gw-ns","Name":"policy-1"},{"Namespace":"app-ns","Name":"policy-2"}]`},
+		},
+	}
+
+	newRoute := func(name, parentName, backRefs string, directRef ...string) *gatewayapiv1beta1.HTTPRoute {
+		annotations := map[string]string{"kuadrant.io/testpolicies": backRefs}
+		if len(directRef) > 0 {
+			annotations["kuadrant.io/testpolicy-direct-backref"] = directRef[0]
+		}
+		return &gatewayapiv1beta1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "app-ns",
+				Name:        name,
+				Annotations: annotations,
+			},
+			Spec: gatewayapiv1beta1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayapiv1beta1.CommonRouteSpec{
+					ParentRefs: []gatewayapiv1beta1.ParentReference{{Name: gatewayapiv1beta1.ObjectName(parentName), Namespace: &gwNamespace}},
+				},
+			},
+		}
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithIndex(&gatewayapiv1beta1.HTTPRoute{}, HTTPRouteParentRefsIndexField, HTTPRouteParentRefsIndexerFunc).WithObjects(
+		gateway,
+		newRoute("route-1", "gw-1", `[{"Namespace":"app-ns","Name":"policy-2"},{"Namespace":"app-ns","Name":"policy-3"}]`),
+		newRoute("route-2", "gw-1", `[{"Namespace":"app-ns","Name":"policy-4"}]`, "app-ns/policy-6"),
+		newRoute("route-3", "gw-2", `[{"Namespace":"app-ns","Name":"policy-5"}]`, "app-ns/policy-7"),
+	).Build()
+
+	toKeys := func(requests []reconcile.Request) []client.ObjectKey {
+		return common.Map(requests, func(r reconcile.Request) client.ObjectKey { return r.NamespacedName })
+	}
+
+	requests := toKeys(NewGatewayEventMapper().MapToPolicy(gateway, &common.PolicyKindStub{}))
+	if len(requests) != 2 {
+		t.Errorf("expected 2 requests, but got %v", requests)
+	}
+
+	requests = toKeys(NewGatewayEventMapper(WithTransitiveMapping(cl)).MapToPolicy(gateway, &common.PolicyKindStub{}))
+	expected := []client.ObjectKey{
+		{Namespace: "gw-ns", Name: "policy-1"},
+		{Namespace: "app-ns", Name: "policy-2"},
+		{Namespace: "app-ns", Name: "policy-3"},
+		{Namespace: "app-ns", Name: "policy-4"},
+		{Namespace: "app-ns", Name: "policy-6"},
+	}
+	if len(requests) != len(expected) {
+		t.Errorf("expected requests %v, but got %v", expected, requests)
+	}
+	for _, key := range expected {
+		if !common.Contains(requests, key) {
+			t.Errorf("expected requests %v, but got %v", expected, requests)
+		}
+	}
+}
+
+func TestHTTPRouteParentRefsIndexerFunc(t *testing.T) {
+	gwNamespace := gatewayapiv1beta1.Namespace("gw-ns")
+	serviceKind := gatewayapiv1beta1.Kind("Service")
+
+	route := &gatewayapiv1beta1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "route-1"},
+		Spec: gatewayapiv1beta1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayapiv1beta1.CommonRouteSpec{
+				ParentRefs: []gatewayapiv1beta1.ParentReference{
+					{Name: "gw-1", Namespace: &gwNamespace},
+					{Name: "gw-2"},
+					{Name: "svc-1", Kind: &serviceKind},
+				},
+			},
+		},
+	}
+
+	t.Run("when the route has parentRefs then index it by the keys of the parent gateways", func(t *testing.T) {
+		values := HTTPRouteParentRefsIndexerFunc(route)
+		expected := []string{"gw-ns/gw-1", "app-ns/gw-2"}
+		if len(values) != len(expected) || values[0] != expected[0] || values[1] != expected[1] {
+			t.Errorf("expected index values %v, but got %v", expected, values)
+		}
+	})
+
+	t.Run("when the object is not an httproute then do not index it", func(t *testing.T) {
+		if values := HTTPRouteParentRefsIndexerFunc(&gatewayapiv1beta1.Gateway{}); len(values) != 0 {
+			t.Errorf("expected no index values, but got %v", values)
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package mappers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+// NewGatewayClassEventMapper returns an event mapper that maps gatewayclass events to the policies referenced from the gateways of the class.
+// The client is used to look up the gateways.
+// With WithTransitiveMapping, events are also mapped to the policies referenced from the HTTPRoutes attached to those gateways;
+// the routes are listed once per event, not per gateway, so the parentRefs index is not required.
+func NewGatewayClassEventMapper(k8sClient client.Reader, o ...mapperOption) EventMapper {
+	m := newEventMapper[*gatewayapiv1beta1.GatewayClass](o...)
+	m.relatedPolicies = gatewayClassPolicies(k8sClient, m.opts)
+	return m
+}
+
+// gatewayClassPolicies returns a function that looks up the gateways of a gatewayclass and, if the options have a route reader,
+// the httproutes attached to those gateways, and finds the policies of a kind referenced from them
+func gatewayClassPolicies(k8sClient client.Reader, opts mapperOptions) func(context.Context, *gatewayapiv1beta1.GatewayClass, logr.Logger) relatedPoliciesFunc {
+	return func(ctx context.Context, gatewayClass *gatewayapiv1beta1.GatewayClass, logger logr.Logger) relatedPoliciesFunc {
+		gwList := &gatewayapiv1beta1.GatewayList{}
+		gwErr := k8sClient.List(ctx, gwList)
+
+		gateways := make([]*gatewayapiv1beta1.Gateway, 0)
+		for i := range gwList.Items {
+			if string(gwList.Items[i].Spec.GatewayClassName) == gatewayClass.Name {
+				gateways = append(gateways, &gwList.Items[i])
+			}
+		}
+
+		// the routes are listed once for all the gateways of the class, and grouped by parent gateway
+		var routesByGateway map[client.ObjectKey][]*gatewayapiv1beta1.HTTPRoute
+		var routeErr error
+		if opts.routeReader != nil && len(gateways) > 0 {
+			routeList := &gatewayapiv1beta1.HTTPRouteList{}
+			routeErr = opts.routeReader.List(ctx, routeList)
+			routesByGateway = groupHTTPRoutesByGateway(routeList.Items)
+		}
+
+		return func(policyKind common.Referrer) []client.ObjectKey {
+			if gwErr != nil {
+				recordMappingError("gatewayclass", policyKind.Kind(), lookupErrorReason)
+				logger.Info("cannot map gatewayclass related event to kuadrant policies attached to gateways", "error", gwErr)
+				return nil
+			}
+			if routeErr != nil {
+				recordMappingError("gatewayclass", policyKind.Kind(), lookupErrorReason)
+				logger.Info("cannot map gatewayclass related event to kuadrant policies attached to httproutes", "error", routeErr)
+			}
+
+			policyKeys := make([]client.ObjectKey, 0)
+			for _, gateway := range gateways {
+				for _, policyKey := range opts.backReferences(ctx, gateway, policyKind, "gatewayclass", logger) {
+					if !common.Contains(policyKeys, policyKey) {
+						logger.V(1).Info("kuadrant policy possibly affected by the gatewayclass related event found via gateway", policyKind.Kind(), policyKey, "gateway", client.ObjectKeyFromObject(gateway))
+						policyKeys = append(policyKeys, policyKey)
+					}
+				}
+				for _, route := range routesByGateway[client.ObjectKeyFromObject(gateway)] {
+					for _, policyKey := range routePolicyKeys(ctx, route, policyKind, opts, "gatewayclass", logger) {
+						if !common.Contains(policyKeys, policyKey) {
+							logger.V(1).Info("kuadrant policy possibly affected by the gatewayclass related event found via httproute", policyKind.Kind(), policyKey, "httproute", client.ObjectKeyFromObject(route))
+							policyKeys = append(policyKeys, policyKey)
+						}
+					}
+				}
+			}
+			return policyKeys
+		}
+	}
+}
+
+// groupHTTPRoutesByGateway indexes the httproutes by the keys of the gateways referred in their parentRefs
+func groupHTTPRoutesByGateway(routes []gatewayapiv1beta1.HTTPRoute) map[client.ObjectKey][]*gatewayapiv1beta1.HTTPRoute {
+	routesByGateway := make(map[client.ObjectKey][]*gatewayapiv1beta1.HTTPRoute)
+	for i := range routes {
+		route := &routes[i]
+		for _, gwKey := range common.HTTPRouteParentGatewayKeys(route) {
+			if !common.Contains(routesByGateway[gwKey], route) {
+				routesByGateway[gwKey] = append(routesByGateway[gwKey], route)
+			}
+		}
+	}
+	return routesByGateway
+}
@@ -0,0 +1,112 @@
+package mappers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func TestGatewayClassEventMapper(t *testing.T) {
+	err := gatewayapiv1beta1.AddToScheme(scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gwNamespace := gatewayapiv1beta1.Namespace("gw-ns")
+
+	newGateway := func(name, className, backRefs string) *gatewayapiv1beta1.Gateway {
+		return &gatewayapiv1beta1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "gw-ns",
+				Name:        name,
+				Annotations: map[string]string{"kuadrant.io/testpolicies": backRefs},
+			},
+			Spec: gatewayapiv1beta1.GatewaySpec{GatewayClassName: gatewayapiv1beta1.ObjectName(className)},
+		}
+	}
+
+	routeLists := 0
+	cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+		List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if _, ok := list.(*gatewayapiv1beta1.HTTPRouteList); ok {
+				routeLists++
+			}
+			return c.List(ctx, list, opts...)
+		},
+	}).WithObjects(
+		newGateway("gw-1", "istio", `[{"Namespace":"gw-ns","Name":"policy-1"},{"Namespace":"app-ns","Name":"policy-2"}]`),
+		newGateway("gw-2", "istio", `[{"Namespace":"app-ns","Name":"policy-2"}]`),
+		newGateway("gw-3", "envoy", `[{"Namespace":"gw-ns","Name":"policy-3"}]`),
+		&gatewayapiv1beta1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "app-ns",
+				Name:        "route-1",
+				Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-4"}]`},
+			},
+			Spec: gatewayapiv1beta1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayapiv1beta1.CommonRouteSpec{
+					ParentRefs: []gatewayapiv1beta1.ParentReference{{Name: "gw-2", Namespace: &gwNamespace}},
+				},
+			},
+		},
+		&gatewayapiv1beta1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "app-ns",
+				Name:        "route-2",
+				Annotations: map[string]string{"kuadrant.io/testpolicy-direct-backref": "app-ns/policy-5"},
+			},
+			Spec: gatewayapiv1beta1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayapiv1beta1.CommonRouteSpec{
+					ParentRefs: []gatewayapiv1beta1.ParentReference{{Name: "gw-1", Namespace: &gwNamespace}, {Name: "gw-3", Namespace: &gwNamespace}},
+				},
+			},
+		},
+	).Build()
+
+	gatewayClass := &gatewayapiv1beta1.GatewayClass{ObjectMeta: metav1.ObjectMeta{Name: "istio"}}
+
+	t.Run("when gateways are of the class then map to the policies referenced from the gateways, deduplicated", func(t *testing.T) {
+		requests := NewGatewayClassEventMapper(cl).MapToPolicy(gatewayClass, &common.PolicyKindStub{})
+		expected := []reconcile.Request{
+			{NamespacedName: client.ObjectKey{Namespace: "gw-ns", Name: "policy-1"}},
+			{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-2"}},
+		}
+		if !reflect.DeepEqual(requests, expected) {
+			t.Errorf("expected requests %v, but got %v", expected, requests)
+		}
+	})
+
+	t.Run("when the mapping is transitive then also map to the policies referenced from the attached routes, listing the routes once", func(t *testing.T) {
+		routeLists = 0
+		requests := NewGatewayClassEventMapper(cl, WithTransitiveMapping(cl)).MapToPolicy(gatewayClass, &common.PolicyKindStub{})
+		expected := []reconcile.Request{
+			{NamespacedName: client.ObjectKey{Namespace: "gw-ns", Name: "policy-1"}},
+			{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-2"}},
+			{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-5"}},
+			{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-4"}},
+		}
+		if !reflect.DeepEqual(requests, expected) {
+			t.Errorf("expected requests %v, but got %v", expected, requests)
+		}
+		if routeLists != 1 {
+			t.Errorf("expected the routes to be listed once, but got %d lists", routeLists)
+		}
+	})
+
+	t.Run("when no gateway is of the class then map to no policy", func(t *testing.T) {
+		requests := NewGatewayClassEventMapper(cl).MapToPolicy(&gatewayapiv1beta1.GatewayClass{ObjectMeta: metav1.ObjectMeta{Name: "other"}}, &common.PolicyKindStub{})
+		if len(requests) != 0 {
+			t.Errorf("expected no requests, but got %v", requests)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package mappers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	metricsNamespace = "kuadrant"
+	metricsSubsystem = "event_mapper"
+
+	// mapping error reasons
+	typeMismatchErrorReason = "type_mismatch"
+	lookupErrorReason       = "lookup_failed"
+)
+
+var (
+	eventsMappedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "events_total",
+		Help:      "Total number of events mapped to policies, per kind of object and kind of policy",
+	}, []string{"kind", "policy_kind"})
+
+	requestsProducedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "requests_total",
+		Help:      "Total number of policy reconcile requests produced by the mappers, per kind of object and kind of policy",
+	}, []string{"kind", "policy_kind"})
+
+	requestsDeferredTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "requests_deferred_total",
+		Help:      "Total number of policy reconcile requests deferred by the event handlers for exceeding the fan-out cap, per kind of object and kind of policy",
+	}, []string{"kind", "policy_kind"})
+
+	dispatchDeferredTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "dispatch_deferred_total",
+		Help:      "Total number of policy reconcile requests deferred by the multi-referrer event mappers for not fitting in the buffer of the channel of the kind of policy, per kind of policy",
+	}, []string{"policy_kind"})
+
+	mappingErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "errors_total",
+		Help:      "Total number of errors mapping events to policies, per kind of object, kind of policy and reason",
+	}, []string{"kind", "policy_kind", "reason"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(eventsMappedTotal, requestsProducedTotal, requestsDeferredTotal, dispatchDeferredTotal, mappingErrorsTotal)
+}
+
+func recordEventMapped(kind, policyKind string) {
+	eventsMappedTotal.WithLabelValues(kind, policyKind).Inc()
+}
+
+func recordMappingError(kind, policyKind, reason string) {
+	mappingErrorsTotal.WithLabelValues(kind, policyKind, reason).Inc()
+}
+
+func recordRequestsProduced(kind, policyKind string, requests []reconcile.Request) []reconcile.Request {
+	requestsProducedTotal.WithLabelValues(kind, policyKind).Add(float64(len(requests)))
+	return requests
+}
+
+func recordRequestsDeferred(kind, policyKind string, deferred int) {
+	requestsDeferredTotal.WithLabelValues(kind, policyKind).Add(float64(deferred))
+}
+
+func recordDispatchDeferred(policyKind string) {
+	dispatchDeferredTotal.WithLabelValues(policyKind).Inc()
+}
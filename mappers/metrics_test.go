@@ -0,0 +1,110 @@
+package mappers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func TestMapperMetrics(t *testing.T) {
+	policyKind := &common.PolicyKindStub{}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "app-ns",
+			Name:        "svc-1",
+			Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-1"},{"Namespace":"app-ns","Name":"policy-2"},{"Namespace":"app-ns","Name":"policy-3"}]`},
+		},
+	}
+
+	t.Run("when an event is mapped then count the event and the requests", func(t *testing.T) {
+		events := testutil.ToFloat64(eventsMappedTotal.WithLabelValues("service", policyKind.Kind()))
+		requests := testutil.ToFloat64(requestsProducedTotal.WithLabelValues("service", policyKind.Kind()))
+
+		NewEventMapper[*corev1.Service]().MapToPolicy(service, policyKind)
+
+		if delta := testutil.ToFloat64(eventsMappedTotal.WithLabelValues("service", policyKind.Kind())) - events; delta != 1 {
+			t.Errorf("expected 1 event mapped, but got %v", delta)
+		}
+		if delta := testutil.ToFloat64(requestsProducedTotal.WithLabelValues("service", policyKind.Kind())) - requests; delta != 3 {
+			t.Errorf("expected 3 requests produced, but got %v", delta)
+		}
+	})
+
+	t.Run("when the object is not of the type of the mapper then count a mapping error", func(t *testing.T) {
+		errors := testutil.ToFloat64(mappingErrorsTotal.WithLabelValues("gateway", policyKind.Kind(), typeMismatchErrorReason))
+
+		NewGatewayEventMapper().MapToPolicy(service, policyKind)
+
+		if delta := testutil.ToFloat64(mappingErrorsTotal.WithLabelValues("gateway", policyKind.Kind(), typeMismatchErrorReason)) - errors; delta != 1 {
+			t.Errorf("expected 1 mapping error, but got %v", delta)
+		}
+	})
+
+	t.Run("when the requests exceed the fan-out cap then defer and count the exceeding requests", func(t *testing.T) {
+		deferred := testutil.ToFloat64(requestsDeferredTotal.WithLabelValues("service", policyKind.Kind()))
+
+		q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+		defer q.ShutDown()
+
+		h := EnqueueRequestsFromMapper(NewEventMapper[*corev1.Service](WithMaxRequests(2), WithOverflowDelay(100*time.Millisecond)), policyKind)
+		h.Create(context.Background(), event.CreateEvent{Object: service}, q)
+
+		if q.Len() != 2 {
+			t.Errorf("expected 2 requests added right away, but got %d", q.Len())
+		}
+		if delta := testutil.ToFloat64(requestsDeferredTotal.WithLabelValues("service", policyKind.Kind())) - deferred; delta != 1 {
+			t.Errorf("expected 1 request deferred, but got %v", delta)
+		}
+
+		time.Sleep(300 * time.Millisecond)
+
+		if q.Len() != 3 {
+			t.Errorf("expected the deferred request to be added after the overflow delay, but got %d requests", q.Len())
+		}
+	})
+
+	t.Run("when the requests are mapped without the event handler then do not cap them", func(t *testing.T) {
+		requests := NewEventMapper[*corev1.Service](WithMaxRequests(2)).MapToPolicy(service, policyKind)
+
+		if len(requests) != 3 {
+			t.Errorf("expected 3 requests, but got %v", requests)
+		}
+	})
+}
+
+func TestEnqueueRequestsFromMapperWithCoalescingWindow(t *testing.T) {
+	gateway := &gatewayapiv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "gw-ns",
+			Name:        "gw-1",
+			Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-1"}]`},
+		},
+	}
+
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+
+	h := EnqueueRequestsFromMapper(NewGatewayEventMapper(WithCoalescingWindow(100*time.Millisecond)), &common.PolicyKindStub{})
+	for i := 0; i < 5; i++ {
+		h.Update(context.Background(), event.UpdateEvent{ObjectOld: gateway, ObjectNew: gateway}, q)
+	}
+
+	if q.Len() != 0 {
+		t.Errorf("expected no request added before the coalescing window, but got %d", q.Len())
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if q.Len() != 1 {
+		t.Errorf("expected the requests to be coalesced into 1, but got %d", q.Len())
+	}
+}
@@ -0,0 +1,226 @@
+package mappers
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+// DefaultMultiReferrerBufferSize is the default size of the buffer of the per kind of policy channels of a MultiReferrerEventMapper
+const DefaultMultiReferrerBufferSize = 1024
+
+// MultiReferrerEventMapper shares a single watch of a kind of network object among the controllers of several kinds of policies.
+// It maps each event once for all the kinds of policies and dispatches the resulting requests to one channel source per kind of policy,
+// to be watched by the controller of the kind of policy.
+// It is a runnable to add to the manager, that drains the requests deferred for not fitting in the buffers of the channels.
+type MultiReferrerEventMapper struct {
+	mapper    EventMapper
+	referrers []common.Referrer
+	channels  map[string]chan event.GenericEvent
+	sources   map[string]*source.Channel
+
+	// overflow holds, per kind of policy, the requests deferred for not fitting in the buffer of the channel, until drained into the channel
+	overflow map[string]workqueue.Interface
+}
+
+// NewMultiReferrerEventMapper returns a MultiReferrerEventMapper that maps the events with the event mapper to the policies of the kinds of the referrers
+func NewMultiReferrerEventMapper(mapper EventMapper, referrers []common.Referrer, o ...multiReferrerOption) *MultiReferrerEventMapper {
+	opts := applyMultiReferrerOptions(o...)
+	m := &MultiReferrerEventMapper{
+		mapper:    mapper,
+		referrers: referrers,
+		channels:  make(map[string]chan event.GenericEvent, len(referrers)),
+		sources:   make(map[string]*source.Channel, len(referrers)),
+		overflow:  make(map[string]workqueue.Interface, len(referrers)),
+	}
+	for _, referrer := range referrers {
+		ch := make(chan event.GenericEvent, opts.bufferSize)
+		m.channels[referrer.Kind()] = ch
+		m.sources[referrer.Kind()] = &source.Channel{Source: ch}
+		m.overflow[referrer.Kind()] = workqueue.New()
+	}
+	return m
+}
+
+// Source returns the source of the events mapped to the policies of a kind, to be watched by the controller of the kind of policy
+// with handler.EnqueueRequestForObject. Returns nil if the kind of policy is not one of the referrers of the mapper.
+func (m *MultiReferrerEventMapper) Source(policyKind common.Referrer) source.Source {
+	src, ok := m.sources[policyKind.Kind()]
+	if !ok {
+		return nil
+	}
+	return src
+}
+
+// EventHandler returns the event handler to register once, for the watch of the network objects, in any of the controllers.
+// The handler does not add to the workqueue of the controller, but dispatches the mapped requests to the sources of the kinds of policies.
+func (m *MultiReferrerEventMapper) EventHandler() handler.EventHandler {
+	return &multiReferrerEventHandler{mapper: m}
+}
+
+// MapToPolicies maps the objects of an event to the policies of all the kinds of the referrers, indexed by kind of policy.
+// With the mappers of this package, the objects related to each object of the event (e.g. the routes attached to a gateway) are looked up
+// only once for all the kinds of policies.
+func (m *MultiReferrerEventMapper) MapToPolicies(ctx context.Context, objs ...client.Object) map[string][]reconcile.Request {
+	requests := make(map[string][]reconcile.Request, len(m.referrers))
+	for _, referrer := range m.referrers {
+		requests[referrer.Kind()] = make([]reconcile.Request, 0)
+	}
+	add := func(policyKind string, kindRequests []reconcile.Request) {
+		for _, request := range kindRequests {
+			if !common.Contains(requests[policyKind], request) {
+				requests[policyKind] = append(requests[policyKind], request)
+			}
+		}
+	}
+
+	for _, obj := range objs {
+		if mapper, ok := m.mapper.(contextualEventMapper); ok {
+			for policyKind, kindRequests := range mapper.mapToPolicies(ctx, obj, m.referrers) {
+				add(policyKind, kindRequests)
+			}
+			continue
+		}
+		for _, referrer := range m.referrers {
+			add(referrer.Kind(), m.mapper.MapToPolicy(obj, referrer))
+		}
+	}
+
+	return requests
+}
+
+// dispatch sends the requests mapped from the objects of an event to the channels of the kinds of policies.
+// It never blocks the watch of the network objects: the requests that do not fit in the buffer of the channel of a kind of policy
+// – e.g. because its controller is not started or lags behind – are deferred, logged and counted. The deferred requests are deduplicated
+// and drained into the channel by Start, as the controller of the kind of policy catches up.
+func (m *MultiReferrerEventMapper) dispatch(ctx context.Context, objs ...client.Object) {
+	logger, _ := logr.FromContext(ctx)
+	for policyKind, requests := range m.MapToPolicies(ctx, objs...) {
+		overflow := m.overflow[policyKind]
+		for _, request := range requests {
+			// while there are deferred requests, the new ones are deferred too, so they are not sent ahead of the older ones
+			if overflow.Len() == 0 {
+				select {
+				case m.channels[policyKind] <- requestEvent(request):
+					continue
+				default:
+				}
+			}
+			logger.Info("channel of the kind of policy is full, deferring the request", "policyKind", policyKind, "request", request.NamespacedName)
+			recordDispatchDeferred(policyKind)
+			overflow.Add(request)
+		}
+	}
+}
+
+// Start drains the requests deferred for not fitting in the buffers of the channels into the channels, until the context is done
+func (m *MultiReferrerEventMapper) Start(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for policyKind := range m.overflow {
+		wg.Add(1)
+		go func(policyKind string) {
+			defer wg.Done()
+			m.drain(ctx, policyKind)
+		}(policyKind)
+	}
+	<-ctx.Done()
+	for _, overflow := range m.overflow {
+		overflow.ShutDown()
+	}
+	wg.Wait()
+	return nil
+}
+
+// drain sends the deferred requests of a kind of policy to its channel, blocking until there is room in the channel or the context is done
+func (m *MultiReferrerEventMapper) drain(ctx context.Context, policyKind string) {
+	overflow := m.overflow[policyKind]
+	for {
+		item, shutdown := overflow.Get()
+		if shutdown {
+			return
+		}
+		select {
+		case m.channels[policyKind] <- requestEvent(item.(reconcile.Request)):
+			overflow.Done(item)
+		case <-ctx.Done():
+			overflow.Done(item)
+			return
+		}
+	}
+}
+
+// requestEvent returns the generic event of the channel source for a request
+func requestEvent(request reconcile.Request) event.GenericEvent {
+	return event.GenericEvent{Object: &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: request.Namespace, Name: request.Name}}}
+}
+
+type multiReferrerEventHandler struct {
+	mapper *MultiReferrerEventMapper
+}
+
+var _ handler.EventHandler = &multiReferrerEventHandler{}
+
+func (h *multiReferrerEventHandler) Create(ctx context.Context, evt event.CreateEvent, _ workqueue.RateLimitingInterface) {
+	h.mapper.dispatch(ctx, evt.Object)
+}
+
+func (h *multiReferrerEventHandler) Update(ctx context.Context, evt event.UpdateEvent, _ workqueue.RateLimitingInterface) {
+	h.mapper.dispatch(ctx, evt.ObjectOld, evt.ObjectNew)
+}
+
+func (h *multiReferrerEventHandler) Delete(ctx context.Context, evt event.DeleteEvent, _ workqueue.RateLimitingInterface) {
+	h.mapper.dispatch(context.WithValue(ctx, deleteEventContextKey{}, true), evt.Object)
+}
+
+func (h *multiReferrerEventHandler) Generic(ctx context.Context, evt event.GenericEvent, _ workqueue.RateLimitingInterface) {
+	h.mapper.dispatch(ctx, evt.Object)
+}
+
+// options
+
+// WithBufferSize sets the size of the buffer of the per kind of policy channels of a MultiReferrerEventMapper. Defaults to DefaultMultiReferrerBufferSize.
+func WithBufferSize(size int) multiReferrerOption {
+	return newFuncMultiReferrerOption(func(o *multiReferrerOptions) {
+		o.bufferSize = size
+	})
+}
+
+type multiReferrerOption interface {
+	apply(*multiReferrerOptions)
+}
+
+type multiReferrerOptions struct {
+	bufferSize int
+}
+
+func newFuncMultiReferrerOption(f func(*multiReferrerOptions)) *funcMultiReferrerOption {
+	return &funcMultiReferrerOption{
+		f: f,
+	}
+}
+
+type funcMultiReferrerOption struct {
+	f func(*multiReferrerOptions)
+}
+
+func (fmo *funcMultiReferrerOption) apply(opts *multiReferrerOptions) {
+	fmo.f(opts)
+}
+
+func applyMultiReferrerOptions(opt ...multiReferrerOption) multiReferrerOptions {
+	opts := multiReferrerOptions{bufferSize: DefaultMultiReferrerBufferSize}
+	for _, o := range opt {
+		o.apply(&opts)
+	}
+	return opts
+}
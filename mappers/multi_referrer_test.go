@@ -0,0 +1,184 @@
+package mappers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+type otherPolicyKindStub struct{}
+
+func (o *otherPolicyKindStub) Kind() string {
+	return "OtherTestPolicy"
+}
+
+func (o *otherPolicyKindStub) BackReferenceAnnotationName() string {
+	return "kuadrant.io/othertestpolicies"
+}
+
+func TestMultiReferrerEventMapper(t *testing.T) {
+	err := gatewayapiv1beta1.AddToScheme(scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gateway := &gatewayapiv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "gw-ns",
+			Name:      "gw-1",
+			Annotations: map[string]string{
+				"kuadrant.io/testpolicies":      `[{"Namespace":"app-ns","Name":"policy-1"}]`,
+				"kuadrant.io/othertestpolicies": `[{"Namespace":"app-ns","Name":"policy-2"},{"Namespace":"app-ns","Name":"policy-3"}]`,
+			},
+		},
+	}
+
+	policyKind := &common.PolicyKindStub{}
+	otherPolicyKind := &otherPolicyKindStub{}
+
+	m := NewMultiReferrerEventMapper(NewGatewayEventMapper(), []common.Referrer{policyKind, otherPolicyKind})
+
+	t.Run("when mapping an event then map to the policies of all the kinds", func(t *testing.T) {
+		requests := m.MapToPolicies(context.Background(), gateway)
+		expected := map[string][]reconcile.Request{
+			"TestPolicy":      {{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-1"}}},
+			"OtherTestPolicy": {{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-2"}}, {NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-3"}}},
+		}
+		if !reflect.DeepEqual(requests, expected) {
+			t.Errorf("expected requests %v, but got %v", expected, requests)
+		}
+	})
+
+	t.Run("when handling an event then dispatch the requests to the channels of the kinds of policies", func(t *testing.T) {
+		m.EventHandler().Update(context.Background(), event.UpdateEvent{ObjectOld: gateway, ObjectNew: gateway}, nil)
+
+		received := func(policyKind common.Referrer) []client.ObjectKey {
+			keys := make([]client.ObjectKey, 0)
+			ch := m.channels[policyKind.Kind()]
+			for len(ch) > 0 {
+				keys = append(keys, client.ObjectKeyFromObject((<-ch).Object))
+			}
+			return keys
+		}
+
+		if keys, expected := received(policyKind), []client.ObjectKey{{Namespace: "app-ns", Name: "policy-1"}}; !reflect.DeepEqual(keys, expected) {
+			t.Errorf("expected %v, but got %v", expected, keys)
+		}
+		if keys, expected := received(otherPolicyKind), []client.ObjectKey{{Namespace: "app-ns", Name: "policy-2"}, {Namespace: "app-ns", Name: "policy-3"}}; !reflect.DeepEqual(keys, expected) {
+			t.Errorf("expected %v, but got %v", expected, keys)
+		}
+	})
+
+	t.Run("when the channel of a kind of policy is full then defer the request without blocking and drain it once there is room", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		m := NewMultiReferrerEventMapper(NewGatewayEventMapper(), []common.Referrer{otherPolicyKind}, WithBufferSize(1))
+		started := make(chan error)
+		go func() { started <- m.Start(ctx) }()
+		defer func() {
+			cancel()
+			if err := <-started; err != nil {
+				t.Error(err)
+			}
+		}()
+		ch := m.channels[otherPolicyKind.Kind()]
+		deferred := testutil.ToFloat64(dispatchDeferredTotal.WithLabelValues(otherPolicyKind.Kind()))
+
+		done := make(chan struct{})
+		go func() {
+			eventCtx, eventCancel := context.WithCancel(ctx)
+			defer eventCancel()
+			m.EventHandler().Create(eventCtx, event.CreateEvent{Object: gateway}, nil)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("expected the dispatch not to block on the full channel")
+		}
+
+		if delta := testutil.ToFloat64(dispatchDeferredTotal.WithLabelValues(otherPolicyKind.Kind())) - deferred; delta != 1 {
+			t.Errorf("expected 1 request deferred, but got %v", delta)
+		}
+
+		keys := make([]client.ObjectKey, 0)
+		for len(keys) < 2 {
+			select {
+			case evt := <-ch:
+				keys = append(keys, client.ObjectKeyFromObject(evt.Object))
+			case <-time.After(time.Second):
+				t.Fatalf("expected the deferred request to be drained into the channel, but got %v", keys)
+			}
+		}
+		if expected := []client.ObjectKey{{Namespace: "app-ns", Name: "policy-2"}, {Namespace: "app-ns", Name: "policy-3"}}; !reflect.DeepEqual(keys, expected) {
+			t.Errorf("expected %v, but got %v", expected, keys)
+		}
+	})
+
+	t.Run("when mapping an event then look up the related objects once for all the kinds of policies", func(t *testing.T) {
+		gwNamespace := gatewayapiv1beta1.Namespace("gw-ns")
+		routeLists := 0
+		cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithIndex(&gatewayapiv1beta1.HTTPRoute{}, HTTPRouteParentRefsIndexField, HTTPRouteParentRefsIndexerFunc).WithInterceptorFuncs(interceptor.Funcs{
+			List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				if _, ok := list.(*gatewayapiv1beta1.HTTPRouteList); ok {
+					routeLists++
+				}
+				return c.List(ctx, list, opts...)
+			},
+		}).WithObjects(
+			&gatewayapiv1beta1.HTTPRoute{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "app-ns",
+					Name:      "route-1",
+					Annotations: map[string]string{
+						"kuadrant.io/testpolicies":      `[{"Namespace":"app-ns","Name":"policy-4"}]`,
+						"kuadrant.io/othertestpolicies": `[{"Namespace":"app-ns","Name":"policy-5"}]`,
+					},
+				},
+				Spec: gatewayapiv1beta1.HTTPRouteSpec{
+					CommonRouteSpec: gatewayapiv1beta1.CommonRouteSpec{
+						ParentRefs: []gatewayapiv1beta1.ParentReference{{Name: "gw-1", Namespace: &gwNamespace}},
+					},
+				},
+			},
+		).Build()
+
+		m := NewMultiReferrerEventMapper(NewGatewayEventMapper(WithTransitiveMapping(cl)), []common.Referrer{policyKind, otherPolicyKind})
+		requests := m.MapToPolicies(context.Background(), gateway)
+		expected := map[string][]reconcile.Request{
+			"TestPolicy":      {{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-1"}}, {NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-4"}}},
+			"OtherTestPolicy": {{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-2"}}, {NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-3"}}, {NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-5"}}},
+		}
+		if !reflect.DeepEqual(requests, expected) {
+			t.Errorf("expected requests %v, but got %v", expected, requests)
+		}
+		if routeLists != 1 {
+			t.Errorf("expected the routes to be listed once, but they were listed %d times", routeLists)
+		}
+	})
+
+	t.Run("when the kind of policy is not a referrer of the mapper then return no source", func(t *testing.T) {
+		m := NewMultiReferrerEventMapper(NewGatewayEventMapper(), []common.Referrer{policyKind})
+		if m.Source(policyKind) == nil {
+			t.Error("expected a source for the kind of policy")
+		}
+		if m.Source(otherPolicyKind) != nil {
+			t.Error("expected no source for the other kind of policy")
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package mappers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+// NewNamespaceEventMapper returns an event mapper that maps namespace events to the policies referenced from the gateways whose listeners
+// select the namespace by label (allowedRoutes.namespaces.from: Selector) and from the httproutes in the namespace.
+// Because relabeling a namespace may also unselect it, the policies mapped from the previous event of the namespace are mapped again.
+// The client is used to look up the gateways and the routes.
+func NewNamespaceEventMapper(k8sClient client.Reader, o ...mapperOption) EventMapper {
+	m := newEventMapper[*corev1.Namespace](o...)
+	m.relatedPolicies = namespacePolicies(k8sClient, m.opts, newTargetIndex())
+	return m
+}
+
+// namespacePolicies returns a function that looks up the gateways that select a namespace and the httproutes in the namespace, and finds the policies
+// of a kind referenced from them, including the policies that target the httproutes directly, plus the ones found for the previous event of the namespace
+func namespacePolicies(k8sClient client.Reader, opts mapperOptions, previous *targetIndex) func(context.Context, *corev1.Namespace, logr.Logger) relatedPoliciesFunc {
+	return func(ctx context.Context, namespace *corev1.Namespace, logger logr.Logger) relatedPoliciesFunc {
+		gwList := &gatewayapiv1beta1.GatewayList{}
+		gwErr := k8sClient.List(ctx, gwList)
+
+		routeList := &gatewayapiv1beta1.HTTPRouteList{}
+		routeErr := k8sClient.List(ctx, routeList, client.InNamespace(namespace.Name))
+
+		return func(policyKind common.Referrer) []client.ObjectKey {
+			policyKeys := make([]client.ObjectKey, 0)
+			addPolicyKeys := func(obj client.Object, objPolicyKeys []client.ObjectKey, via string) {
+				for _, policyKey := range objPolicyKeys {
+					if !common.Contains(policyKeys, policyKey) {
+						logger.V(1).Info("kuadrant policy possibly affected by the namespace related event found via "+via, policyKind.Kind(), policyKey, via, client.ObjectKeyFromObject(obj))
+						policyKeys = append(policyKeys, policyKey)
+					}
+				}
+			}
+
+			if gwErr != nil {
+				recordMappingError("namespace", policyKind.Kind(), lookupErrorReason)
+				logger.Info("cannot map namespace related event to kuadrant policies attached to gateways", "error", gwErr)
+			}
+			for i := range gwList.Items {
+				if gatewaySelectsNamespace(&gwList.Items[i], namespace) {
+					gateway := &gwList.Items[i]
+					addPolicyKeys(gateway, opts.backReferences(ctx, gateway, policyKind, "namespace", logger), "gateway")
+				}
+			}
+
+			if routeErr != nil {
+				recordMappingError("namespace", policyKind.Kind(), lookupErrorReason)
+				logger.Info("cannot map namespace related event to kuadrant policies attached to httproutes", "error", routeErr)
+			}
+			for i := range routeList.Items {
+				route := &routeList.Items[i]
+				addPolicyKeys(route, routePolicyKeys(ctx, route, policyKind, opts, "namespace", logger), "httproute")
+			}
+
+			key := targetIndexKey{kind: "namespace", policyKind: policyKind.Kind(), target: client.ObjectKeyFromObject(namespace)}
+			current := append([]client.ObjectKey{}, policyKeys...)
+			for _, policyKey := range previous.get(key) {
+				if !common.Contains(policyKeys, policyKey) {
+					logger.V(1).Info("kuadrant policy possibly affected by the namespace related event found in the previous state of the namespace", policyKind.Kind(), policyKey)
+					policyKeys = append(policyKeys, policyKey)
+				}
+			}
+			if isDeleteEvent(ctx) {
+				previous.delete(key)
+			} else {
+				previous.set(key, current)
+			}
+
+			return policyKeys
+		}
+	}
+}
+
+// gatewaySelectsNamespace tells whether any of the listeners of a gateway allows routes from a namespace by label selector
+func gatewaySelectsNamespace(gateway *gatewayapiv1beta1.Gateway, namespace *corev1.Namespace) bool {
+	for _, listener := range gateway.Spec.Listeners {
+		if listener.AllowedRoutes == nil || listener.AllowedRoutes.Namespaces == nil {
+			continue
+		}
+		namespaces := listener.AllowedRoutes.Namespaces
+		if namespaces.From == nil || *namespaces.From != gatewayapiv1beta1.NamespacesFromSelector || namespaces.Selector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(namespaces.Selector)
+		if err != nil {
+			continue
+		}
+		if selector.Matches(labels.Set(namespace.GetLabels())) {
+			return true
+		}
+	}
+	return false
+}
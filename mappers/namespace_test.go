@@ -0,0 +1,100 @@
+package mappers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func TestNamespaceEventMapper(t *testing.T) {
+	err := gatewayapiv1beta1.AddToScheme(scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromSelector := gatewayapiv1beta1.NamespacesFromSelector
+	fromAll := gatewayapiv1beta1.NamespacesFromAll
+
+	newGateway := func(name string, from *gatewayapiv1beta1.FromNamespaces, selector *metav1.LabelSelector, backRefs string) *gatewayapiv1beta1.Gateway {
+		return &gatewayapiv1beta1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "gw-ns",
+				Name:        name,
+				Annotations: map[string]string{"kuadrant.io/testpolicies": backRefs},
+			},
+			Spec: gatewayapiv1beta1.GatewaySpec{
+				Listeners: []gatewayapiv1beta1.Listener{{
+					Name:          "http",
+					AllowedRoutes: &gatewayapiv1beta1.AllowedRoutes{Namespaces: &gatewayapiv1beta1.RouteNamespaces{From: from, Selector: selector}},
+				}},
+			},
+		}
+	}
+
+	cl := fake.NewFakeClient(
+		newGateway("gw-1", &fromSelector, &metav1.LabelSelector{MatchLabels: map[string]string{"expose": "true"}}, `[{"Namespace":"gw-ns","Name":"policy-1"}]`),
+		newGateway("gw-2", &fromSelector, &metav1.LabelSelector{MatchLabels: map[string]string{"expose": "internal"}}, `[{"Namespace":"gw-ns","Name":"policy-2"}]`),
+		newGateway("gw-3", &fromAll, nil, `[{"Namespace":"gw-ns","Name":"policy-3"}]`),
+		&gatewayapiv1beta1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "app-ns",
+				Name:        "route-1",
+				Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-4"}]`},
+			},
+		},
+		&gatewayapiv1beta1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "app-ns",
+				Name:        "route-3",
+				Annotations: map[string]string{"kuadrant.io/testpolicy-direct-backref": "app-ns/policy-6"},
+			},
+		},
+		&gatewayapiv1beta1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "other-ns",
+				Name:        "route-2",
+				Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"other-ns","Name":"policy-5"}]`},
+			},
+		},
+	)
+
+	mapper := NewNamespaceEventMapper(cl)
+
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app-ns", Labels: map[string]string{"expose": "true"}}}
+
+	t.Run("when gateways select the namespace then map to the policies of the gateways and of the routes in the namespace", func(t *testing.T) {
+		requests := mapper.MapToPolicy(namespace, &common.PolicyKindStub{})
+		expected := []reconcile.Request{
+			{NamespacedName: client.ObjectKey{Namespace: "gw-ns", Name: "policy-1"}},
+			{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-4"}},
+			{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-6"}},
+		}
+		if !reflect.DeepEqual(requests, expected) {
+			t.Errorf("expected requests %v, but got %v", expected, requests)
+		}
+	})
+
+	t.Run("when the namespace is relabeled then also map to the policies of the gateways that selected the namespace before", func(t *testing.T) {
+		relabeled := namespace.DeepCopy()
+		relabeled.Labels = map[string]string{"expose": "internal"}
+		requests := mapper.MapToPolicy(relabeled, &common.PolicyKindStub{})
+		expected := []reconcile.Request{
+			{NamespacedName: client.ObjectKey{Namespace: "gw-ns", Name: "policy-2"}},
+			{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-4"}},
+			{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-6"}},
+			{NamespacedName: client.ObjectKey{Namespace: "gw-ns", Name: "policy-1"}},
+		}
+		if !reflect.DeepEqual(requests, expected) {
+			t.Errorf("expected requests %v, but got %v", expected, requests)
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package mappers
+
+import (
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+// RelevantField is a field of the Gateway API network objects whose changes may affect the policies targeting them
+type RelevantField string
+
+const (
+	// ListenersField is the spec.listeners of a gateway
+	ListenersField RelevantField = "listeners"
+	// GatewayClassNameField is the spec.gatewayClassName of a gateway
+	GatewayClassNameField RelevantField = "gatewayClassName"
+	// AddressesField is the spec.addresses and status.addresses of a gateway
+	AddressesField RelevantField = "addresses"
+	// HostnamesField is the spec.hostnames of an httproute
+	HostnamesField RelevantField = "hostnames"
+	// ParentRefsField is the spec.parentRefs of an httproute
+	ParentRefsField RelevantField = "parentRefs"
+	// ProgrammedConditionField is the Programmed condition of a gateway
+	ProgrammedConditionField RelevantField = "programmedCondition"
+	// AcceptedConditionField is the Accepted condition of a gateway or of the parents of an httproute
+	AcceptedConditionField RelevantField = "acceptedCondition"
+	// AnnotationsField is the back reference annotations of the kind of policy
+	AnnotationsField RelevantField = "annotations"
+)
+
+// DefaultRelevantFields are the fields checked by PolicyRelevantChangedPredicate unless set otherwise with WithRelevantFields
+var DefaultRelevantFields = []RelevantField{
+	ListenersField,
+	GatewayClassNameField,
+	AddressesField,
+	HostnamesField,
+	ParentRefsField,
+	ProgrammedConditionField,
+	AcceptedConditionField,
+	AnnotationsField,
+}
+
+// PolicyRelevantChangedPredicate returns a predicate that filters out update events of gateways and httproutes where nothing relevant to
+// the kind of policy changed, e.g. status heartbeats. Create, delete and generic events, update events where the deletion timestamp changed
+// (i.e. the object is being deleted) and update events of other kinds of objects always pass.
+func PolicyRelevantChangedPredicate(policyKind common.Referrer, o ...predicateOption) predicate.Predicate {
+	opts := applyPredicateOptions(o...)
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if e.ObjectOld == nil || e.ObjectNew == nil {
+				return true
+			}
+			if !equality.Semantic.DeepEqual(e.ObjectOld.GetDeletionTimestamp(), e.ObjectNew.GetDeletionTimestamp()) {
+				return true
+			}
+			for _, field := range opts.relevantFields {
+				if relevantFieldChanged(field, policyKind, e.ObjectOld, e.ObjectNew) {
+					return true
+				}
+			}
+			return !isGatewayAPINetworkObject(e.ObjectNew)
+		},
+	}
+}
+
+func isGatewayAPINetworkObject(obj client.Object) bool {
+	switch obj.(type) {
+	case *gatewayapiv1beta1.Gateway, *gatewayapiv1beta1.HTTPRoute:
+		return true
+	default:
+		return false
+	}
+}
+
+// relevantFieldChanged tells whether a field changed between the old and the new versions of an object
+func relevantFieldChanged(field RelevantField, policyKind common.Referrer, oldObj, newObj client.Object) bool {
+	if field == AnnotationsField {
+		return backReferenceAnnotationsChanged(policyKind, oldObj, newObj)
+	}
+
+	switch newO := newObj.(type) {
+	case *gatewayapiv1beta1.Gateway:
+		oldO, ok := oldObj.(*gatewayapiv1beta1.Gateway)
+		if !ok {
+			return true
+		}
+		switch field {
+		case ListenersField:
+			return !equality.Semantic.DeepEqual(oldO.Spec.Listeners, newO.Spec.Listeners)
+		case GatewayClassNameField:
+			return oldO.Spec.GatewayClassName != newO.Spec.GatewayClassName
+		case AddressesField:
+			return !equality.Semantic.DeepEqual(oldO.Spec.Addresses, newO.Spec.Addresses) || !equality.Semantic.DeepEqual(oldO.Status.Addresses, newO.Status.Addresses)
+		case ProgrammedConditionField:
+			return conditionChanged(oldO.Status.Conditions, newO.Status.Conditions, string(gatewayapiv1beta1.GatewayConditionProgrammed))
+		case AcceptedConditionField:
+			return conditionChanged(oldO.Status.Conditions, newO.Status.Conditions, string(gatewayapiv1beta1.GatewayConditionAccepted))
+		}
+	case *gatewayapiv1beta1.HTTPRoute:
+		oldO, ok := oldObj.(*gatewayapiv1beta1.HTTPRoute)
+		if !ok {
+			return true
+		}
+		switch field {
+		case HostnamesField:
+			return !equality.Semantic.DeepEqual(oldO.Spec.Hostnames, newO.Spec.Hostnames)
+		case ParentRefsField:
+			return !equality.Semantic.DeepEqual(oldO.Spec.ParentRefs, newO.Spec.ParentRefs)
+		case AcceptedConditionField:
+			return routeParentsAcceptedConditionChanged(oldO.Status.Parents, newO.Status.Parents)
+		}
+	}
+
+	return false
+}
+
+// backReferenceAnnotationsChanged tells whether the back reference annotations of the kind of policy changed
+func backReferenceAnnotationsChanged(policyKind common.Referrer, oldObj, newObj client.Object) bool {
+	annotationNames := []string{policyKind.BackReferenceAnnotationName()}
+	if directReferrer, ok := policyKind.(common.DirectReferrer); ok {
+		annotationNames = append(annotationNames, directReferrer.DirectReferenceAnnotationName())
+	}
+	oldAnnotations := oldObj.GetAnnotations()
+	newAnnotations := newObj.GetAnnotations()
+	for _, name := range annotationNames {
+		if oldAnnotations[name] != newAnnotations[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionChanged tells whether the status or the reason of a condition changed, ignoring timestamps and messages
+func conditionChanged(oldConditions, newConditions []metav1.Condition, conditionType string) bool {
+	oldCondition := meta.FindStatusCondition(oldConditions, conditionType)
+	newCondition := meta.FindStatusCondition(newConditions, conditionType)
+	if oldCondition == nil || newCondition == nil {
+		return oldCondition != newCondition
+	}
+	return oldCondition.Status != newCondition.Status || oldCondition.Reason != newCondition.Reason
+}
+
+// routeParentsAcceptedConditionChanged tells whether the Accepted condition of any of the parents of a route changed
+func routeParentsAcceptedConditionChanged(oldParents, newParents []gatewayapiv1beta1.RouteParentStatus) bool {
+	if len(oldParents) != len(newParents) {
+		return true
+	}
+	for i := range newParents {
+		if !equality.Semantic.DeepEqual(oldParents[i].ParentRef, newParents[i].ParentRef) {
+			return true
+		}
+		if conditionChanged(oldParents[i].Conditions, newParents[i].Conditions, string(gatewayapiv1beta1.RouteConditionAccepted)) {
+			return true
+		}
+	}
+	return false
+}
+
+// options
+
+// WithRelevantFields sets the fields whose changes make update events pass the predicate
+func WithRelevantFields(fields ...RelevantField) predicateOption {
+	return newFuncPredicateOption(func(o *predicateOptions) {
+		o.relevantFields = fields
+	})
+}
+
+type predicateOption interface {
+	apply(*predicateOptions)
+}
+
+type predicateOptions struct {
+	relevantFields []RelevantField
+}
+
+func newFuncPredicateOption(f func(*predicateOptions)) *funcPredicateOption {
+	return &funcPredicateOption{
+		f: f,
+	}
+}
+
+type funcPredicateOption struct {
+	f func(*predicateOptions)
+}
+
+func (fpo *funcPredicateOption) apply(opts *predicateOptions) {
+	fpo.f(opts)
+}
+
+func applyPredicateOptions(opt ...predicateOption) predicateOptions {
+	opts := predicateOptions{relevantFields: DefaultRelevantFields}
+	for _, o := range opt {
+		o.apply(&opts)
+	}
+	return opts
+}
@@ -0,0 +1,170 @@
+package mappers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func TestPolicyRelevantChangedPredicate(t *testing.T) {
+	gateway := &gatewayapiv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1"},
+		Spec: gatewayapiv1beta1.GatewaySpec{
+			Listeners: []gatewayapiv1beta1.Listener{{Name: "http", Port: 80, Protocol: gatewayapiv1beta1.HTTPProtocolType}},
+		},
+		Status: gatewayapiv1beta1.GatewayStatus{
+			Conditions: []metav1.Condition{{Type: "Programmed", Status: metav1.ConditionTrue, Reason: "Programmed", LastTransitionTime: metav1.Unix(0, 0)}},
+		},
+	}
+
+	route := &gatewayapiv1beta1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "route-1"},
+		Spec: gatewayapiv1beta1.HTTPRouteSpec{
+			Hostnames: []gatewayapiv1beta1.Hostname{"api.example.com"},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		oldObj   client.Object
+		newObj   func() client.Object
+		opts     []predicateOption
+		expected bool
+	}{
+		{
+			name:   "when only the timestamp of a gateway condition changed then filter out the event",
+			oldObj: gateway,
+			newObj: func() client.Object {
+				gw := gateway.DeepCopy()
+				gw.Status.Conditions[0].LastTransitionTime = metav1.Unix(60, 0)
+				gw.Status.Conditions[0].Message = "heartbeat"
+				return gw
+			},
+			expected: false,
+		},
+		{
+			name:   "when the Programmed condition of a gateway changed then pass the event",
+			oldObj: gateway,
+			newObj: func() client.Object {
+				gw := gateway.DeepCopy()
+				gw.Status.Conditions[0].Status = metav1.ConditionFalse
+				return gw
+			},
+			expected: true,
+		},
+		{
+			name:   "when the listeners of a gateway changed then pass the event",
+			oldObj: gateway,
+			newObj: func() client.Object {
+				gw := gateway.DeepCopy()
+				gw.Spec.Listeners[0].Port = 8080
+				return gw
+			},
+			expected: true,
+		},
+		{
+			name:   "when the listeners of a gateway changed but they are not relevant then filter out the event",
+			oldObj: gateway,
+			newObj: func() client.Object {
+				gw := gateway.DeepCopy()
+				gw.Spec.Listeners[0].Port = 8080
+				return gw
+			},
+			opts:     []predicateOption{WithRelevantFields(AnnotationsField)},
+			expected: false,
+		},
+		{
+			name:   "when the gateway class of a gateway changed then pass the event",
+			oldObj: gateway,
+			newObj: func() client.Object {
+				gw := gateway.DeepCopy()
+				gw.Spec.GatewayClassName = "other-class"
+				return gw
+			},
+			expected: true,
+		},
+		{
+			name:   "when a gateway is being deleted then pass the event even if no relevant field changed",
+			oldObj: gateway,
+			newObj: func() client.Object {
+				gw := gateway.DeepCopy()
+				deletionTimestamp := metav1.Unix(120, 0)
+				gw.DeletionTimestamp = &deletionTimestamp
+				gw.Finalizers = []string{"kuadrant.io/test"}
+				return gw
+			},
+			opts:     []predicateOption{WithRelevantFields(AnnotationsField)},
+			expected: true,
+		},
+		{
+			name:   "when the back reference annotation of the kind of policy changed then pass the event",
+			oldObj: gateway,
+			newObj: func() client.Object {
+				gw := gateway.DeepCopy()
+				gw.Annotations = map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-1"}]`}
+				return gw
+			},
+			expected: true,
+		},
+		{
+			name:   "when another annotation changed then filter out the event",
+			oldObj: gateway,
+			newObj: func() client.Object {
+				gw := gateway.DeepCopy()
+				gw.Annotations = map[string]string{"kuadrant.io/otherpolicies": `[{"Namespace":"app-ns","Name":"policy-1"}]`}
+				return gw
+			},
+			expected: false,
+		},
+		{
+			name:   "when the hostnames of a route changed then pass the event",
+			oldObj: route,
+			newObj: func() client.Object {
+				r := route.DeepCopy()
+				r.Spec.Hostnames = append(r.Spec.Hostnames, "www.example.com")
+				return r
+			},
+			expected: true,
+		},
+		{
+			name:   "when only the labels of a route changed then filter out the event",
+			oldObj: route,
+			newObj: func() client.Object {
+				r := route.DeepCopy()
+				r.Labels = map[string]string{"app": "test"}
+				return r
+			},
+			expected: false,
+		},
+		{
+			name:   "when the object is not a gateway api network object then pass the event",
+			oldObj: &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "svc-1"}},
+			newObj: func() client.Object {
+				return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "svc-1", Labels: map[string]string{"app": "test"}}}
+			},
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := PolicyRelevantChangedPredicate(&common.PolicyKindStub{}, tc.opts...)
+			if result := p.Update(event.UpdateEvent{ObjectOld: tc.oldObj, ObjectNew: tc.newObj()}); result != tc.expected {
+				t.Errorf("expected %t, but got %t", tc.expected, result)
+			}
+		})
+	}
+
+	t.Run("when the object is created or deleted then pass the event", func(t *testing.T) {
+		p := PolicyRelevantChangedPredicate(&common.PolicyKindStub{})
+		if !p.Create(event.CreateEvent{Object: gateway}) || !p.Delete(event.DeleteEvent{Object: gateway}) {
+			t.Error("expected create and delete events to pass")
+		}
+	})
+}
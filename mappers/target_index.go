@@ -0,0 +1,205 @@
+package mappers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+// targetIndex is an in-memory reverse index from target objects to the policies last known to be possibly affected by events of the target objects
+type targetIndex struct {
+	mu      sync.RWMutex
+	entries map[targetIndexKey][]client.ObjectKey
+}
+
+type targetIndexKey struct {
+	kind       string
+	policyKind string
+	target     client.ObjectKey
+}
+
+func newTargetIndex() *targetIndex {
+	return &targetIndex{entries: make(map[targetIndexKey][]client.ObjectKey)}
+}
+
+func (i *targetIndex) get(key targetIndexKey) []client.ObjectKey {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.entries[key]
+}
+
+func (i *targetIndex) set(key targetIndexKey, policyKeys []client.ObjectKey) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(policyKeys) == 0 {
+		delete(i.entries, key)
+		return
+	}
+	i.entries[key] = policyKeys
+}
+
+func (i *targetIndex) delete(key targetIndexKey) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.entries, key)
+}
+
+func (i *targetIndex) len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return len(i.entries)
+}
+
+// EnqueueRequestsFromMapper returns an event handler that enqueues the requests mapped by an event mapper for a kind of policy.
+// Unlike handler.EnqueueRequestsFromMapFunc, it tells the mapper about delete events – including the ones whose final state is unknown
+// (cache.DeletedFinalStateUnknown tombstones) –, so mappers set WithLastKnownState can still map those to the right policies
+// after the back references were stripped from the deleted objects.
+// For mappers set WithCoalescingWindow, the requests are added to the workqueue after the window.
+// For mappers set WithMaxRequests, the requests of an event exceeding the cap are added to the workqueue after the overflow delay.
+func EnqueueRequestsFromMapper(mapper EventMapper, policyKind common.Referrer) handler.EventHandler {
+	e := &enqueueRequestsFromMapper{
+		EventHandler: handler.EnqueueRequestsFromMapFunc(MapFunc(mapper, policyKind)),
+		policyKind:   policyKind.Kind(),
+		logger:       logr.Discard(),
+	}
+	if m, ok := mapper.(contextualEventMapper); ok {
+		opts := m.options()
+		e.coalescingWindow = opts.coalescingWindow
+		e.maxRequests = opts.maxRequests
+		e.overflowDelay = opts.overflowDelay
+		e.logger = opts.logger
+	}
+	return e
+}
+
+type enqueueRequestsFromMapper struct {
+	handler.EventHandler
+	policyKind       string
+	logger           logr.Logger
+	coalescingWindow time.Duration
+	maxRequests      int
+	overflowDelay    time.Duration
+}
+
+func (e *enqueueRequestsFromMapper) Create(ctx context.Context, evt event.CreateEvent, q workqueue.RateLimitingInterface) {
+	q = e.queue(q)
+	e.EventHandler.Create(ctx, evt, q)
+	e.recordDeferred(ctx, evt.Object, q)
+}
+
+func (e *enqueueRequestsFromMapper) Update(ctx context.Context, evt event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	q = e.queue(q)
+	e.EventHandler.Update(ctx, evt, q)
+	e.recordDeferred(ctx, evt.ObjectNew, q)
+}
+
+func (e *enqueueRequestsFromMapper) Delete(ctx context.Context, evt event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	q = e.queue(q)
+	e.EventHandler.Delete(context.WithValue(ctx, deleteEventContextKey{}, true), evt, q)
+	e.recordDeferred(ctx, evt.Object, q)
+}
+
+func (e *enqueueRequestsFromMapper) Generic(ctx context.Context, evt event.GenericEvent, q workqueue.RateLimitingInterface) {
+	q = e.queue(q)
+	e.EventHandler.Generic(ctx, evt, q)
+	e.recordDeferred(ctx, evt.Object, q)
+}
+
+// queue returns the workqueue to add the requests of an event to, delaying them if a coalescing window is set
+// and deferring the ones exceeding the cap if a maximum number of requests is set
+func (e *enqueueRequestsFromMapper) queue(q workqueue.RateLimitingInterface) workqueue.RateLimitingInterface {
+	if e.coalescingWindow > 0 {
+		q = &coalescingQueue{RateLimitingInterface: q, window: e.coalescingWindow}
+	}
+	if e.maxRequests > 0 {
+		q = &cappingQueue{RateLimitingInterface: q, max: e.maxRequests, delay: e.coalescingWindow + e.overflowDelay}
+	}
+	return q
+}
+
+// recordDeferred logs and counts the requests of an event deferred for exceeding the cap, if any
+func (e *enqueueRequestsFromMapper) recordDeferred(ctx context.Context, obj client.Object, q workqueue.RateLimitingInterface) {
+	cq, ok := q.(*cappingQueue)
+	if !ok || cq.deferred == 0 || obj == nil {
+		return
+	}
+	logger := e.logger
+	if ctxLogger, err := logr.FromContext(ctx); err == nil {
+		logger = ctxLogger
+	}
+	kind := objectKindName(obj)
+	logger.Info(fmt.Sprintf("%s related event mapped to too many kuadrant policies", kind), "max", cq.max, "deferred", cq.deferred, "delay", cq.delay)
+	recordRequestsDeferred(kind, e.policyKind, cq.deferred)
+}
+
+// coalescingQueue adds items after a window, during which the workqueue coalesces repeated items into one
+type coalescingQueue struct {
+	workqueue.RateLimitingInterface
+	window time.Duration
+}
+
+func (q *coalescingQueue) Add(item interface{}) {
+	q.RateLimitingInterface.AddAfter(item, q.window)
+}
+
+// cappingQueue adds up to a maximum number of items right away and the exceeding ones after a delay.
+// It is meant to be used for the requests of a single event.
+type cappingQueue struct {
+	workqueue.RateLimitingInterface
+	max      int
+	delay    time.Duration
+	added    int
+	deferred int
+}
+
+func (q *cappingQueue) Add(item interface{}) {
+	if q.added < q.max {
+		q.added++
+		q.RateLimitingInterface.Add(item)
+		return
+	}
+	q.deferred++
+	q.RateLimitingInterface.AddAfter(item, q.delay)
+}
+
+type deleteEventContextKey struct{}
+
+// isDeleteEvent tells whether the event being mapped within the context is a delete event
+func isDeleteEvent(ctx context.Context) bool {
+	deleted, _ := ctx.Value(deleteEventContextKey{}).(bool)
+	return deleted
+}
+
+// requestsFromLastKnownState feeds the index with the requests mapped from the current state of an object and, if the object is being deleted,
+// adds to them the requests mapped from the last known state of the object
+func (i *targetIndex) requestsFromLastKnownState(ctx context.Context, key targetIndexKey, obj client.Object, requests []reconcile.Request) []reconcile.Request {
+	deleted := isDeleteEvent(ctx)
+	if !deleted && obj.GetDeletionTimestamp() == nil {
+		i.set(key, common.Map(requests, func(r reconcile.Request) client.ObjectKey { return r.NamespacedName }))
+		return requests
+	}
+
+	for _, policyKey := range i.get(key) {
+		request := reconcile.Request{NamespacedName: policyKey}
+		if !common.Contains(requests, request) {
+			requests = append(requests, request)
+		}
+	}
+
+	// objects with finalizers may still be updated until actually deleted
+	if deleted {
+		i.delete(key)
+	}
+
+	return requests
+}
@@ -0,0 +1,66 @@
+package mappers
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func TestEnqueueRequestsFromMapperWithLastKnownState(t *testing.T) {
+	ctx := context.Background()
+
+	gateway := &gatewayapiv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "gw-ns",
+			Name:        "gw-1",
+			Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-1"}]`},
+		},
+	}
+	strippedGateway := gateway.DeepCopy()
+	strippedGateway.SetAnnotations(nil)
+
+	mapper := NewGatewayEventMapper(WithLastKnownState())
+	eventHandler := EnqueueRequestsFromMapper(mapper, &common.PolicyKindStub{})
+
+	drain := func(q workqueue.RateLimitingInterface) []reconcile.Request {
+		requests := make([]reconcile.Request, 0)
+		for q.Len() > 0 {
+			item, _ := q.Get()
+			requests = append(requests, item.(reconcile.Request))
+			q.Done(item)
+		}
+		return requests
+	}
+
+	expected := reconcile.Request{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-1"}}
+
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+
+	eventHandler.Create(ctx, event.CreateEvent{Object: gateway}, q)
+	if requests := drain(q); len(requests) != 1 || requests[0] != expected {
+		t.Errorf("expected requests [%v] upon create event, but got %v", expected, requests)
+	}
+
+	eventHandler.Delete(ctx, event.DeleteEvent{Object: strippedGateway, DeleteStateUnknown: true}, q)
+	if requests := drain(q); len(requests) != 1 || requests[0] != expected {
+		t.Errorf("expected requests [%v] upon delete event of the stripped object, but got %v", expected, requests)
+	}
+
+	if l := mapper.(*eventMapper[*gatewayapiv1beta1.Gateway]).index.len(); l != 0 {
+		t.Errorf("expected the last known state of the deleted object to be forgotten, but the index has %d entries", l)
+	}
+
+	eventHandler.Delete(ctx, event.DeleteEvent{Object: strippedGateway}, q)
+	if requests := drain(q); len(requests) != 0 {
+		t.Errorf("expected no requests upon delete event of an unknown stripped object, but got %v", requests)
+	}
+}
@@ -0,0 +1,166 @@
+package mappers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+// TargetRefIndexField is the name of the field index of the policies by target reference
+const TargetRefIndexField = "spec.targetRef"
+
+// TargetRefFunc returns the target reference of a policy
+type TargetRefFunc func(policy client.Object) gatewayapiv1alpha2.PolicyTargetReference
+
+// IndexPolicyTargetRef registers in the field indexer (e.g. the manager's) an index of the policies of a kind by target reference,
+// required by the mappers created with NewTargetRefEventMapper
+func IndexPolicyTargetRef(ctx context.Context, indexer client.FieldIndexer, policy client.Object, targetRef TargetRefFunc) error {
+	return indexer.IndexField(ctx, policy, TargetRefIndexField, TargetRefIndexerFunc(targetRef))
+}
+
+// TargetRefIndexerFunc returns the function that extracts the value of the target reference index from a policy
+func TargetRefIndexerFunc(targetRef TargetRefFunc) client.IndexerFunc {
+	return func(policy client.Object) []string {
+		ref := targetRef(policy)
+		namespace := policy.GetNamespace()
+		if ref.Namespace != nil {
+			namespace = string(*ref.Namespace)
+		}
+		return []string{targetRefIndexValue(string(ref.Group), string(ref.Kind), namespace, string(ref.Name))}
+	}
+}
+
+// targetRefIndexValue returns the value of the target reference index in the <group>/<kind>/<namespace>/<name> format
+func targetRefIndexValue(group, kind, namespace, name string) string {
+	return strings.Join([]string{group, kind, namespace, name}, "/")
+}
+
+// NewTargetRefEventMapper returns an event mapper that maps events of any kind of object to the policies whose spec.targetRef points to the object,
+// without relying on back reference annotations.
+// The policies are looked up with the client (typically the manager's cache), that must be indexed with IndexPolicyTargetRef.
+// newPolicyList returns an empty list object of the kind of policy.
+// With WithTransitiveMapping, gateway events are also mapped to the policies targeting the HTTPRoutes attached to the gateway.
+func NewTargetRefEventMapper(k8sClient client.Client, newPolicyList func() client.ObjectList, o ...mapperOption) EventMapper {
+	return &targetRefEventMapper{opts: apply(o...), client: k8sClient, newPolicyList: newPolicyList}
+}
+
+var _ contextualEventMapper = &targetRefEventMapper{}
+
+type targetRefEventMapper struct {
+	opts          mapperOptions
+	client        client.Client
+	newPolicyList func() client.ObjectList
+}
+
+func (m *targetRefEventMapper) MapToPolicy(obj client.Object, policyKind common.Referrer) []reconcile.Request {
+	return m.mapToPolicy(context.Background(), obj, policyKind)
+}
+
+func (m *targetRefEventMapper) mapToPolicy(ctx context.Context, obj client.Object, policyKind common.Referrer) []reconcile.Request {
+	return m.mapToPolicies(ctx, obj, []common.Referrer{policyKind})[policyKind.Kind()]
+}
+
+func (m *targetRefEventMapper) mapToPolicies(ctx context.Context, obj client.Object, policyKinds []common.Referrer) map[string][]reconcile.Request {
+	logger := m.opts.logger
+	if ctxLogger, err := logr.FromContext(ctx); err == nil {
+		logger = ctxLogger
+	}
+	logger = logger.WithValues("object", client.ObjectKeyFromObject(obj))
+
+	kind := objectKindName(obj)
+
+	// the targets and the policies targeting them are looked up once for all the kinds of policies
+	targets := []client.Object{obj}
+	var routesErr error
+	if gateway, ok := obj.(*gatewayapiv1beta1.Gateway); ok && m.opts.routeReader != nil {
+		var routes []gatewayapiv1beta1.HTTPRoute
+		routes, routesErr = attachedHTTPRoutes(ctx, m.opts.routeReader, client.ObjectKeyFromObject(gateway))
+		for i := range routes {
+			targets = append(targets, &routes[i])
+		}
+	}
+	policyKeysByTarget := make([][]client.ObjectKey, len(targets))
+	policyErrs := make([]error, len(targets))
+	for i, target := range targets {
+		policyKeysByTarget[i], policyErrs[i] = m.policiesTargeting(ctx, target)
+	}
+
+	requests := make(map[string][]reconcile.Request, len(policyKinds))
+
+	for _, policyKind := range policyKinds {
+		recordEventMapped(kind, policyKind.Kind())
+
+		if routesErr != nil {
+			recordMappingError(kind, policyKind.Kind(), lookupErrorReason)
+			logger.Info("cannot map gateway related event to kuadrant policies targeting httproutes", "error", routesErr)
+		}
+
+		kindRequests := make([]reconcile.Request, 0)
+
+		for i, target := range targets {
+			if policyErrs[i] != nil {
+				recordMappingError(kind, policyKind.Kind(), lookupErrorReason)
+				logger.Info("cannot map event to kuadrant policy", "error", policyErrs[i])
+				continue
+			}
+			for _, policyKey := range policyKeysByTarget[i] {
+				request := reconcile.Request{NamespacedName: policyKey}
+				if common.Contains(kindRequests, request) {
+					continue
+				}
+				logger.V(1).Info("kuadrant policy possibly affected by the event found by targetRef", policyKind.Kind(), policyKey, "target", client.ObjectKeyFromObject(target))
+				kindRequests = append(kindRequests, request)
+			}
+		}
+
+		if len(kindRequests) == 0 {
+			logger.V(1).Info("no kuadrant policy possibly affected by the event found by targetRef")
+		}
+
+		requests[policyKind.Kind()] = recordRequestsProduced(kind, policyKind.Kind(), kindRequests)
+	}
+
+	return requests
+}
+
+func (m *targetRefEventMapper) options() mapperOptions {
+	return m.opts
+}
+
+// policiesTargeting returns the keys of the policies whose targetRef points to the target object
+func (m *targetRefEventMapper) policiesTargeting(ctx context.Context, target client.Object) ([]client.ObjectKey, error) {
+	gvk, err := m.client.GroupVersionKindFor(target)
+	if err != nil {
+		return nil, err
+	}
+
+	policyList := m.newPolicyList()
+	indexValue := targetRefIndexValue(gvk.Group, gvk.Kind, target.GetNamespace(), target.GetName())
+	if err := m.client.List(ctx, policyList, client.MatchingFields{TargetRefIndexField: indexValue}); err != nil {
+		return nil, err
+	}
+
+	policies, err := meta.ExtractList(policyList)
+	if err != nil {
+		return nil, err
+	}
+
+	policyKeys := make([]client.ObjectKey, 0, len(policies))
+	for _, policy := range policies {
+		policyObj, ok := policy.(client.Object)
+		if !ok {
+			return nil, fmt.Errorf("%T is not a client.Object", policy)
+		}
+		policyKeys = append(policyKeys, client.ObjectKeyFromObject(policyObj))
+	}
+	return policyKeys, nil
+}
@@ -0,0 +1,101 @@
+package mappers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func TestTargetRefEventMapper(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := gatewayapiv1beta1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	s.AddKnownTypes(schema.GroupVersion{Group: "kuadrant.io", Version: "v1"}, &common.PolicyStub{}, &common.PolicyStubList{})
+
+	gwNamespace := gatewayapiv1beta1.Namespace("gw-ns")
+	gwTargetNamespace := gatewayapiv1alpha2.Namespace("gw-ns")
+
+	gateway := &gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1"}}
+	route := &gatewayapiv1beta1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "route-1"},
+		Spec: gatewayapiv1beta1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayapiv1beta1.CommonRouteSpec{
+				ParentRefs: []gatewayapiv1beta1.ParentReference{{Name: "gw-1", Namespace: &gwNamespace}},
+			},
+		},
+	}
+
+	targetRef := func(policy client.Object) gatewayapiv1alpha2.PolicyTargetReference {
+		return policy.(*common.PolicyStub).Spec.TargetRef
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(s).WithIndex(&common.PolicyStub{}, TargetRefIndexField, TargetRefIndexerFunc(targetRef)).WithIndex(&gatewayapiv1beta1.HTTPRoute{}, HTTPRouteParentRefsIndexField, HTTPRouteParentRefsIndexerFunc).WithObjects(
+		gateway,
+		route,
+		&common.PolicyStub{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "policy-1"},
+			Spec:       common.PolicyStubSpec{TargetRef: gatewayapiv1alpha2.PolicyTargetReference{Group: gatewayapiv1beta1.GroupName, Kind: "Gateway", Name: "gw-1"}},
+		},
+		&common.PolicyStub{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "policy-2"},
+			Spec:       common.PolicyStubSpec{TargetRef: gatewayapiv1alpha2.PolicyTargetReference{Group: gatewayapiv1beta1.GroupName, Kind: "Gateway", Name: "gw-1", Namespace: &gwTargetNamespace}},
+		},
+		&common.PolicyStub{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "policy-3"},
+			Spec:       common.PolicyStubSpec{TargetRef: gatewayapiv1alpha2.PolicyTargetReference{Group: gatewayapiv1beta1.GroupName, Kind: "HTTPRoute", Name: "route-1"}},
+		},
+		&common.PolicyStub{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "policy-4"},
+			Spec:       common.PolicyStubSpec{TargetRef: gatewayapiv1alpha2.PolicyTargetReference{Group: gatewayapiv1beta1.GroupName, Kind: "HTTPRoute", Name: "route-2"}},
+		},
+	).Build()
+
+	newPolicyList := func() client.ObjectList { return &common.PolicyStubList{} }
+
+	t.Run("when policies target the object then map to the policies found by targetRef", func(t *testing.T) {
+		requests := NewTargetRefEventMapper(cl, newPolicyList).MapToPolicy(gateway, &common.PolicyKindStub{})
+		expected := []reconcile.Request{
+			{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-2"}},
+			{NamespacedName: client.ObjectKey{Namespace: "gw-ns", Name: "policy-1"}},
+		}
+		if !reflect.DeepEqual(requests, expected) {
+			t.Errorf("expected requests %v, but got %v", expected, requests)
+		}
+	})
+
+	t.Run("when the mapping is transitive then gateway events are also mapped to the policies targeting the attached routes", func(t *testing.T) {
+		requests := NewTargetRefEventMapper(cl, newPolicyList, WithTransitiveMapping(cl)).MapToPolicy(gateway, &common.PolicyKindStub{})
+		expected := []reconcile.Request{
+			{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-2"}},
+			{NamespacedName: client.ObjectKey{Namespace: "gw-ns", Name: "policy-1"}},
+			{NamespacedName: client.ObjectKey{Namespace: "app-ns", Name: "policy-3"}},
+		}
+		if !reflect.DeepEqual(requests, expected) {
+			t.Errorf("expected requests %v, but got %v", expected, requests)
+		}
+	})
+
+	t.Run("when no policy targets the object then map to no policy", func(t *testing.T) {
+		otherRoute := &gatewayapiv1beta1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{Namespace: "other-ns", Name: "route-2"}}
+		requests := MapFunc(NewTargetRefEventMapper(cl, newPolicyList), &common.PolicyKindStub{})(context.Background(), otherRoute)
+		if len(requests) != 0 {
+			t.Errorf("expected no requests, but got %v", requests)
+		}
+	})
+}
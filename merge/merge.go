@@ -0,0 +1,171 @@
+package merge
+
+import (
+	"fmt"
+	"sort"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+// Rules are the parts of the spec of a policy that the merge strategies combine, indexed by name (e.g. the name of the field of the spec)
+type Rules map[string]any
+
+// MergeablePolicy is a Policy whose spec is split into defaults and overrides, following the GEP-713 inherited policy model.
+// Defaults set lower in the hierarchy (closer to the rule) take precedence over the ones set above;
+// overrides set higher in the hierarchy (closer to the gateway) take precedence over anything set below.
+type MergeablePolicy interface {
+	common.Policy
+	// GetDefaults returns the default rules of the policy
+	GetDefaults() Rules
+	// GetOverrides returns the override rules of the policy
+	GetOverrides() Rules
+}
+
+// EffectivePolicy is the result of merging the policies attached along a path of the hierarchy
+type EffectivePolicy struct {
+	// Rules are the effective rules
+	Rules Rules
+	// Contributions tells which policy contributed each effective rule, indexed by the name of the rule
+	Contributions map[string]client.ObjectKey
+}
+
+// Contributors returns the keys of the policies that contributed to the effective policy, sorted
+func (e *EffectivePolicy) Contributors() []client.ObjectKey {
+	keys := make([]client.ObjectKey, 0)
+	for _, key := range e.Contributions {
+		if !common.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	return keys
+}
+
+func (e *EffectivePolicy) set(name string, value any, policy MergeablePolicy) {
+	e.Rules[name] = value
+	e.Contributions[name] = client.ObjectKeyFromObject(policy)
+}
+
+func newEffectivePolicy() *EffectivePolicy {
+	return &EffectivePolicy{Rules: make(Rules), Contributions: make(map[string]client.ObjectKey)}
+}
+
+// Strategy merges the policies attached along a path of the hierarchy, ordered from the most general (gateway) to the most specific (rule)
+type Strategy interface {
+	Merge(path []MergeablePolicy) *EffectivePolicy
+}
+
+// StrategyFunc adapts a function to a Strategy
+type StrategyFunc func(path []MergeablePolicy) *EffectivePolicy
+
+func (f StrategyFunc) Merge(path []MergeablePolicy) *EffectivePolicy {
+	return f(path)
+}
+
+// AtomicDefaults is the strategy where the defaults of the most specific policy with defaults win as a whole. Overrides are ignored.
+var AtomicDefaults Strategy = StrategyFunc(atomicDefaults)
+
+// AtomicOverrides is the strategy where the overrides of the most general policy with overrides win as a whole.
+// If no policy sets overrides, the defaults of the most specific policy with defaults win as a whole.
+var AtomicOverrides Strategy = StrategyFunc(atomicOverrides)
+
+// FieldLevelMerge is the strategy where each rule is merged separately:
+// the override of the most general policy that sets the rule wins, otherwise the default of the most specific policy that sets the rule.
+var FieldLevelMerge Strategy = StrategyFunc(fieldLevelMerge)
+
+func atomicDefaults(path []MergeablePolicy) *EffectivePolicy {
+	effective := newEffectivePolicy()
+	for i := len(path) - 1; i >= 0; i-- {
+		if defaults := path[i].GetDefaults(); len(defaults) > 0 {
+			for name, value := range defaults {
+				effective.set(name, value, path[i])
+			}
+			break
+		}
+	}
+	return effective
+}
+
+func atomicOverrides(path []MergeablePolicy) *EffectivePolicy {
+	for _, policy := range path {
+		if overrides := policy.GetOverrides(); len(overrides) > 0 {
+			effective := newEffectivePolicy()
+			for name, value := range overrides {
+				effective.set(name, value, policy)
+			}
+			return effective
+		}
+	}
+	return atomicDefaults(path)
+}
+
+func fieldLevelMerge(path []MergeablePolicy) *EffectivePolicy {
+	effective := newEffectivePolicy()
+	for _, policy := range path {
+		for name, value := range policy.GetDefaults() {
+			effective.set(name, value, policy)
+		}
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		for name, value := range path[i].GetOverrides() {
+			effective.set(name, value, path[i])
+		}
+	}
+	return effective
+}
+
+// Engine computes effective policies with the merge strategy registered for each kind of policy
+type Engine struct {
+	strategies      map[string]Strategy
+	defaultStrategy Strategy
+}
+
+// NewEngine returns a merge engine that uses the default strategy for the kinds of policy without a registered strategy
+func NewEngine(defaultStrategy Strategy) *Engine {
+	return &Engine{strategies: make(map[string]Strategy), defaultStrategy: defaultStrategy}
+}
+
+// Register sets the merge strategy of a kind of policy
+func (e *Engine) Register(policyKind common.Referrer, strategy Strategy) {
+	e.strategies[policyKind.Kind()] = strategy
+}
+
+// Strategy returns the merge strategy of a kind of policy
+func (e *Engine) Strategy(policyKind common.Referrer) Strategy {
+	if strategy, ok := e.strategies[policyKind.Kind()]; ok {
+		return strategy
+	}
+	return e.defaultStrategy
+}
+
+// EffectivePolicy merges the policies of a kind attached along a path of the hierarchy, ordered from the most general to the most specific.
+// All the policies must be of the same kind.
+func (e *Engine) EffectivePolicy(path []MergeablePolicy) (*EffectivePolicy, error) {
+	if len(path) == 0 {
+		return newEffectivePolicy(), nil
+	}
+	kind := path[0].Kind()
+	for _, policy := range path[1:] {
+		if policy.Kind() != kind {
+			return nil, fmt.Errorf("cannot merge policies of different kinds: %s and %s", kind, policy.Kind())
+		}
+	}
+	strategy := e.Strategy(path[0])
+	if strategy == nil {
+		return nil, fmt.Errorf("no merge strategy for policy kind %s", kind)
+	}
+	return strategy.Merge(path), nil
+}
+
+// MergeablePolicies returns the mergeable policies of a kind, in the same order, e.g. to merge the policies returned by Topology.PoliciesOnPath
+func MergeablePolicies(policies []common.Policy, policyKind common.Referrer) []MergeablePolicy {
+	mergeable := make([]MergeablePolicy, 0, len(policies))
+	for _, policy := range policies {
+		if p, ok := policy.(MergeablePolicy); ok && p.Kind() == policyKind.Kind() {
+			mergeable = append(mergeable, p)
+		}
+	}
+	return mergeable
+}
@@ -0,0 +1,144 @@
+package merge
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+type mergeablePolicyStub struct {
+	common.PolicyStub
+	defaults  Rules
+	overrides Rules
+}
+
+func (p *mergeablePolicyStub) GetDefaults() Rules {
+	return p.defaults
+}
+
+func (p *mergeablePolicyStub) GetOverrides() Rules {
+	return p.overrides
+}
+
+type otherKindPolicyStub struct {
+	mergeablePolicyStub
+}
+
+func (p *otherKindPolicyStub) Kind() string {
+	return "OtherTestPolicy"
+}
+
+func newPolicy(name string, defaults, overrides Rules) *mergeablePolicyStub {
+	return &mergeablePolicyStub{
+		PolicyStub: common.PolicyStub{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name}},
+		defaults:   defaults,
+		overrides:  overrides,
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	gwPolicy := newPolicy("gw-policy", Rules{"limit": 100, "window": "1m"}, Rules{"auth": "oidc"})
+	routePolicy := newPolicy("route-policy", Rules{"limit": 10}, nil)
+	rulePolicy := newPolicy("rule-policy", nil, Rules{"auth": "apikey", "limit": 5})
+
+	path := []MergeablePolicy{gwPolicy, routePolicy, rulePolicy}
+
+	key := func(name string) client.ObjectKey { return client.ObjectKey{Namespace: "ns", Name: name} }
+
+	testCases := []struct {
+		name          string
+		strategy      Strategy
+		rules         Rules
+		contributions map[string]client.ObjectKey
+	}{
+		{
+			name:          "atomic defaults: the defaults of the most specific policy with defaults win as a whole",
+			strategy:      AtomicDefaults,
+			rules:         Rules{"limit": 10},
+			contributions: map[string]client.ObjectKey{"limit": key("route-policy")},
+		},
+		{
+			name:          "atomic overrides: the overrides of the most general policy with overrides win as a whole",
+			strategy:      AtomicOverrides,
+			rules:         Rules{"auth": "oidc"},
+			contributions: map[string]client.ObjectKey{"auth": key("gw-policy")},
+		},
+		{
+			name:     "field-level merge: each rule is merged separately",
+			strategy: FieldLevelMerge,
+			rules:    Rules{"limit": 5, "window": "1m", "auth": "oidc"},
+			contributions: map[string]client.ObjectKey{
+				"limit":  key("rule-policy"),
+				"window": key("gw-policy"),
+				"auth":   key("gw-policy"),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			effective := tc.strategy.Merge(path)
+			if !reflect.DeepEqual(effective.Rules, tc.rules) {
+				t.Errorf("expected rules %v, but got %v", tc.rules, effective.Rules)
+			}
+			if !reflect.DeepEqual(effective.Contributions, tc.contributions) {
+				t.Errorf("expected contributions %v, but got %v", tc.contributions, effective.Contributions)
+			}
+		})
+	}
+
+	t.Run("atomic overrides: when no policy sets overrides then fall back to atomic defaults", func(t *testing.T) {
+		effective := AtomicOverrides.Merge([]MergeablePolicy{routePolicy})
+		if !reflect.DeepEqual(effective.Rules, Rules{"limit": 10}) {
+			t.Errorf("unexpected rules %v", effective.Rules)
+		}
+	})
+}
+
+func TestEngine(t *testing.T) {
+	engine := NewEngine(AtomicDefaults)
+	engine.Register(&common.PolicyKindStub{}, FieldLevelMerge)
+
+	gwPolicy := newPolicy("gw-policy", Rules{"limit": 100, "window": "1m"}, nil)
+	routePolicy := newPolicy("route-policy", Rules{"limit": 10}, nil)
+
+	t.Run("when the kind of policy has a registered strategy then use it", func(t *testing.T) {
+		effective, err := engine.EffectivePolicy([]MergeablePolicy{gwPolicy, routePolicy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := (Rules{"limit": 10, "window": "1m"}); !reflect.DeepEqual(effective.Rules, expected) {
+			t.Errorf("expected rules %v, but got %v", expected, effective.Rules)
+		}
+		expected := []client.ObjectKey{{Namespace: "ns", Name: "gw-policy"}, {Namespace: "ns", Name: "route-policy"}}
+		if contributors := effective.Contributors(); !reflect.DeepEqual(contributors, expected) {
+			t.Errorf("expected contributors %v, but got %v", expected, contributors)
+		}
+	})
+
+	t.Run("when the kind of policy has no registered strategy then use the default one", func(t *testing.T) {
+		other := &otherKindPolicyStub{*newPolicy("other-policy", Rules{"limit": 1}, nil)}
+		if strategy := engine.Strategy(other); reflect.ValueOf(strategy).Pointer() != reflect.ValueOf(AtomicDefaults).Pointer() {
+			t.Error("expected the default strategy")
+		}
+	})
+
+	t.Run("when the policies are of different kinds then fail", func(t *testing.T) {
+		other := &otherKindPolicyStub{*newPolicy("other-policy", Rules{"limit": 1}, nil)}
+		if _, err := engine.EffectivePolicy([]MergeablePolicy{gwPolicy, other}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("when filtering the mergeable policies of a kind then keep the order", func(t *testing.T) {
+		other := &otherKindPolicyStub{*newPolicy("other-policy", Rules{"limit": 1}, nil)}
+		policies := MergeablePolicies([]common.Policy{gwPolicy, other, routePolicy}, &common.PolicyKindStub{})
+		if len(policies) != 2 || policies[0] != MergeablePolicy(gwPolicy) || policies[1] != MergeablePolicy(routePolicy) {
+			t.Errorf("unexpected mergeable policies %v", policies)
+		}
+	})
+}
@@ -0,0 +1,226 @@
+package reconcilers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+// Limits of the status conditions set by the APIs
+const (
+	// MaxGatewayConditions is the maximum number of conditions in the status of a Gateway (+kubebuilder:validation:MaxItems of GatewayStatus.Conditions)
+	MaxGatewayConditions = 8
+	// MaxConditionMessageLength is the maximum length of the message of a condition (+kubebuilder:validation:MaxLength of metav1.Condition.Message)
+	MaxConditionMessageLength = 32768
+)
+
+// ErrConditionLimitExceeded is wrapped by the errors returned when setting a condition in the status of an object would exceed
+// the maximum number of conditions or the maximum length of the message of a condition, so the API server would reject the status
+var ErrConditionLimitExceeded = errors.New("status condition limit exceeded")
+
+// checkConditionLimits returns an error wrapping ErrConditionLimitExceeded if the status conditions of an object exceed the limits of the APIs
+func checkConditionLimits(obj client.Object, conditions []metav1.Condition) error {
+	if _, ok := obj.(*gatewayapiv1beta1.Gateway); ok && len(conditions) > MaxGatewayConditions {
+		return fmt.Errorf("%w: gateway %s would have %d status conditions, more than the maximum of %d", ErrConditionLimitExceeded, client.ObjectKeyFromObject(obj), len(conditions), MaxGatewayConditions)
+	}
+	for _, condition := range conditions {
+		if len(condition.Message) > MaxConditionMessageLength {
+			return fmt.Errorf("%w: the message of the %s condition of %s would be %d characters long, more than the maximum of %d", ErrConditionLimitExceeded, condition.Type, client.ObjectKeyFromObject(obj), len(condition.Message), MaxConditionMessageLength)
+		}
+	}
+	return nil
+}
+
+// PolicyAffectedConditionType returns the type of the condition that tells a network object is affected by policies of a kind, i.e. <Kind>Affected
+func PolicyAffectedConditionType(policyKind common.Referrer) string {
+	return policyKind.Kind() + "Affected"
+}
+
+// policyAffectedCondition returns the <Kind>Affected condition of a network object affected by the given policies
+func policyAffectedCondition(policyKind common.Referrer, policyKeys []client.ObjectKey, generation int64) metav1.Condition {
+	return metav1.Condition{
+		Type:               PolicyAffectedConditionType(policyKind),
+		Status:             metav1.ConditionTrue,
+		Reason:             string(gatewayapiv1alpha2.PolicyReasonAccepted),
+		Message:            fmt.Sprintf("Object affected by %s %s", policyKind.Kind(), strings.Join(common.Map(policyKeys, client.ObjectKey.String), ", ")),
+		ObservedGeneration: generation,
+	}
+}
+
+// ReconcileGatewayPolicyAffectedConditions sets or clears the <Kind>Affected condition in the status of the gateways in the diffs,
+// depending on whether any policy of the kind still applies to the gateway. The policies that apply to a gateway are the ones
+// in its back references (read from the stores of the reconciler, if set) plus the policy itself if it targets the gateway; it should therefore be called after
+// ReconcileGatewayPolicyReferences, with the same gateway diff object.
+// The statuses are patched with optimistic locking; on conflict, the gateway is fetched again and the patch retried.
+func (r *TargetRefReconciler) ReconcileGatewayPolicyAffectedConditions(ctx context.Context, policy client.Object, gwDiffObj *GatewayDiffs) error {
+	logger, _ := logr.FromContext(ctx)
+
+	policyKind, ok := policy.(common.Referrer)
+	if !ok {
+		return fmt.Errorf("policy %s is not a referrer", policy.GetObjectKind().GroupVersionKind())
+	}
+	policyKey := client.ObjectKeyFromObject(policy)
+
+	backRefs := r.lookupOptions().backReferences(ctx)
+
+	gateways := make([]GatewayWrapper, 0)
+	for _, gws := range [][]GatewayWrapper{gwDiffObj.GatewaysMissingPolicyRef, gwDiffObj.GatewaysWithValidPolicyRef} {
+		gateways = append(gateways, gws...)
+	}
+	targeted := len(gateways)
+	gateways = append(gateways, gwDiffObj.GatewaysWithInvalidPolicyRef...)
+
+	for i, gw := range gateways {
+		targetedGw := i < targeted
+		gateway := gw.Gateway
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			original := gateway.DeepCopy()
+			changed, err := setGatewayPolicyAffectedCondition(gateway, policyKind, backRefs(gateway, policyKind), policyKey, targetedGw)
+			if err != nil || !changed {
+				return err
+			}
+			err = r.Client.Status().Patch(ctx, gateway, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+			logger.V(1).Info("ReconcileGatewayPolicyAffectedConditions: patch gateway status", "gateway", gw.Key(), "err", err)
+			if apierrors.IsConflict(err) {
+				if err := refreshObject(ctx, r.Client, gateway); err != nil {
+					return err
+				}
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setGatewayPolicyAffectedCondition sets or clears the <Kind>Affected condition in the status of a gateway,
+// depending on whether any policy of the kind applies to the gateway, given the back references of the gateway. Returns whether the status changed.
+// Fails with an error wrapping ErrConditionLimitExceeded, leaving the gateway untouched, if the conditions would exceed the limits of the Gateway API.
+func setGatewayPolicyAffectedCondition(gateway *gatewayapiv1beta1.Gateway, policyKind common.Referrer, backRefs []client.ObjectKey, policyKey client.ObjectKey, targeted bool) (bool, error) {
+	policyKeys := common.SliceCopy(backRefs)
+	if targeted {
+		if !common.Contains(policyKeys, policyKey) {
+			policyKeys = append(policyKeys, policyKey)
+		}
+	} else {
+		if idx := common.IndexOf(policyKeys, policyKey); idx >= 0 {
+			policyKeys = append(policyKeys[:idx], policyKeys[idx+1:]...)
+		}
+	}
+
+	conditions := common.SliceCopy(gateway.Status.Conditions)
+	if len(policyKeys) > 0 {
+		meta.SetStatusCondition(&conditions, policyAffectedCondition(policyKind, policyKeys, gateway.GetGeneration()))
+	} else {
+		meta.RemoveStatusCondition(&conditions, PolicyAffectedConditionType(policyKind))
+	}
+	if reflect.DeepEqual(conditions, gateway.Status.Conditions) {
+		return false, nil
+	}
+	if err := checkConditionLimits(gateway, conditions); err != nil {
+		return false, err
+	}
+	gateway.Status.Conditions = conditions
+	return true, nil
+}
+
+// ReconcileHTTPRoutePolicyAffectedConditions sets or clears the <Kind>Affected condition in the parent statuses of an httproute owned by the controller,
+// one per parent gateway of the route: set if the gateway is targeted by the policy according to the gateway diffs, cleared otherwise.
+// Parent statuses of the controller are added if missing and removed when left without conditions.
+// The statuses are patched with optimistic locking, so entries written concurrently by other controllers are not lost; on conflict, the route is fetched again and the patch retried.
+func (r *TargetRefReconciler) ReconcileHTTPRoutePolicyAffectedConditions(ctx context.Context, policy client.Object, route *gatewayapiv1beta1.HTTPRoute, gwDiffObj *GatewayDiffs, controllerName gatewayapiv1beta1.GatewayController) error {
+	logger, _ := logr.FromContext(ctx)
+
+	if route == nil {
+		return nil
+	}
+
+	policyKind, ok := policy.(common.Referrer)
+	if !ok {
+		return fmt.Errorf("policy %s is not a referrer", policy.GetObjectKind().GroupVersionKind())
+	}
+	policyKey := client.ObjectKeyFromObject(policy)
+
+	targetedGwKeys := make([]client.ObjectKey, 0)
+	for _, gws := range [][]GatewayWrapper{gwDiffObj.GatewaysMissingPolicyRef, gwDiffObj.GatewaysWithValidPolicyRef} {
+		for _, gw := range gws {
+			targetedGwKeys = append(targetedGwKeys, gw.Key())
+		}
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		original := route.DeepCopy()
+		if !setHTTPRoutePolicyAffectedConditions(route, policyKind, policyKey, targetedGwKeys, controllerName) {
+			return nil
+		}
+		err := r.Client.Status().Patch(ctx, route, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+		logger.V(1).Info("ReconcileHTTPRoutePolicyAffectedConditions: patch httproute status", "httproute", client.ObjectKeyFromObject(route), "err", err)
+		if apierrors.IsConflict(err) {
+			if err := refreshObject(ctx, r.Client, route); err != nil {
+				return err
+			}
+		}
+		return err
+	})
+}
+
+// setHTTPRoutePolicyAffectedConditions sets or clears the <Kind>Affected condition in the parent statuses of an httproute owned by the controller,
+// depending on whether the parent gateways are targeted by the policy. Returns whether the status changed.
+func setHTTPRoutePolicyAffectedConditions(route *gatewayapiv1beta1.HTTPRoute, policyKind common.Referrer, policyKey client.ObjectKey, targetedGwKeys []client.ObjectKey, controllerName gatewayapiv1beta1.GatewayController) bool {
+	parents := make([]gatewayapiv1beta1.RouteParentStatus, 0, len(route.Status.Parents))
+
+	// parent statuses of other controllers are kept as is
+	for _, parentStatus := range route.Status.Parents {
+		if parentStatus.ControllerName != controllerName {
+			parents = append(parents, parentStatus)
+		}
+	}
+
+	for _, parentRef := range route.Spec.ParentRefs {
+		gwKey := client.ObjectKey{Name: string(parentRef.Name), Namespace: route.Namespace}
+		if parentRef.Namespace != nil {
+			gwKey.Namespace = string(*parentRef.Namespace)
+		}
+
+		var parentStatus gatewayapiv1beta1.RouteParentStatus
+		if existing, found := common.Find(route.Status.Parents, func(p gatewayapiv1beta1.RouteParentStatus) bool {
+			return p.ControllerName == controllerName && reflect.DeepEqual(p.ParentRef, parentRef)
+		}); found {
+			parentStatus = *existing.DeepCopy()
+		} else {
+			parentStatus = gatewayapiv1beta1.RouteParentStatus{ParentRef: parentRef, ControllerName: controllerName}
+		}
+
+		if common.Contains(targetedGwKeys, gwKey) {
+			meta.SetStatusCondition(&parentStatus.Conditions, policyAffectedCondition(policyKind, []client.ObjectKey{policyKey}, route.GetGeneration()))
+		} else {
+			meta.RemoveStatusCondition(&parentStatus.Conditions, PolicyAffectedConditionType(policyKind))
+		}
+
+		if len(parentStatus.Conditions) > 0 {
+			parents = append(parents, parentStatus)
+		}
+	}
+
+	if reflect.DeepEqual(parents, route.Status.Parents) {
+		return false
+	}
+	route.Status.Parents = parents
+	return true
+}
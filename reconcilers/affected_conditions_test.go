@@ -0,0 +1,314 @@
+package reconcilers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func TestReconcileGatewayPolicyAffectedConditions(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), log.Log)
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := gatewayapiv1beta1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	policyKind := &common.PolicyKindStub{}
+	conditionType := PolicyAffectedConditionType(policyKind)
+	policy := &common.PolicyStub{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "policy-1"}}
+
+	gw1 := &gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1"}}
+	gw2 := &gatewayapiv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-2"},
+		Status: gatewayapiv1beta1.GatewayStatus{
+			Conditions: []metav1.Condition{{Type: conditionType, Status: metav1.ConditionTrue, Reason: "Accepted"}},
+		},
+	}
+	gw3 := &gatewayapiv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "gw-ns",
+			Name:        "gw-3",
+			Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"gw-ns","Name":"policy-2"}]`},
+		},
+	}
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(gw1, gw2, gw3).WithStatusSubresource(gw1, gw2, gw3).Build()
+
+	fetchGateway := func(name string) *gatewayapiv1beta1.Gateway {
+		gw := &gatewayapiv1beta1.Gateway{}
+		if err := cl.Get(ctx, client.ObjectKey{Namespace: "gw-ns", Name: name}, gw); err != nil {
+			t.Fatal(err)
+		}
+		return gw
+	}
+
+	r := &TargetRefReconciler{Client: cl}
+	gwDiffObj := &GatewayDiffs{
+		GatewaysMissingPolicyRef:     []GatewayWrapper{{fetchGateway("gw-1"), policyKind}},
+		GatewaysWithInvalidPolicyRef: []GatewayWrapper{{fetchGateway("gw-2"), policyKind}, {fetchGateway("gw-3"), policyKind}},
+	}
+
+	if err := r.ReconcileGatewayPolicyAffectedConditions(ctx, policy, gwDiffObj); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("when the gateway is targeted by the policy then set the condition", func(t *testing.T) {
+		condition := meta.FindStatusCondition(fetchGateway("gw-1").Status.Conditions, conditionType)
+		if condition == nil || condition.Status != metav1.ConditionTrue || condition.Message != "Object affected by TestPolicy gw-ns/policy-1" {
+			t.Errorf("unexpected condition: %v", condition)
+		}
+	})
+
+	t.Run("when the gateway is no longer targeted by any policy then clear the condition", func(t *testing.T) {
+		if condition := meta.FindStatusCondition(fetchGateway("gw-2").Status.Conditions, conditionType); condition != nil {
+			t.Errorf("expected condition to be removed, but got %v", condition)
+		}
+	})
+
+	t.Run("when the gateway is still targeted by other policies then keep the condition", func(t *testing.T) {
+		condition := meta.FindStatusCondition(fetchGateway("gw-3").Status.Conditions, conditionType)
+		if condition == nil || condition.Message != "Object affected by TestPolicy gw-ns/policy-2" {
+			t.Errorf("unexpected condition: %v", condition)
+		}
+	})
+
+	t.Run("when the gateway status changed concurrently then retry without losing the other conditions", func(t *testing.T) {
+		gw := &gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1"}}
+		cl := fake.NewClientBuilder().WithScheme(s).WithObjects(gw).WithStatusSubresource(gw).WithInterceptorFuncs(optimisticLockStatusPatch()).Build()
+		r := &TargetRefReconciler{Client: cl}
+
+		stale := &gatewayapiv1beta1.Gateway{}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(gw), stale); err != nil {
+			t.Fatal(err)
+		}
+		concurrent := stale.DeepCopy()
+		meta.SetStatusCondition(&concurrent.Status.Conditions, metav1.Condition{Type: "Programmed", Status: metav1.ConditionTrue, Reason: "Programmed"})
+		if err := cl.Status().Update(ctx, concurrent); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.ReconcileGatewayPolicyAffectedConditions(ctx, policy, &GatewayDiffs{GatewaysMissingPolicyRef: []GatewayWrapper{{stale, policyKind}}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(gw), gw); err != nil {
+			t.Fatal(err)
+		}
+		if meta.FindStatusCondition(gw.Status.Conditions, "Programmed") == nil {
+			t.Error("expected the concurrently set condition to be kept")
+		}
+		if meta.FindStatusCondition(gw.Status.Conditions, conditionType) == nil {
+			t.Error("expected the affected condition to be set")
+		}
+	})
+
+	t.Run("when the gateway conditions are at the limit then fail without patching the status", func(t *testing.T) {
+		newGateway := func(name string, conditions int) *gatewayapiv1beta1.Gateway {
+			gw := &gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: name}}
+			for i := 0; i < conditions; i++ {
+				gw.Status.Conditions = append(gw.Status.Conditions, metav1.Condition{Type: fmt.Sprintf("Condition%d", i), Status: metav1.ConditionTrue, Reason: "Test"})
+			}
+			return gw
+		}
+		belowLimit, atLimit := newGateway("gw-1", MaxGatewayConditions-1), newGateway("gw-2", MaxGatewayConditions)
+		cl := fake.NewClientBuilder().WithScheme(s).WithObjects(belowLimit, atLimit).WithStatusSubresource(belowLimit, atLimit).Build()
+		r := &TargetRefReconciler{Client: cl}
+
+		fetchGateway := func(name string) *gatewayapiv1beta1.Gateway {
+			gw := &gatewayapiv1beta1.Gateway{}
+			if err := cl.Get(ctx, client.ObjectKey{Namespace: "gw-ns", Name: name}, gw); err != nil {
+				t.Fatal(err)
+			}
+			return gw
+		}
+
+		if err := r.ReconcileGatewayPolicyAffectedConditions(ctx, policy, &GatewayDiffs{GatewaysMissingPolicyRef: []GatewayWrapper{{fetchGateway("gw-1"), policyKind}}}); err != nil {
+			t.Fatal(err)
+		}
+		if conditions := fetchGateway("gw-1").Status.Conditions; len(conditions) != MaxGatewayConditions || meta.FindStatusCondition(conditions, conditionType) == nil {
+			t.Errorf("expected the affected condition to be set as the last allowed condition, but got %v", conditions)
+		}
+
+		err := r.ReconcileGatewayPolicyAffectedConditions(ctx, policy, &GatewayDiffs{GatewaysMissingPolicyRef: []GatewayWrapper{{fetchGateway("gw-2"), policyKind}}})
+		if !errors.Is(err, ErrConditionLimitExceeded) {
+			t.Errorf("expected a condition limit exceeded error, but got %v", err)
+		}
+		if conditions := fetchGateway("gw-2").Status.Conditions; len(conditions) != MaxGatewayConditions || meta.FindStatusCondition(conditions, conditionType) != nil {
+			t.Errorf("expected the status not to be patched, but got %v", conditions)
+		}
+	})
+
+	t.Run("when the condition message would be longer than the limit then fail", func(t *testing.T) {
+		gw := &gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1"}}
+		backRefs := make([]client.ObjectKey, 0)
+		for len(policyAffectedCondition(policyKind, backRefs, 0).Message) <= MaxConditionMessageLength {
+			backRefs = append(backRefs, client.ObjectKey{Namespace: "gw-ns", Name: fmt.Sprintf("policy-%05d", len(backRefs))})
+		}
+
+		if _, err := setGatewayPolicyAffectedCondition(gw, policyKind, backRefs[:len(backRefs)-1], client.ObjectKeyFromObject(policy), false); err != nil {
+			t.Errorf("expected a message at the limit to be accepted, but got %v", err)
+		}
+		changed, err := setGatewayPolicyAffectedCondition(gw, policyKind, backRefs, client.ObjectKeyFromObject(policy), false)
+		if changed || !errors.Is(err, ErrConditionLimitExceeded) {
+			t.Errorf("expected a condition limit exceeded error, but got %v (changed: %v)", err, changed)
+		}
+	})
+}
+
+// optimisticLockStatusPatch returns interceptor functions that fail the status patches of objects whose resourceVersion is outdated,
+// as the API server does for patches with optimistic locking, which the fake client does not enforce
+func optimisticLockStatusPatch() interceptor.Funcs {
+	return interceptor.Funcs{
+		SubResourcePatch: func(ctx context.Context, cl client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+			current := obj.DeepCopyObject().(client.Object)
+			if err := cl.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+				return err
+			}
+			if current.GetResourceVersion() != obj.GetResourceVersion() {
+				return apierrors.NewConflict(schema.GroupResource{}, obj.GetName(), errors.New("object was modified"))
+			}
+			return cl.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+		},
+	}
+}
+
+func TestReconcileHTTPRoutePolicyAffectedConditions(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), log.Log)
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := gatewayapiv1beta1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	policyKind := &common.PolicyKindStub{}
+	conditionType := PolicyAffectedConditionType(policyKind)
+	policy := &common.PolicyStub{ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "policy-1"}}
+	controllerName := gatewayapiv1beta1.GatewayController("kuadrant.io/policy-controller")
+	otherControllerName := gatewayapiv1beta1.GatewayController("example.com/gateway-controller")
+
+	gwNs := gatewayapiv1beta1.Namespace("gw-ns")
+	parentRef1 := gatewayapiv1beta1.ParentReference{Namespace: &gwNs, Name: "gw-1"}
+	parentRef2 := gatewayapiv1beta1.ParentReference{Namespace: &gwNs, Name: "gw-2"}
+
+	route := &gatewayapiv1beta1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "route-1"},
+		Spec: gatewayapiv1beta1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayapiv1beta1.CommonRouteSpec{ParentRefs: []gatewayapiv1beta1.ParentReference{parentRef1, parentRef2}},
+		},
+		Status: gatewayapiv1beta1.HTTPRouteStatus{
+			RouteStatus: gatewayapiv1beta1.RouteStatus{
+				Parents: []gatewayapiv1beta1.RouteParentStatus{
+					{ParentRef: parentRef1, ControllerName: otherControllerName, Conditions: []metav1.Condition{{Type: "Accepted", Status: metav1.ConditionTrue, Reason: "Accepted"}}},
+					{ParentRef: parentRef2, ControllerName: controllerName, Conditions: []metav1.Condition{{Type: conditionType, Status: metav1.ConditionTrue, Reason: "Accepted"}}},
+				},
+			},
+		},
+	}
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(route).WithStatusSubresource(route).Build()
+
+	fetchRoute := func() *gatewayapiv1beta1.HTTPRoute {
+		r := &gatewayapiv1beta1.HTTPRoute{}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(route), r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	r := &TargetRefReconciler{Client: cl}
+	gwDiffObj := &GatewayDiffs{
+		GatewaysMissingPolicyRef:     []GatewayWrapper{{&gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1"}}, policyKind}},
+		GatewaysWithInvalidPolicyRef: []GatewayWrapper{{&gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-2"}}, policyKind}},
+	}
+
+	if err := r.ReconcileHTTPRoutePolicyAffectedConditions(ctx, policy, fetchRoute(), gwDiffObj, controllerName); err != nil {
+		t.Fatal(err)
+	}
+	parents := fetchRoute().Status.Parents
+
+	t.Run("when the parent gateway is targeted then set the condition in the parent status of the controller", func(t *testing.T) {
+		parentStatus, found := common.Find(parents, func(p gatewayapiv1beta1.RouteParentStatus) bool {
+			return p.ControllerName == controllerName && p.ParentRef.Name == "gw-1"
+		})
+		if !found {
+			t.Fatalf("expected parent status of the controller for gw-1, but got %v", parents)
+		}
+		if condition := meta.FindStatusCondition(parentStatus.Conditions, conditionType); condition == nil || condition.Status != metav1.ConditionTrue {
+			t.Errorf("unexpected condition: %v", condition)
+		}
+	})
+
+	t.Run("when the parent gateway is no longer targeted then remove the empty parent status of the controller", func(t *testing.T) {
+		if _, found := common.Find(parents, func(p gatewayapiv1beta1.RouteParentStatus) bool {
+			return p.ControllerName == controllerName && p.ParentRef.Name == "gw-2"
+		}); found {
+			t.Errorf("expected parent status of the controller for gw-2 to be removed, but got %v", parents)
+		}
+	})
+
+	t.Run("when the parent status belongs to another controller then keep it untouched", func(t *testing.T) {
+		parentStatus, found := common.Find(parents, func(p gatewayapiv1beta1.RouteParentStatus) bool {
+			return p.ControllerName == otherControllerName
+		})
+		if !found || len(parentStatus.Conditions) != 1 || meta.FindStatusCondition(parentStatus.Conditions, conditionType) != nil {
+			t.Errorf("unexpected parent status of other controller: %v", parentStatus)
+		}
+	})
+
+	t.Run("when another controller wrote its parent status concurrently then retry without losing it", func(t *testing.T) {
+		cl := fake.NewClientBuilder().WithScheme(s).WithObjects(route.DeepCopy()).WithStatusSubresource(route).WithInterceptorFuncs(optimisticLockStatusPatch()).Build()
+		r := &TargetRefReconciler{Client: cl}
+
+		stale := &gatewayapiv1beta1.HTTPRoute{}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(route), stale); err != nil {
+			t.Fatal(err)
+		}
+		concurrent := stale.DeepCopy()
+		concurrent.Status.Parents = append(concurrent.Status.Parents, gatewayapiv1beta1.RouteParentStatus{
+			ParentRef:      parentRef2,
+			ControllerName: otherControllerName,
+			Conditions:     []metav1.Condition{{Type: "Accepted", Status: metav1.ConditionTrue, Reason: "Accepted", LastTransitionTime: metav1.Now()}},
+		})
+		if err := cl.Status().Update(ctx, concurrent); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.ReconcileHTTPRoutePolicyAffectedConditions(ctx, policy, stale, gwDiffObj, controllerName); err != nil {
+			t.Fatal(err)
+		}
+		updated := &gatewayapiv1beta1.HTTPRoute{}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(route), updated); err != nil {
+			t.Fatal(err)
+		}
+		if _, found := common.Find(updated.Status.Parents, func(p gatewayapiv1beta1.RouteParentStatus) bool {
+			return p.ControllerName == otherControllerName && p.ParentRef.Name == "gw-2"
+		}); !found {
+			t.Errorf("expected the concurrently written parent status to be kept, but got %v", updated.Status.Parents)
+		}
+		if _, found := common.Find(updated.Status.Parents, func(p gatewayapiv1beta1.RouteParentStatus) bool {
+			return p.ControllerName == controllerName && p.ParentRef.Name == "gw-1"
+		}); !found {
+			t.Errorf("expected the parent status of the controller for gw-1, but got %v", updated.Status.Parents)
+		}
+	})
+}
@@ -0,0 +1,332 @@
+package reconcilers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+const DefaultGarbageCollectionInterval = 10 * time.Minute
+
+// PolicyKind describes a kind of policy whose back references can be garbage collected
+type PolicyKind struct {
+	common.Referrer
+	// NewPolicy returns an empty policy object of the kind, to fetch policies into
+	NewPolicy func() client.Object
+	// TargetRef returns the target reference of a policy object of the kind.
+	// Ignored for the policies that implement common.Policy, whose target references are all taken into account.
+	TargetRef func(client.Object) gatewayapiv1alpha2.PolicyTargetReference
+}
+
+// BackReferenceGarbageCollector periodically prunes stale back references from the annotations of the Gateway API network objects,
+// or from the back reference stores set WithBackReferenceStores.
+// A back reference is stale if the referred policy no longer exists or no longer targets the annotated object, directly or indirectly,
+// e.g. because the policy was force-deleted or modified while its controller was down.
+// It implements controller-runtime's manager.Runnable, to be added to the manager of the policy controllers.
+type BackReferenceGarbageCollector struct {
+	client.Client
+	// APIReader reads from the API server, bypassing the cache of the client, to confirm that the policies and routes not found in the cache
+	// no longer exist before pruning the back references to them, e.g. the manager's APIReader. If nil, the client is used.
+	APIReader   client.Reader
+	PolicyKinds []PolicyKind
+	Interval    time.Duration
+
+	lookupOptions lookupOptions
+}
+
+var _ manager.Runnable = &BackReferenceGarbageCollector{}
+var _ manager.LeaderElectionRunnable = &BackReferenceGarbageCollector{}
+
+func NewBackReferenceGarbageCollector(k8sClient client.Client, interval time.Duration, policyKinds []PolicyKind, o ...lookupOption) *BackReferenceGarbageCollector {
+	if interval <= 0 {
+		interval = DefaultGarbageCollectionInterval
+	}
+	return &BackReferenceGarbageCollector{
+		Client:        k8sClient,
+		PolicyKinds:   policyKinds,
+		Interval:      interval,
+		lookupOptions: applyLookupOptions(o...),
+	}
+}
+
+// Start collects garbage right away and then periodically, until the context is done
+func (gc *BackReferenceGarbageCollector) Start(ctx context.Context) error {
+	logger, _ := logr.FromContext(ctx)
+
+	ticker := time.NewTicker(gc.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := gc.CollectGarbage(ctx); err != nil {
+			logger.Error(err, "BackReferenceGarbageCollector: failed to collect garbage")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection makes sure only the leader replica collects garbage
+func (gc *BackReferenceGarbageCollector) NeedLeaderElection() bool {
+	return true
+}
+
+// CollectGarbage prunes, in a single run, the stale back references to the policies of all the registered kinds.
+// Fails only if the network objects cannot be listed; the errors of pruning an object are logged and the object skipped until the next run.
+// Waits for the migration of the back references to the stores set WithBackReferenceStores, if any.
+func (gc *BackReferenceGarbageCollector) CollectGarbage(ctx context.Context) error {
+	logger, _ := logr.FromContext(ctx)
+
+	if err := gc.lookupOptions.backReferenceStores.WaitForMigration(ctx); err != nil {
+		return err
+	}
+
+	gwList, err := gc.lookupOptions.listGateways(ctx, gc.Client)
+	if err != nil {
+		return err
+	}
+
+	routeList, err := gc.lookupOptions.listHTTPRoutes(ctx, gc.Client)
+	if err != nil {
+		return err
+	}
+
+	objs := make([]client.Object, 0, len(gwList.Items)+len(routeList.Items))
+	for i := range gwList.Items {
+		objs = append(objs, &gwList.Items[i])
+	}
+	for i := range routeList.Items {
+		objs = append(objs, &routeList.Items[i])
+	}
+
+	for _, policyKind := range gc.PolicyKinds {
+		if policyKind.NewPolicy == nil {
+			continue
+		}
+		run := &garbageCollection{BackReferenceGarbageCollector: gc, policyKind: policyKind, policies: make(map[client.ObjectKey]client.Object)}
+		for _, obj := range objs {
+			if err := run.pruneStaleBackReferences(ctx, obj); err != nil {
+				logger.Error(err, "BackReferenceGarbageCollector: failed to prune stale back references", "kind", policyKind.Kind(), "name", client.ObjectKeyFromObject(obj))
+			}
+		}
+	}
+
+	return nil
+}
+
+// garbageCollection is a single run of the garbage collector for a kind of policy
+type garbageCollection struct {
+	*BackReferenceGarbageCollector
+	policyKind PolicyKind
+	policies   map[client.ObjectKey]client.Object // fetched policies, nil if not found
+}
+
+// pruneStaleBackReferences removes the stale back references from the annotations of an object and patches the object if needed,
+// with optimistic locking, so back references added concurrently by the policy controllers are not lost.
+// The back references kept in the store of the kind of policy (see WithBackReferenceStores) are pruned from the store instead.
+func (r *garbageCollection) pruneStaleBackReferences(ctx context.Context, obj client.Object) error {
+	logger, _ := logr.FromContext(ctx)
+
+	storedRefs := false
+	if !r.lookupOptions.annotatesBackReferences(r.policyKind) {
+		store := r.lookupOptions.backReferenceStores.For(r.policyKind)
+		refs, err := store.BackReferences(ctx, obj, r.policyKind)
+		if err != nil && !errors.Is(err, ErrUnsupportedBackReferenceTarget) {
+			return err
+		}
+		// objects the store cannot hold back references in keep them in the annotations
+		storedRefs = err == nil
+		if storedRefs {
+			validRefs, err := r.validBackReferences(ctx, obj, refs)
+			if err != nil {
+				return err
+			}
+			if len(validRefs) < len(refs) {
+				staleRefs := make([]client.ObjectKey, 0, len(refs)-len(validRefs))
+				for _, ref := range refs {
+					if !common.Contains(validRefs, ref) {
+						staleRefs = append(staleRefs, ref)
+					}
+				}
+				if err := store.UpdateBackReferences(ctx, obj, r.policyKind, RemoveBackReferences(staleRefs...)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	original := obj.DeepCopyObject().(client.Object)
+	annotations := common.ReadAnnotationsFromObject(obj)
+	pruned := false
+
+	if policyKey, found := common.DirectReferenceFromObject(obj, r.policyKind.Referrer); found {
+		stale, err := r.isStale(ctx, policyKey, obj, true)
+		if err != nil {
+			return err
+		}
+		if stale {
+			delete(annotations, r.policyKind.Referrer.(common.DirectReferrer).DirectReferenceAnnotationName())
+			pruned = true
+		}
+	}
+
+	if _, found := annotations[r.policyKind.BackReferenceAnnotationName()]; found && !storedRefs {
+		refs := common.BackReferencesFromObject(obj, r.policyKind)
+		validRefs, err := r.validBackReferences(ctx, obj, refs)
+		if err != nil {
+			return err
+		}
+		if len(validRefs) < len(refs) {
+			if len(validRefs) == 0 {
+				delete(annotations, r.policyKind.BackReferenceAnnotationName())
+			} else {
+				if err := common.SetBackReferencesInObject(obj, r.policyKind.Referrer, validRefs); err != nil {
+					return err
+				}
+				annotations = common.ReadAnnotationsFromObject(obj)
+			}
+			pruned = true
+		}
+	}
+
+	if !pruned {
+		return nil
+	}
+
+	obj.SetAnnotations(annotations)
+	err := r.Client.Patch(ctx, obj, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+	logger.V(1).Info("BackReferenceGarbageCollector: patch network resource", "kind", r.policyKind.Kind(), "name", client.ObjectKeyFromObject(obj), "err", err)
+	return client.IgnoreNotFound(err)
+}
+
+// validBackReferences returns the back references that are not stale
+func (r *garbageCollection) validBackReferences(ctx context.Context, obj client.Object, refs []client.ObjectKey) ([]client.ObjectKey, error) {
+	validRefs := make([]client.ObjectKey, 0, len(refs))
+	for _, policyKey := range refs {
+		stale, err := r.isStale(ctx, policyKey, obj, false)
+		if err != nil {
+			return nil, err
+		}
+		if !stale {
+			validRefs = append(validRefs, policyKey)
+		}
+	}
+	return validRefs, nil
+}
+
+// isStale returns true if the policy no longer exists or no longer targets the object with any of its target references
+// (only directly if direct is true; directly or via a route otherwise)
+func (r *garbageCollection) isStale(ctx context.Context, policyKey client.ObjectKey, obj client.Object, direct bool) (bool, error) {
+	policy, err := r.fetchPolicy(ctx, policyKey)
+	if err != nil {
+		return false, err
+	}
+	if policy == nil {
+		return true, nil
+	}
+
+	targetRefs := r.targetRefs(policy)
+	// cannot tell whether the policy still targets the object
+	if targetRefs == nil {
+		return false, nil
+	}
+
+	for _, targetRef := range targetRefs {
+		targeted, err := r.targets(ctx, policy, targetRef, obj, direct)
+		if err != nil {
+			return false, err
+		}
+		if targeted {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// targetRefs returns the target references of a policy: all of them for the policies that implement common.Policy,
+// the one returned by the TargetRef function of the kind of policy otherwise; nil if unknown
+func (r *garbageCollection) targetRefs(policy client.Object) []gatewayapiv1alpha2.PolicyTargetReference {
+	if p, ok := policy.(common.Policy); ok {
+		return p.GetTargetRefs()
+	}
+	if r.policyKind.TargetRef == nil {
+		return nil
+	}
+	return []gatewayapiv1alpha2.PolicyTargetReference{r.policyKind.TargetRef(policy)}
+}
+
+// targets tells whether a target reference of a policy points to the object (only directly if direct is true; directly or via a route otherwise)
+func (r *garbageCollection) targets(ctx context.Context, policy client.Object, targetRef gatewayapiv1alpha2.PolicyTargetReference, obj client.Object, direct bool) (bool, error) {
+	targetKey := client.ObjectKey{Name: string(targetRef.Name), Namespace: policy.GetNamespace()}
+	if targetRef.Namespace != nil {
+		targetKey.Namespace = string(*targetRef.Namespace)
+	}
+
+	objKey := client.ObjectKeyFromObject(obj)
+
+	switch o := obj.(type) {
+	case *gatewayapiv1beta1.Gateway:
+		if targetRef.Kind == "Gateway" {
+			return targetKey == objKey, nil
+		}
+		if direct || targetRef.Kind != "HTTPRoute" {
+			return false, nil
+		}
+		route := &gatewayapiv1beta1.HTTPRoute{}
+		if err := r.get(ctx, targetKey, route); err != nil {
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return common.Contains(targetedGatewayKeys(route), objKey), nil
+	case *gatewayapiv1beta1.HTTPRoute:
+		if targetRef.Kind == "HTTPRoute" {
+			return targetKey == objKey, nil
+		}
+		// policies targeting a parent gateway of the route may be listed in the back references of the route too
+		return !direct && targetRef.Kind == "Gateway" && common.Contains(targetedGatewayKeys(o), targetKey), nil
+	default:
+		return true, nil
+	}
+}
+
+// fetchPolicy fetches a policy once per run; returns nil if the policy does not exist
+func (r *garbageCollection) fetchPolicy(ctx context.Context, policyKey client.ObjectKey) (client.Object, error) {
+	if policy, fetched := r.policies[policyKey]; fetched {
+		return policy, nil
+	}
+
+	policy := r.policyKind.NewPolicy()
+	err := r.get(ctx, policyKey, policy)
+	if apierrors.IsNotFound(err) {
+		r.policies[policyKey] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.policies[policyKey] = policy
+	return policy, nil
+}
+
+// get fetches an object from the cache of the client and, if not found, confirms it does not exist with the API reader
+func (r *garbageCollection) get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	err := r.Client.Get(ctx, key, obj)
+	if !apierrors.IsNotFound(err) || r.APIReader == nil {
+		return err
+	}
+	return r.APIReader.Get(ctx, key, obj)
+}
@@ -0,0 +1,203 @@
+package reconcilers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func TestBackReferenceGarbageCollector(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), log.Log)
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := gatewayapiv1beta1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	s.AddKnownTypes(schema.GroupVersion{Group: "kuadrant.io", Version: "v1"}, &common.PolicyStub{})
+
+	gwNamespace := gatewayapiv1beta1.Namespace("gw-ns")
+
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		&common.PolicyStub{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "policy-1"},
+			Spec:       common.PolicyStubSpec{TargetRef: gatewayapiv1alpha2.PolicyTargetReference{Kind: "HTTPRoute", Name: "route-1"}},
+		},
+		&common.PolicyStub{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "policy-3"},
+			Spec:       common.PolicyStubSpec{TargetRef: gatewayapiv1alpha2.PolicyTargetReference{Kind: "Gateway", Name: "gw-2"}},
+		},
+		&gatewayapiv1beta1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "app-ns",
+				Name:        "route-1",
+				Annotations: map[string]string{"kuadrant.io/testpolicy-direct-backref": "app-ns/policy-2"},
+			},
+			Spec: gatewayapiv1beta1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayapiv1beta1.CommonRouteSpec{
+					ParentRefs: []gatewayapiv1beta1.ParentReference{{Name: "gw-1", Namespace: &gwNamespace}},
+				},
+			},
+		},
+		&gatewayapiv1beta1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "gw-ns",
+				Name:        "gw-1",
+				Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-1"},{"Namespace":"app-ns","Name":"policy-2"},{"Namespace":"gw-ns","Name":"policy-3"}]`},
+			},
+		},
+		&gatewayapiv1beta1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "gw-ns",
+				Name:      "gw-2",
+				Annotations: map[string]string{
+					"kuadrant.io/testpolicy-direct-backref": "gw-ns/policy-3",
+					"kuadrant.io/testpolicies":              `[{"Namespace":"gw-ns","Name":"policy-3"}]`,
+				},
+			},
+		},
+	).Build()
+
+	gc := NewBackReferenceGarbageCollector(cl, 0, []PolicyKind{
+		{
+			Referrer:  &common.PolicyKindStub{},
+			NewPolicy: func() client.Object { return &common.PolicyStub{} },
+			TargetRef: func(policy client.Object) gatewayapiv1alpha2.PolicyTargetReference {
+				return policy.(*common.PolicyStub).Spec.TargetRef
+			},
+		},
+	})
+
+	if err := gc.CollectGarbage(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	gw1 := &gatewayapiv1beta1.Gateway{}
+	if err := cl.Get(ctx, client.ObjectKey{Namespace: "gw-ns", Name: "gw-1"}, gw1); err != nil {
+		t.Fatal(err)
+	}
+	if val, expected := gw1.GetAnnotations()["kuadrant.io/testpolicies"], `[{"Namespace":"app-ns","Name":"policy-1"}]`; val != expected {
+		t.Errorf("gw-1 back references (%s) do not match expected (%s)", val, expected)
+	}
+
+	gw2 := &gatewayapiv1beta1.Gateway{}
+	if err := cl.Get(ctx, client.ObjectKey{Namespace: "gw-ns", Name: "gw-2"}, gw2); err != nil {
+		t.Fatal(err)
+	}
+	if val, expected := gw2.GetAnnotations()["kuadrant.io/testpolicies"], `[{"Namespace":"gw-ns","Name":"policy-3"}]`; val != expected {
+		t.Errorf("gw-2 back references (%s) do not match expected (%s)", val, expected)
+	}
+	if val, expected := gw2.GetAnnotations()["kuadrant.io/testpolicy-direct-backref"], "gw-ns/policy-3"; val != expected {
+		t.Errorf("gw-2 direct back reference (%s) does not match expected (%s)", val, expected)
+	}
+
+	route := &gatewayapiv1beta1.HTTPRoute{}
+	if err := cl.Get(ctx, client.ObjectKey{Namespace: "app-ns", Name: "route-1"}, route); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := route.GetAnnotations()["kuadrant.io/testpolicy-direct-backref"]; found {
+		t.Error("route-1 stale direct back reference expected to be pruned")
+	}
+
+	policyKinds := []PolicyKind{{Referrer: &common.PolicyKindStub{}, NewPolicy: func() client.Object { return &common.PolicyStub{} }}}
+	newGateway := func(name, backRefs string) *gatewayapiv1beta1.Gateway {
+		return &gatewayapiv1beta1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: name, Annotations: map[string]string{"kuadrant.io/testpolicies": backRefs}},
+		}
+	}
+	backRefs := func(cl client.Client, name string) string {
+		gw := &gatewayapiv1beta1.Gateway{}
+		if err := cl.Get(ctx, client.ObjectKey{Namespace: "gw-ns", Name: name}, gw); err != nil {
+			t.Fatal(err)
+		}
+		return gw.GetAnnotations()["kuadrant.io/testpolicies"]
+	}
+
+	t.Run("when the policy is missing from the cache but exists in the API server then keep the back reference", func(t *testing.T) {
+		policy := &common.PolicyStub{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "policy-1"},
+			Spec:       common.PolicyStubSpec{TargetRef: gatewayapiv1alpha2.PolicyTargetReference{Kind: "Gateway", Name: "gw-1"}},
+		}
+		cl := fake.NewClientBuilder().WithScheme(s).WithObjects(newGateway("gw-1", `[{"Namespace":"gw-ns","Name":"policy-1"}]`)).Build()
+		gc := NewBackReferenceGarbageCollector(cl, 0, policyKinds)
+		gc.APIReader = fake.NewClientBuilder().WithScheme(s).WithObjects(policy).Build()
+
+		if err := gc.CollectGarbage(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if val := backRefs(cl, "gw-1"); val != `[{"Namespace":"gw-ns","Name":"policy-1"}]` {
+			t.Errorf("expected the back reference to be kept, but got %s", val)
+		}
+	})
+
+	t.Run("when the policy has several targets then keep the back references of all the targets", func(t *testing.T) {
+		policy := &common.PolicyStub{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "policy-1"},
+			Spec: common.PolicyStubSpec{TargetRefs: []gatewayapiv1alpha2.PolicyTargetReference{
+				{Kind: "Gateway", Name: "gw-1"},
+				{Kind: "Gateway", Name: "gw-2"},
+			}},
+		}
+		cl := fake.NewClientBuilder().WithScheme(s).WithObjects(
+			policy,
+			newGateway("gw-1", `[{"Namespace":"gw-ns","Name":"policy-1"}]`),
+			newGateway("gw-2", `[{"Namespace":"gw-ns","Name":"policy-1"}]`),
+			newGateway("gw-3", `[{"Namespace":"gw-ns","Name":"policy-1"}]`),
+		).Build()
+		gc := NewBackReferenceGarbageCollector(cl, 0, policyKinds)
+
+		if err := gc.CollectGarbage(ctx); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"gw-1", "gw-2"} {
+			if val := backRefs(cl, name); val != `[{"Namespace":"gw-ns","Name":"policy-1"}]` {
+				t.Errorf("expected the back reference of %s to be kept, but got %s", name, val)
+			}
+		}
+		if val := backRefs(cl, "gw-3"); val != "" {
+			t.Errorf("expected the back reference of gw-3 to be pruned, but got %s", val)
+		}
+	})
+
+	t.Run("when pruning an object fails then skip it and prune the others", func(t *testing.T) {
+		cl := fake.NewClientBuilder().WithScheme(s).WithObjects(
+			newGateway("gw-1", `[{"Namespace":"gw-ns","Name":"policy-1"}]`),
+			newGateway("gw-2", `[{"Namespace":"gw-ns","Name":"policy-1"}]`),
+		).WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, cl client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				if obj.GetName() == "gw-1" {
+					return apierrors.NewConflict(schema.GroupResource{}, obj.GetName(), errors.New("object was modified"))
+				}
+				return cl.Patch(ctx, obj, patch, opts...)
+			},
+		}).Build()
+		gc := NewBackReferenceGarbageCollector(cl, 0, policyKinds)
+
+		if err := gc.CollectGarbage(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if val := backRefs(cl, "gw-1"); val == "" {
+			t.Error("expected the back references of gw-1 to be left for the next run")
+		}
+		if val := backRefs(cl, "gw-2"); val != "" {
+			t.Errorf("expected the back references of gw-2 to be pruned, but got %s", val)
+		}
+	})
+}
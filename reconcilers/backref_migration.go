@@ -0,0 +1,162 @@
+package reconcilers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+// BackReferenceMigration moves the back references stored in the annotations of the Gateway API network objects
+// to the back reference stores selected for each kind of policy. The back references in the annotations are merged
+// with the ones already in the stores and the annotations are removed afterwards.
+// Kinds of policy whose store is an AnnotationBackReferenceStore are skipped, as well as the objects the stores cannot hold back references in.
+// It implements controller-runtime's manager.Runnable, to be added to the manager of the policy controllers; it runs once.
+// Until the migration is done, the back references are read from both the stores and the annotations, and the reconcilers
+// and garbage collectors using the stores wait for the migration before writing to them (see BackReferenceStores.WaitForMigration).
+type BackReferenceMigration struct {
+	client.Client
+	Referrers           []common.Referrer
+	BackReferenceStores *BackReferenceStores
+	// Backoff of the retries of the migration of the objects that failed to migrate. Defaults to DefaultMigrationBackoff.
+	Backoff wait.Backoff
+
+	lookupOptions lookupOptions
+}
+
+var _ manager.Runnable = &BackReferenceMigration{}
+var _ manager.LeaderElectionRunnable = &BackReferenceMigration{}
+
+// DefaultMigrationBackoff is the default backoff of the retries of the migration of the objects that failed to migrate
+var DefaultMigrationBackoff = wait.Backoff{Steps: 5, Duration: time.Second, Factor: 2.0, Jitter: 0.1}
+
+// NewBackReferenceMigration returns a BackReferenceMigration of the back references of the referrers to the stores.
+// The stores are marked as being migrated, until the migration is done.
+func NewBackReferenceMigration(k8sClient client.Client, stores *BackReferenceStores, referrers []common.Referrer, o ...lookupOption) *BackReferenceMigration {
+	stores.startMigration()
+	return &BackReferenceMigration{
+		Client:              k8sClient,
+		Referrers:           referrers,
+		BackReferenceStores: stores,
+		Backoff:             DefaultMigrationBackoff,
+		lookupOptions:       applyLookupOptions(o...),
+	}
+}
+
+// Start migrates the back references once, retrying the objects that failed to migrate with backoff, and marks the migration done.
+// It never fails, so the manager is not stopped: the objects that could not be migrated are logged and keep their annotations.
+func (m *BackReferenceMigration) Start(ctx context.Context) error {
+	logger, _ := logr.FromContext(ctx)
+
+	defer m.BackReferenceStores.finishMigration()
+
+	err := retry.OnError(m.Backoff, func(error) bool { return ctx.Err() == nil }, func() error {
+		return m.Migrate(ctx)
+	})
+	if err != nil {
+		logger.Error(err, "BackReferenceMigration: failed to migrate the back references of some objects, left in the annotations")
+	}
+	return nil
+}
+
+// NeedLeaderElection makes sure only the leader replica migrates the back references
+func (m *BackReferenceMigration) NeedLeaderElection() bool {
+	return true
+}
+
+// Migrate moves the back references of all the referrers from the annotations to the stores.
+// The errors of migrating an object are logged and the object skipped; the returned error joins them.
+func (m *BackReferenceMigration) Migrate(ctx context.Context) error {
+	logger, _ := logr.FromContext(ctx)
+
+	gwList, err := m.lookupOptions.listGateways(ctx, m.Client)
+	if err != nil {
+		return err
+	}
+
+	routeList, err := m.lookupOptions.listHTTPRoutes(ctx, m.Client)
+	if err != nil {
+		return err
+	}
+
+	objs := make([]client.Object, 0, len(gwList.Items)+len(routeList.Items))
+	for i := range gwList.Items {
+		objs = append(objs, &gwList.Items[i])
+	}
+	for i := range routeList.Items {
+		objs = append(objs, &routeList.Items[i])
+	}
+
+	var errs []error
+	for _, referrer := range m.Referrers {
+		store := m.BackReferenceStores.For(referrer)
+		if _, ok := store.(*AnnotationBackReferenceStore); ok || store == nil {
+			continue
+		}
+		for _, obj := range objs {
+			err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+				err := m.migrate(ctx, obj, referrer, store)
+				if apierrors.IsConflict(err) {
+					if err := refreshObject(ctx, m.Client, obj); err != nil {
+						return err
+					}
+				}
+				return err
+			})
+			if client.IgnoreNotFound(err) != nil {
+				logger.Error(err, "BackReferenceMigration: failed to migrate back references", "kind", referrer.Kind(), "name", client.ObjectKeyFromObject(obj))
+				errs = append(errs, fmt.Errorf("%s %s: %w", referrer.Kind(), client.ObjectKeyFromObject(obj), err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// migrate moves the back references to the policies of a kind from the annotations of an object to the store.
+// The annotation is removed with optimistic locking, so it is not removed if the object changed since its back references were migrated.
+func (m *BackReferenceMigration) migrate(ctx context.Context, obj client.Object, referrer common.Referrer, store BackReferenceStore) error {
+	logger, _ := logr.FromContext(ctx)
+
+	if _, found := common.ReadAnnotationsFromObject(obj)[referrer.BackReferenceAnnotationName()]; !found {
+		return nil
+	}
+
+	refs, err := store.BackReferences(ctx, obj, referrer)
+	if errors.Is(err, ErrUnsupportedBackReferenceTarget) {
+		logger.V(1).Info("BackReferenceMigration: back reference store does not support the object, back reference annotation kept", "kind", referrer.Kind(), "name", client.ObjectKeyFromObject(obj))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	migrated := false
+	annotatedRefs := common.BackReferencesFromObject(obj, referrer)
+	for _, policyKey := range annotatedRefs {
+		if !common.Contains(refs, policyKey) {
+			migrated = true
+		}
+	}
+	if migrated {
+		if err := store.UpdateBackReferences(ctx, obj, referrer, AddBackReferences(annotatedRefs...)); err != nil {
+			return err
+		}
+	}
+
+	original := obj.DeepCopyObject().(client.Object)
+	annotations := common.ReadAnnotationsFromObject(obj)
+	delete(annotations, referrer.BackReferenceAnnotationName())
+	obj.SetAnnotations(annotations)
+	err = m.Client.Patch(ctx, obj, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+	logger.V(1).Info("BackReferenceMigration: remove back reference annotation", "kind", referrer.Kind(), "name", client.ObjectKeyFromObject(obj), "err", err)
+	return err
+}
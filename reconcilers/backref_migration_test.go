@@ -0,0 +1,213 @@
+package reconcilers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	kuadrantv1alpha1 "github.com/kuadrant/controller-runtime-ext/api/v1alpha1"
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func TestBackReferenceMigration(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), log.Log)
+
+	policyKind := &common.PolicyKindStub{}
+
+	gw := &gatewayapiv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "gw-ns",
+			Name:      "gw-1",
+			Annotations: map[string]string{
+				"kuadrant.io/testpolicies": `[{"Namespace":"gw-ns","Name":"policy-1"},{"Namespace":"app-ns","Name":"policy-2"}]`,
+				"other":                    "value",
+			},
+		},
+	}
+	binding := &kuadrantv1alpha1.PolicyBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "testpolicy.gateway.gw-1"},
+		Spec: kuadrantv1alpha1.PolicyBindingSpec{
+			PolicyKind: "TestPolicy",
+			Policies:   []kuadrantv1alpha1.PolicyReference{{Namespace: "app-ns", Name: "policy-2"}, {Namespace: "app-ns", Name: "policy-3"}},
+		},
+	}
+	cl := fake.NewClientBuilder().WithScheme(backReferenceStoreTestScheme(t)).WithObjects(gw, binding).Build()
+
+	store := &PolicyBindingBackReferenceStore{Client: cl}
+	stores := NewBackReferenceStores(&AnnotationBackReferenceStore{Client: cl})
+	stores.Register(policyKind, store)
+
+	if err := NewBackReferenceMigration(cl, stores, []common.Referrer{policyKind}).Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	migratedGw := &gatewayapiv1beta1.Gateway{}
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(gw), migratedGw); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("when the back references are migrated then remove the annotation only", func(t *testing.T) {
+		annotations := migratedGw.GetAnnotations()
+		if _, found := annotations["kuadrant.io/testpolicies"]; found {
+			t.Error("expected the back reference annotation to be removed")
+		}
+		if annotations["other"] != "value" {
+			t.Errorf("expected other annotations to be kept, but got %v", annotations)
+		}
+	})
+
+	t.Run("when the store already has back references then merge the migrated ones", func(t *testing.T) {
+		refs, err := store.BackReferences(ctx, migratedGw, policyKind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []client.ObjectKey{{Namespace: "app-ns", Name: "policy-2"}, {Namespace: "app-ns", Name: "policy-3"}, {Namespace: "gw-ns", Name: "policy-1"}}
+		if len(refs) != len(expected) {
+			t.Fatalf("expected back references %v, but got %v", expected, refs)
+		}
+		for i := range expected {
+			if refs[i] != expected[i] {
+				t.Errorf("expected back references %v, but got %v", expected, refs)
+			}
+		}
+	})
+}
+
+func TestBackReferenceMigrationStart(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), log.Log)
+
+	policyKind := &common.PolicyKindStub{}
+
+	newGateway := func(name string) *gatewayapiv1beta1.Gateway {
+		return &gatewayapiv1beta1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "gw-ns",
+				Name:        name,
+				Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"gw-ns","Name":"policy-1"}]`},
+			},
+		}
+	}
+	route := &gatewayapiv1beta1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "app-ns",
+			Name:        "route-1",
+			Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-2"}]`},
+		},
+	}
+
+	fetchAnnotations := func(t *testing.T, cl client.Client, obj client.Object) map[string]string {
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			t.Fatal(err)
+		}
+		return obj.GetAnnotations()
+	}
+
+	t.Run("when an object fails to migrate then log it, migrate the others and do not fail", func(t *testing.T) {
+		cl := fake.NewClientBuilder().WithScheme(backReferenceStoreTestScheme(t)).WithObjects(newGateway("gw-1"), newGateway("gw-2")).WithStatusSubresource(&gatewayapiv1beta1.Gateway{}).WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				if obj.GetName() == "gw-1" {
+					return errors.New("boom")
+				}
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+		}).Build()
+		stores := NewBackReferenceStores(&AnnotationBackReferenceStore{Client: cl})
+		stores.Register(policyKind, &StatusConditionBackReferenceStore{Client: cl})
+
+		migration := NewBackReferenceMigration(cl, stores, []common.Referrer{policyKind})
+		migration.Backoff = wait.Backoff{Steps: 2, Duration: time.Millisecond}
+		if err := migration.Start(ctx); err != nil {
+			t.Errorf("expected the migration not to fail, but got %v", err)
+		}
+
+		if _, found := fetchAnnotations(t, cl, newGateway("gw-1"))["kuadrant.io/testpolicies"]; !found {
+			t.Error("expected the back reference annotation of gw-1 to be kept")
+		}
+		if _, found := fetchAnnotations(t, cl, newGateway("gw-2"))["kuadrant.io/testpolicies"]; found {
+			t.Error("expected the back reference annotation of gw-2 to be removed")
+		}
+		if err := stores.WaitForMigration(ctx); err != nil {
+			t.Errorf("expected the migration to be done, but got %v", err)
+		}
+	})
+
+	t.Run("when the object changed concurrently then retry the migration of the object", func(t *testing.T) {
+		conflicts := 0
+		cl := fake.NewClientBuilder().WithScheme(backReferenceStoreTestScheme(t)).WithObjects(newGateway("gw-1")).WithStatusSubresource(&gatewayapiv1beta1.Gateway{}).WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				if conflicts == 0 {
+					conflicts++
+					return apierrors.NewConflict(schema.GroupResource{Group: gatewayapiv1beta1.GroupName, Resource: "gateways"}, obj.GetName(), errors.New("changed"))
+				}
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+		}).Build()
+		stores := NewBackReferenceStores(&AnnotationBackReferenceStore{Client: cl})
+		stores.Register(policyKind, &StatusConditionBackReferenceStore{Client: cl})
+
+		if err := NewBackReferenceMigration(cl, stores, []common.Referrer{policyKind}).Migrate(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, found := fetchAnnotations(t, cl, newGateway("gw-1"))["kuadrant.io/testpolicies"]; found || conflicts != 1 {
+			t.Errorf("expected the back reference annotation to be removed after 1 conflict, but got %d conflicts", conflicts)
+		}
+	})
+
+	t.Run("when the store does not support the object then keep the back reference annotation", func(t *testing.T) {
+		cl := fake.NewClientBuilder().WithScheme(backReferenceStoreTestScheme(t)).WithObjects(route.DeepCopy()).Build()
+		stores := NewBackReferenceStores(&AnnotationBackReferenceStore{Client: cl})
+		stores.Register(policyKind, &StatusConditionBackReferenceStore{Client: cl})
+
+		if err := NewBackReferenceMigration(cl, stores, []common.Referrer{policyKind}).Migrate(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, found := fetchAnnotations(t, cl, route.DeepCopy())["kuadrant.io/testpolicies"]; !found {
+			t.Error("expected the back reference annotation of the route to be kept")
+		}
+	})
+
+	t.Run("when the migration is not done then read the annotations too and make the writers wait", func(t *testing.T) {
+		gw := newGateway("gw-1")
+		gw.Status.Conditions = []metav1.Condition{{Type: BackReferencesConditionType(policyKind), Status: metav1.ConditionTrue, Reason: "Accepted", Message: "app-ns/policy-3"}}
+		cl := fake.NewClientBuilder().WithScheme(backReferenceStoreTestScheme(t)).WithObjects(gw).WithStatusSubresource(gw).Build()
+		stores := NewBackReferenceStores(&AnnotationBackReferenceStore{Client: cl})
+		stores.Register(policyKind, &StatusConditionBackReferenceStore{Client: cl})
+		migration := NewBackReferenceMigration(cl, stores, []common.Referrer{policyKind})
+
+		if refs, err := stores.BackReferences(ctx, gw, policyKind); err != nil || len(refs) != 2 {
+			t.Errorf("expected the back references of both the store and the annotations, but got %v (err: %v)", refs, err)
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if err := stores.WaitForMigration(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the writers to wait for the migration, but got %v", err)
+		}
+
+		if err := migration.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.WaitForMigration(ctx); err != nil {
+			t.Errorf("expected the migration to be done, but got %v", err)
+		}
+		migratedGw := &gatewayapiv1beta1.Gateway{}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(gw), migratedGw); err != nil {
+			t.Fatal(err)
+		}
+		if refs, err := stores.BackReferences(ctx, migratedGw, policyKind); err != nil || len(refs) != 2 {
+			t.Errorf("expected the migrated back references in the store, but got %v (err: %v)", refs, err)
+		}
+	})
+}
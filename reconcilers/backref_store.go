@@ -0,0 +1,443 @@
+package reconcilers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	kuadrantv1alpha1 "github.com/kuadrant/controller-runtime-ext/api/v1alpha1"
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+// ErrUnsupportedBackReferenceTarget is the error of a back reference store that cannot store back references in a kind of network object
+var ErrUnsupportedBackReferenceTarget = common.ErrUnsupportedBackReferenceTarget
+
+// BackReferenceStore stores the back references from the network objects to the policies of a kind that target them
+type BackReferenceStore interface {
+	common.BackReferenceReader
+	// SetBackReferences replaces the keys of the policies of the kind of the referrer that target the object
+	SetBackReferences(ctx context.Context, obj client.Object, referrer common.Referrer, policyKeys []client.ObjectKey) error
+	// UpdateBackReferences applies an update to the keys of the policies of the kind of the referrer that target the object, as currently stored.
+	// On conflict, the back references are read again and the update re-applied, so changes made concurrently, e.g. by the reconciles
+	// of other policies of the kind, are not overwritten.
+	UpdateBackReferences(ctx context.Context, obj client.Object, referrer common.Referrer, update BackReferencesUpdate) error
+}
+
+// BackReferencesUpdate returns the new keys of the policies that target an object, given the current ones
+type BackReferencesUpdate func(policyKeys []client.ObjectKey) []client.ObjectKey
+
+// AddBackReferences returns the update that adds the policy keys missing from the back references
+func AddBackReferences(policyKeys ...client.ObjectKey) BackReferencesUpdate {
+	return func(current []client.ObjectKey) []client.ObjectKey {
+		updated := common.SliceCopy(current)
+		for _, policyKey := range policyKeys {
+			if !common.Contains(updated, policyKey) {
+				updated = append(updated, policyKey)
+			}
+		}
+		return updated
+	}
+}
+
+// RemoveBackReferences returns the update that removes the policy keys from the back references
+func RemoveBackReferences(policyKeys ...client.ObjectKey) BackReferencesUpdate {
+	return func(current []client.ObjectKey) []client.ObjectKey {
+		updated := make([]client.ObjectKey, 0, len(current))
+		for _, policyKey := range current {
+			if !common.Contains(policyKeys, policyKey) {
+				updated = append(updated, policyKey)
+			}
+		}
+		return updated
+	}
+}
+
+// replaceBackReferences returns the update that replaces the back references with the policy keys
+func replaceBackReferences(policyKeys []client.ObjectKey) BackReferencesUpdate {
+	return func([]client.ObjectKey) []client.ObjectKey { return policyKeys }
+}
+
+// BackReferenceStores selects the back reference store of each kind of policy
+type BackReferenceStores struct {
+	stores       map[string]BackReferenceStore
+	defaultStore BackReferenceStore
+
+	// migrated is closed when the BackReferenceMigration to the stores, if any, is done
+	migrated      chan struct{}
+	finishMigrate sync.Once
+}
+
+// NewBackReferenceStores returns a selector of back reference stores that uses the default store for the kinds of policy without a registered store
+func NewBackReferenceStores(defaultStore BackReferenceStore) *BackReferenceStores {
+	return &BackReferenceStores{stores: make(map[string]BackReferenceStore), defaultStore: defaultStore}
+}
+
+// Register sets the back reference store of a kind of policy
+func (s *BackReferenceStores) Register(referrer common.Referrer, store BackReferenceStore) {
+	s.stores[referrer.Kind()] = store
+}
+
+// For returns the back reference store of a kind of policy
+func (s *BackReferenceStores) For(referrer common.Referrer) BackReferenceStore {
+	if store, ok := s.stores[referrer.Kind()]; ok {
+		return store
+	}
+	return s.defaultStore
+}
+
+var _ common.BackReferenceReader = &BackReferenceStores{}
+
+// BackReferences reads the back references from the object to the policies of the kind of the referrer from the store of the kind of policy.
+// A nil selector, as well as a kind of policy without a store, reads the annotations of the object.
+// While the back references are being migrated to the stores, the ones still in the annotations of the object are read as well.
+func (s *BackReferenceStores) BackReferences(ctx context.Context, obj client.Object, referrer common.Referrer) ([]client.ObjectKey, error) {
+	if s == nil {
+		return common.BackReferencesFromObject(obj, referrer), nil
+	}
+	store := s.For(referrer)
+	if store == nil {
+		return common.BackReferencesFromObject(obj, referrer), nil
+	}
+	refs, err := store.BackReferences(ctx, obj, referrer)
+	if err != nil || !s.migrating() {
+		return refs, err
+	}
+	for _, policyKey := range common.BackReferencesFromObject(obj, referrer) {
+		if !common.Contains(refs, policyKey) {
+			refs = append(refs, policyKey)
+		}
+	}
+	return refs, nil
+}
+
+// WaitForMigration blocks until the BackReferenceMigration to the stores, if any, is done or the context is done
+func (s *BackReferenceStores) WaitForMigration(ctx context.Context) error {
+	if s == nil || s.migrated == nil {
+		return nil
+	}
+	select {
+	case <-s.migrated:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *BackReferenceStores) migrating() bool {
+	if s.migrated == nil {
+		return false
+	}
+	select {
+	case <-s.migrated:
+		return false
+	default:
+		return true
+	}
+}
+
+// startMigration marks the stores as being migrated; meant to be called before the manager starts
+func (s *BackReferenceStores) startMigration() {
+	if s != nil && s.migrated == nil {
+		s.migrated = make(chan struct{})
+	}
+}
+
+func (s *BackReferenceStores) finishMigration() {
+	if s != nil && s.migrated != nil {
+		s.finishMigrate.Do(func() { close(s.migrated) })
+	}
+}
+
+// AnnotationBackReferenceStore stores the back references in the annotations of the network objects, with the encoding of the referrer
+type AnnotationBackReferenceStore struct {
+	client.Client
+}
+
+var _ BackReferenceStore = &AnnotationBackReferenceStore{}
+
+func (s *AnnotationBackReferenceStore) BackReferences(_ context.Context, obj client.Object, referrer common.Referrer) ([]client.ObjectKey, error) {
+	return common.BackReferencesFromObject(obj, referrer), nil
+}
+
+func (s *AnnotationBackReferenceStore) SetBackReferences(ctx context.Context, obj client.Object, referrer common.Referrer, policyKeys []client.ObjectKey) error {
+	logger, _ := logr.FromContext(ctx)
+
+	annotations := common.ReadAnnotationsFromObject(obj)
+	current, found := annotations[referrer.BackReferenceAnnotationName()]
+
+	if len(policyKeys) == 0 {
+		if !found {
+			return nil
+		}
+		delete(annotations, referrer.BackReferenceAnnotationName())
+		obj.SetAnnotations(annotations)
+	} else {
+		if err := common.SetBackReferencesInObject(obj, referrer, policyKeys); err != nil {
+			return err
+		}
+		if found && current == common.ReadAnnotationsFromObject(obj)[referrer.BackReferenceAnnotationName()] {
+			return nil
+		}
+	}
+
+	err := s.Client.Update(ctx, obj)
+	logger.V(1).Info("AnnotationBackReferenceStore: update network resource", "kind", referrer.Kind(), "name", client.ObjectKeyFromObject(obj), "err", err)
+	return err
+}
+
+// UpdateBackReferences updates the object with optimistic locking; on conflict, the object is fetched again and the update re-applied.
+func (s *AnnotationBackReferenceStore) UpdateBackReferences(ctx context.Context, obj client.Object, referrer common.Referrer, update BackReferencesUpdate) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := s.SetBackReferences(ctx, obj, referrer, update(common.BackReferencesFromObject(obj, referrer)))
+		if apierrors.IsConflict(err) {
+			if err := refreshObject(ctx, s.Client, obj); err != nil {
+				return err
+			}
+		}
+		return err
+	})
+}
+
+// StatusConditionBackReferenceStore stores the back references in a condition of the status of the network objects,
+// of type <Kind>BackReferences, whose message is the comma-separated list of policy keys, in canonical form.
+// Supports Gateways and any object with GetConditions and SetConditions methods.
+type StatusConditionBackReferenceStore struct {
+	client.Client
+}
+
+var _ BackReferenceStore = &StatusConditionBackReferenceStore{}
+
+// BackReferencesConditionType returns the type of the condition where StatusConditionBackReferenceStore stores the back references to policies of a kind
+func BackReferencesConditionType(referrer common.Referrer) string {
+	return referrer.Kind() + "BackReferences"
+}
+
+type objectWithConditions interface {
+	client.Object
+	GetConditions() []metav1.Condition
+	SetConditions([]metav1.Condition)
+}
+
+func (s *StatusConditionBackReferenceStore) conditions(obj client.Object) (*[]metav1.Condition, error) {
+	switch o := obj.(type) {
+	case *gatewayapiv1beta1.Gateway:
+		return &o.Status.Conditions, nil
+	case objectWithConditions:
+		conditions := o.GetConditions()
+		return &conditions, nil
+	default:
+		return nil, fmt.Errorf("%w: %T has no status conditions", ErrUnsupportedBackReferenceTarget, obj)
+	}
+}
+
+func (s *StatusConditionBackReferenceStore) BackReferences(_ context.Context, obj client.Object, referrer common.Referrer) ([]client.ObjectKey, error) {
+	conditions, err := s.conditions(obj)
+	if err != nil {
+		return nil, err
+	}
+	condition := meta.FindStatusCondition(*conditions, BackReferencesConditionType(referrer))
+	if condition == nil || condition.Message == "" {
+		return make([]client.ObjectKey, 0), nil
+	}
+	return common.Map(strings.Split(condition.Message, ","), func(ref string) client.ObjectKey {
+		return common.NamespacedNameToObjectKey(ref, obj.GetNamespace())
+	}), nil
+}
+
+// SetBackReferences patches the status of the object with optimistic locking, so the conditions written concurrently by other controllers are not lost.
+// On conflict, the object is fetched again and the patch retried.
+// Fails with an error wrapping ErrConditionLimitExceeded, without patching the status, if the conditions would exceed the limits of the API,
+// e.g. the maximum number of conditions of a Gateway (MaxGatewayConditions); such gateways should be left on another store.
+func (s *StatusConditionBackReferenceStore) SetBackReferences(ctx context.Context, obj client.Object, referrer common.Referrer, policyKeys []client.ObjectKey) error {
+	return s.UpdateBackReferences(ctx, obj, referrer, replaceBackReferences(policyKeys))
+}
+
+// UpdateBackReferences patches the status of the object with optimistic locking; on conflict, the object is fetched again
+// and the update re-applied to the back references in the fresh status.
+func (s *StatusConditionBackReferenceStore) UpdateBackReferences(ctx context.Context, obj client.Object, referrer common.Referrer, update BackReferencesUpdate) error {
+	logger, _ := logr.FromContext(ctx)
+
+	if _, err := s.conditions(obj); err != nil {
+		return err
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		conditions, err := s.conditions(obj)
+		if err != nil {
+			return err
+		}
+		current, err := s.BackReferences(ctx, obj, referrer)
+		if err != nil {
+			return err
+		}
+		policyKeys := common.CanonicalBackReferences(update(current), obj.GetNamespace())
+
+		original := obj.DeepCopyObject().(client.Object)
+		updated := common.SliceCopy(*conditions)
+		if len(policyKeys) == 0 {
+			meta.RemoveStatusCondition(&updated, BackReferencesConditionType(referrer))
+		} else {
+			meta.SetStatusCondition(&updated, metav1.Condition{
+				Type:               BackReferencesConditionType(referrer),
+				Status:             metav1.ConditionTrue,
+				Reason:             string(gatewayapiv1alpha2.PolicyReasonAccepted),
+				Message:            strings.Join(common.Map(policyKeys, client.ObjectKey.String), ","),
+				ObservedGeneration: obj.GetGeneration(),
+			})
+		}
+		if reflect.DeepEqual(updated, *conditions) {
+			return nil
+		}
+		if err := checkConditionLimits(obj, updated); err != nil {
+			return err
+		}
+
+		switch o := obj.(type) {
+		case *gatewayapiv1beta1.Gateway:
+			o.Status.Conditions = updated
+		case objectWithConditions:
+			o.SetConditions(updated)
+		}
+
+		err = s.Client.Status().Patch(ctx, obj, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+		logger.V(1).Info("StatusConditionBackReferenceStore: patch network resource status", "kind", referrer.Kind(), "name", client.ObjectKeyFromObject(obj), "err", err)
+		if apierrors.IsConflict(err) {
+			if err := refreshObject(ctx, s.Client, obj); err != nil {
+				return err
+			}
+		}
+		return err
+	})
+}
+
+// PolicyBindingBackReferenceStore stores the back references in PolicyBinding objects, one per network object and kind of policy,
+// in the namespace of the network object and owned by it, with the policy keys in canonical form. Requires the PolicyBinding CRD and only supports namespaced network objects.
+type PolicyBindingBackReferenceStore struct {
+	client.Client
+}
+
+var _ BackReferenceStore = &PolicyBindingBackReferenceStore{}
+
+// PolicyBindingKey returns the key of the PolicyBinding that stores the back references from a network object to the policies of a kind
+func PolicyBindingKey(obj client.Object, gvk metav1.GroupKind, referrer common.Referrer) client.ObjectKey {
+	return client.ObjectKey{
+		Namespace: obj.GetNamespace(),
+		Name:      strings.ToLower(fmt.Sprintf("%s.%s.%s", referrer.Kind(), gvk.Kind, obj.GetName())),
+	}
+}
+
+func (s *PolicyBindingBackReferenceStore) bindingKey(obj client.Object, referrer common.Referrer) (client.ObjectKey, metav1.GroupKind, error) {
+	if obj.GetNamespace() == "" {
+		return client.ObjectKey{}, metav1.GroupKind{}, fmt.Errorf("%w: %s is cluster-scoped", ErrUnsupportedBackReferenceTarget, obj.GetName())
+	}
+	gvk, err := s.Client.GroupVersionKindFor(obj)
+	if err != nil {
+		return client.ObjectKey{}, metav1.GroupKind{}, err
+	}
+	groupKind := metav1.GroupKind{Group: gvk.Group, Kind: gvk.Kind}
+	return PolicyBindingKey(obj, groupKind, referrer), groupKind, nil
+}
+
+func (s *PolicyBindingBackReferenceStore) BackReferences(ctx context.Context, obj client.Object, referrer common.Referrer) ([]client.ObjectKey, error) {
+	bindingKey, _, err := s.bindingKey(obj, referrer)
+	if err != nil {
+		return nil, err
+	}
+
+	binding := &kuadrantv1alpha1.PolicyBinding{}
+	if err := s.Client.Get(ctx, bindingKey, binding); err != nil {
+		if apierrors.IsNotFound(err) {
+			return make([]client.ObjectKey, 0), nil
+		}
+		return nil, err
+	}
+
+	return common.Map(binding.Spec.Policies, func(ref kuadrantv1alpha1.PolicyReference) client.ObjectKey {
+		return client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}
+	}), nil
+}
+
+func (s *PolicyBindingBackReferenceStore) SetBackReferences(ctx context.Context, obj client.Object, referrer common.Referrer, policyKeys []client.ObjectKey) error {
+	return s.UpdateBackReferences(ctx, obj, referrer, replaceBackReferences(policyKeys))
+}
+
+// UpdateBackReferences creates, updates or deletes the PolicyBinding with optimistic locking; on conflict, or if the binding was created concurrently,
+// the binding is fetched again and the update re-applied.
+func (s *PolicyBindingBackReferenceStore) UpdateBackReferences(ctx context.Context, obj client.Object, referrer common.Referrer, update BackReferencesUpdate) error {
+	logger, _ := logr.FromContext(ctx)
+
+	bindingKey, groupKind, err := s.bindingKey(obj, referrer)
+	if err != nil {
+		return err
+	}
+
+	return retry.OnError(retry.DefaultRetry, func(err error) bool { return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) }, func() error {
+		binding := &kuadrantv1alpha1.PolicyBinding{}
+		err := s.Client.Get(ctx, bindingKey, binding)
+		found := err == nil
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		current := common.Map(binding.Spec.Policies, func(ref kuadrantv1alpha1.PolicyReference) client.ObjectKey {
+			return client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}
+		})
+		policyKeys := update(current)
+
+		if len(policyKeys) == 0 {
+			if !found {
+				return nil
+			}
+			err = s.Client.Delete(ctx, binding, client.Preconditions{ResourceVersion: &binding.ResourceVersion})
+			logger.V(1).Info("PolicyBindingBackReferenceStore: delete policy binding", "binding", bindingKey, "err", err)
+			return client.IgnoreNotFound(err)
+		}
+
+		policies := common.Map(common.CanonicalBackReferences(policyKeys, obj.GetNamespace()), func(key client.ObjectKey) kuadrantv1alpha1.PolicyReference {
+			return kuadrantv1alpha1.PolicyReference{Namespace: key.Namespace, Name: key.Name}
+		})
+
+		if found {
+			if reflect.DeepEqual(binding.Spec.Policies, policies) {
+				return nil
+			}
+			binding.Spec.Policies = policies
+			err = s.Client.Update(ctx, binding)
+			logger.V(1).Info("PolicyBindingBackReferenceStore: update policy binding", "binding", bindingKey, "err", err)
+			return err
+		}
+
+		targetNs := gatewayapiv1beta1.Namespace(obj.GetNamespace())
+		binding = &kuadrantv1alpha1.PolicyBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: bindingKey.Namespace, Name: bindingKey.Name},
+			Spec: kuadrantv1alpha1.PolicyBindingSpec{
+				TargetRef: gatewayapiv1alpha2.PolicyTargetReference{
+					Group:     gatewayapiv1beta1.Group(groupKind.Group),
+					Kind:      gatewayapiv1beta1.Kind(groupKind.Kind),
+					Name:      gatewayapiv1beta1.ObjectName(obj.GetName()),
+					Namespace: &targetNs,
+				},
+				PolicyKind: referrer.Kind(),
+				Policies:   policies,
+			},
+		}
+		if err := controllerutil.SetOwnerReference(obj, binding, s.Client.Scheme()); err != nil {
+			return err
+		}
+		err = s.Client.Create(ctx, binding)
+		logger.V(1).Info("PolicyBindingBackReferenceStore: create policy binding", "binding", bindingKey, "err", err)
+		return err
+	})
+}
@@ -0,0 +1,408 @@
+package reconcilers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	kuadrantv1alpha1 "github.com/kuadrant/controller-runtime-ext/api/v1alpha1"
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func backReferenceStoreTestScheme(t *testing.T) *runtime.Scheme {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := gatewayapiv1beta1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := kuadrantv1alpha1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestBackReferenceStores(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), log.Log)
+
+	policyKind := &common.PolicyKindStub{}
+	policyKeys := []client.ObjectKey{{Namespace: "gw-ns", Name: "policy-1"}, {Namespace: "app-ns", Name: "policy-2"}}
+
+	newStores := func() map[string]func(client.Client) BackReferenceStore {
+		return map[string]func(client.Client) BackReferenceStore{
+			"annotations":       func(cl client.Client) BackReferenceStore { return &AnnotationBackReferenceStore{Client: cl} },
+			"status conditions": func(cl client.Client) BackReferenceStore { return &StatusConditionBackReferenceStore{Client: cl} },
+			"policy bindings":   func(cl client.Client) BackReferenceStore { return &PolicyBindingBackReferenceStore{Client: cl} },
+		}
+	}
+
+	for name, newStore := range newStores() {
+		t.Run("when the back references are stored in "+name+" then read them back and remove them", func(t *testing.T) {
+			gw := &gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1", UID: "gw-1-uid"}}
+			cl := fake.NewClientBuilder().WithScheme(backReferenceStoreTestScheme(t)).WithObjects(gw).WithStatusSubresource(gw).Build()
+			store := newStore(cl)
+
+			fetchGateway := func() *gatewayapiv1beta1.Gateway {
+				obj := &gatewayapiv1beta1.Gateway{}
+				if err := cl.Get(ctx, client.ObjectKeyFromObject(gw), obj); err != nil {
+					t.Fatal(err)
+				}
+				return obj
+			}
+
+			if err := store.SetBackReferences(ctx, fetchGateway(), policyKind, policyKeys); err != nil {
+				t.Fatal(err)
+			}
+			refs, err := store.BackReferences(ctx, fetchGateway(), policyKind)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// stored in canonical form, i.e. sorted by namespace and name
+			if len(refs) != 2 || refs[0] != policyKeys[1] || refs[1] != policyKeys[0] {
+				t.Errorf("expected back references %v, but got %v", []client.ObjectKey{policyKeys[1], policyKeys[0]}, refs)
+			}
+
+			if err := store.SetBackReferences(ctx, fetchGateway(), policyKind, nil); err != nil {
+				t.Fatal(err)
+			}
+			if refs, err := store.BackReferences(ctx, fetchGateway(), policyKind); err != nil || len(refs) != 0 {
+				t.Errorf("expected no back references, but got %v (err: %v)", refs, err)
+			}
+		})
+	}
+
+	for name, newStore := range newStores() {
+		t.Run("when the back references are updated in "+name+" concurrently then keep the changes of both", func(t *testing.T) {
+			gw := &gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1", UID: "gw-1-uid"}}
+			cl := fake.NewClientBuilder().WithScheme(backReferenceStoreTestScheme(t)).WithObjects(gw).WithStatusSubresource(gw).WithInterceptorFuncs(optimisticLockStatusPatch()).Build()
+			store := newStore(cl)
+
+			fetchGateway := func() *gatewayapiv1beta1.Gateway {
+				obj := &gatewayapiv1beta1.Gateway{}
+				if err := cl.Get(ctx, client.ObjectKeyFromObject(gw), obj); err != nil {
+					t.Fatal(err)
+				}
+				return obj
+			}
+
+			if err := store.UpdateBackReferences(ctx, fetchGateway(), policyKind, AddBackReferences(policyKeys[0])); err != nil {
+				t.Fatal(err)
+			}
+			stale := fetchGateway()
+			if err := store.UpdateBackReferences(ctx, fetchGateway(), policyKind, AddBackReferences(policyKeys[1])); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := store.UpdateBackReferences(ctx, stale, policyKind, RemoveBackReferences(policyKeys[0])); err != nil {
+				t.Fatal(err)
+			}
+			refs, err := store.BackReferences(ctx, fetchGateway(), policyKind)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(refs) != 1 || refs[0] != policyKeys[1] {
+				t.Errorf("expected back references %v, but got %v", policyKeys[1:], refs)
+			}
+		})
+	}
+
+	t.Run("when removing back references then do not modify the current ones", func(t *testing.T) {
+		current := common.SliceCopy(policyKeys)
+		if updated := RemoveBackReferences(policyKeys[0])(current); len(updated) != 1 || updated[0] != policyKeys[1] {
+			t.Errorf("expected back references %v, but got %v", policyKeys[1:], updated)
+		}
+		if current[0] != policyKeys[0] || current[1] != policyKeys[1] {
+			t.Errorf("expected the current back references not to be modified, but got %v", current)
+		}
+	})
+
+	t.Run("when the back references are stored in status conditions then keep them out of the annotations", func(t *testing.T) {
+		gw := &gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1"}}
+		cl := fake.NewClientBuilder().WithScheme(backReferenceStoreTestScheme(t)).WithObjects(gw).WithStatusSubresource(gw).Build()
+
+		if err := (&StatusConditionBackReferenceStore{Client: cl}).SetBackReferences(ctx, gw, policyKind, policyKeys); err != nil {
+			t.Fatal(err)
+		}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(gw), gw); err != nil {
+			t.Fatal(err)
+		}
+		if _, found := common.ReadAnnotationsFromObject(gw)[policyKind.BackReferenceAnnotationName()]; found {
+			t.Error("expected no back reference annotation")
+		}
+		if condition := meta.FindStatusCondition(gw.Status.Conditions, BackReferencesConditionType(policyKind)); condition == nil || condition.Message != "app-ns/policy-2,gw-ns/policy-1" {
+			t.Errorf("unexpected condition: %v", condition)
+		}
+	})
+
+	t.Run("when the status of the network object changed concurrently then retry without losing the other conditions", func(t *testing.T) {
+		gw := &gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1"}}
+		cl := fake.NewClientBuilder().WithScheme(backReferenceStoreTestScheme(t)).WithObjects(gw).WithStatusSubresource(gw).WithInterceptorFuncs(optimisticLockStatusPatch()).Build()
+
+		stale := &gatewayapiv1beta1.Gateway{}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(gw), stale); err != nil {
+			t.Fatal(err)
+		}
+		concurrent := stale.DeepCopy()
+		meta.SetStatusCondition(&concurrent.Status.Conditions, metav1.Condition{Type: "Programmed", Status: metav1.ConditionTrue, Reason: "Programmed"})
+		if err := cl.Status().Update(ctx, concurrent); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := (&StatusConditionBackReferenceStore{Client: cl}).SetBackReferences(ctx, stale, policyKind, policyKeys); err != nil {
+			t.Fatal(err)
+		}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(gw), gw); err != nil {
+			t.Fatal(err)
+		}
+		if meta.FindStatusCondition(gw.Status.Conditions, "Programmed") == nil || meta.FindStatusCondition(gw.Status.Conditions, BackReferencesConditionType(policyKind)) == nil {
+			t.Errorf("expected both conditions, but got %v", gw.Status.Conditions)
+		}
+	})
+
+	t.Run("when the status conditions of the gateway are at the limit then fail without patching the status", func(t *testing.T) {
+		newGateway := func(name string, conditions int) *gatewayapiv1beta1.Gateway {
+			gw := &gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: name}}
+			for i := 0; i < conditions; i++ {
+				gw.Status.Conditions = append(gw.Status.Conditions, metav1.Condition{Type: fmt.Sprintf("Condition%d", i), Status: metav1.ConditionTrue, Reason: "Test"})
+			}
+			return gw
+		}
+		belowLimit, atLimit := newGateway("gw-1", MaxGatewayConditions-1), newGateway("gw-2", MaxGatewayConditions)
+		cl := fake.NewClientBuilder().WithScheme(backReferenceStoreTestScheme(t)).WithObjects(belowLimit, atLimit).WithStatusSubresource(belowLimit, atLimit).Build()
+		store := &StatusConditionBackReferenceStore{Client: cl}
+
+		if err := store.SetBackReferences(ctx, belowLimit, policyKind, policyKeys); err != nil {
+			t.Fatal(err)
+		}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(belowLimit), belowLimit); err != nil {
+			t.Fatal(err)
+		}
+		if len(belowLimit.Status.Conditions) != MaxGatewayConditions {
+			t.Errorf("expected the back references to be stored as the last allowed condition, but got %v", belowLimit.Status.Conditions)
+		}
+
+		if err := store.SetBackReferences(ctx, atLimit, policyKind, policyKeys); !errors.Is(err, ErrConditionLimitExceeded) {
+			t.Errorf("expected a condition limit exceeded error, but got %v", err)
+		}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(atLimit), atLimit); err != nil {
+			t.Fatal(err)
+		}
+		if meta.FindStatusCondition(atLimit.Status.Conditions, BackReferencesConditionType(policyKind)) != nil {
+			t.Errorf("expected the status not to be patched, but got %v", atLimit.Status.Conditions)
+		}
+	})
+
+	t.Run("when the back references are stored in policy bindings then the binding is owned by the network object", func(t *testing.T) {
+		gw := &gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1", UID: "gw-1-uid"}}
+		cl := fake.NewClientBuilder().WithScheme(backReferenceStoreTestScheme(t)).WithObjects(gw).Build()
+
+		if err := (&PolicyBindingBackReferenceStore{Client: cl}).SetBackReferences(ctx, gw, policyKind, policyKeys); err != nil {
+			t.Fatal(err)
+		}
+		binding := &kuadrantv1alpha1.PolicyBinding{}
+		if err := cl.Get(ctx, client.ObjectKey{Namespace: "gw-ns", Name: "testpolicy.gateway.gw-1"}, binding); err != nil {
+			t.Fatal(err)
+		}
+		if binding.Spec.PolicyKind != "TestPolicy" || binding.Spec.TargetRef.Kind != "Gateway" || len(binding.OwnerReferences) != 1 || binding.OwnerReferences[0].UID != "gw-1-uid" {
+			t.Errorf("unexpected policy binding: %v", binding)
+		}
+	})
+
+	t.Run("when the network object has no status conditions then fail with an unsupported target error", func(t *testing.T) {
+		route := &gatewayapiv1beta1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "route-1"}}
+		_, err := (&StatusConditionBackReferenceStore{}).BackReferences(ctx, route, policyKind)
+		if !errors.Is(err, ErrUnsupportedBackReferenceTarget) {
+			t.Errorf("expected unsupported target error, but got %v", err)
+		}
+	})
+
+	t.Run("when a store is registered for the kind of policy then select it over the default", func(t *testing.T) {
+		defaultStore := &AnnotationBackReferenceStore{}
+		bindingStore := &PolicyBindingBackReferenceStore{}
+		stores := NewBackReferenceStores(defaultStore)
+		if stores.For(policyKind) != defaultStore {
+			t.Error("expected the default store")
+		}
+		stores.Register(policyKind, bindingStore)
+		if stores.For(policyKind) != bindingStore {
+			t.Error("expected the registered store")
+		}
+	})
+}
+
+func TestReconcileGatewayPolicyReferencesWithStores(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), log.Log)
+
+	policyKind := &common.PolicyKindStub{}
+	policy := &common.PolicyStub{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "policy-1"}}
+	policyKey := client.ObjectKeyFromObject(policy)
+
+	gw1 := &gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1"}}
+	gw2 := &gatewayapiv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-2"},
+		Status: gatewayapiv1beta1.GatewayStatus{
+			Conditions: []metav1.Condition{{Type: BackReferencesConditionType(policyKind), Status: metav1.ConditionTrue, Reason: "Accepted", Message: "gw-ns/policy-1,gw-ns/policy-2"}},
+		},
+	}
+	cl := fake.NewClientBuilder().WithScheme(backReferenceStoreTestScheme(t)).WithObjects(gw1, gw2).WithStatusSubresource(gw1, gw2).Build()
+
+	store := &StatusConditionBackReferenceStore{Client: cl}
+	stores := NewBackReferenceStores(&AnnotationBackReferenceStore{Client: cl})
+	stores.Register(policyKind, store)
+	r := &TargetRefReconciler{Client: cl, BackReferenceStores: stores}
+
+	err := r.ReconcileGatewayPolicyReferences(ctx, policy, &GatewayDiffs{
+		GatewaysMissingPolicyRef:     []GatewayWrapper{{gw1, policyKind}},
+		GatewaysWithInvalidPolicyRef: []GatewayWrapper{{gw2, policyKind}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string][]client.ObjectKey{"gw-1": {policyKey}, "gw-2": {{Namespace: "gw-ns", Name: "policy-2"}}} {
+		gw := &gatewayapiv1beta1.Gateway{}
+		if err := cl.Get(ctx, client.ObjectKey{Namespace: "gw-ns", Name: name}, gw); err != nil {
+			t.Fatal(err)
+		}
+		refs, err := store.BackReferences(ctx, gw, policyKind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(refs) != len(expected) || refs[0] != expected[0] {
+			t.Errorf("expected %s back references %v, but got %v", name, expected, refs)
+		}
+		if _, found := common.ReadAnnotationsFromObject(gw)[policyKind.BackReferenceAnnotationName()]; found {
+			t.Errorf("expected no back reference annotation in %s", name)
+		}
+	}
+}
+
+func TestBackReferenceReadersWithStores(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), log.Log)
+
+	s := backReferenceStoreTestScheme(t)
+	s.AddKnownTypes(schema.GroupVersion{Group: "kuadrant.io", Version: "v1"}, &common.PolicyStub{})
+
+	policyKind := &common.PolicyKindStub{}
+	gwNamespace := gatewayapiv1beta1.Namespace("gw-ns")
+
+	backRefsCondition := func(message string) []metav1.Condition {
+		return []metav1.Condition{{Type: BackReferencesConditionType(policyKind), Status: metav1.ConditionTrue, Reason: "Accepted", Message: message}}
+	}
+
+	// the annotations are stale: the stores are the source of truth
+	gw1 := &gatewayapiv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1", Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"gw-ns","Name":"policy-stale"}]`}},
+		Status:     gatewayapiv1beta1.GatewayStatus{Conditions: backRefsCondition("gw-ns/policy-1,gw-ns/policy-gone")},
+	}
+	gw2 := &gatewayapiv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-2"},
+		Status:     gatewayapiv1beta1.GatewayStatus{Conditions: backRefsCondition("app-ns/policy-2")},
+	}
+	// httproutes have no status conditions, so their back references stay in the annotations
+	route := &gatewayapiv1beta1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "route-1", Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-2"}]`}},
+		Spec: gatewayapiv1beta1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayapiv1beta1.CommonRouteSpec{ParentRefs: []gatewayapiv1beta1.ParentReference{{Name: "gw-2", Namespace: &gwNamespace}}},
+		},
+	}
+	policy1 := &common.PolicyStub{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "policy-1"},
+		Spec:       common.PolicyStubSpec{TargetRef: gatewayapiv1alpha2.PolicyTargetReference{Group: gatewayapiv1beta1.GroupName, Kind: "Gateway", Name: "gw-1"}},
+	}
+	policy2 := &common.PolicyStub{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "policy-2"},
+		Spec:       common.PolicyStubSpec{TargetRef: gatewayapiv1alpha2.PolicyTargetReference{Group: gatewayapiv1beta1.GroupName, Kind: "HTTPRoute", Name: "route-1"}},
+	}
+
+	newClient := func() client.Client {
+		return fake.NewClientBuilder().WithScheme(s).WithIndex(&gatewayapiv1beta1.HTTPRoute{}, common.HTTPRouteParentRefsIndexField, common.HTTPRouteParentRefsIndexerFunc).WithObjects(gw1.DeepCopy(), gw2.DeepCopy(), route.DeepCopy(), policy1.DeepCopyObject().(client.Object), policy2.DeepCopyObject().(client.Object)).WithStatusSubresource(&gatewayapiv1beta1.Gateway{}).Build()
+	}
+	newStores := func(cl client.Client) *BackReferenceStores {
+		stores := NewBackReferenceStores(&AnnotationBackReferenceStore{Client: cl})
+		stores.Register(policyKind, &StatusConditionBackReferenceStore{Client: cl})
+		return stores
+	}
+
+	t.Run("when computing the gateway diffs then read the back references from the stores", func(t *testing.T) {
+		cl := newClient()
+		for name, computeGatewayDiffs := range map[string]func(context.Context, client.Reader, client.Object, client.Object, ...lookupOption) (*GatewayDiffs, error){
+			"function": ComputeGatewayDiffs,
+			"differ":   NewGatewayDiffer().ComputeGatewayDiffs,
+		} {
+			gwDiffs, err := computeGatewayDiffs(ctx, cl, policy1, gw1, WithBackReferenceStores(newStores(cl)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(gwDiffs.GatewaysWithValidPolicyRef) != 1 || len(gwDiffs.GatewaysMissingPolicyRef) != 0 || len(gwDiffs.GatewaysWithInvalidPolicyRef) != 0 {
+				t.Errorf("%s: expected gw-1 with valid policy ref only, but got %+v", name, gwDiffs)
+			}
+		}
+	})
+
+	t.Run("when computing the policy diffs for a gateway then read the back references from the stores", func(t *testing.T) {
+		cl := newClient()
+		gw := &gatewayapiv1beta1.Gateway{}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(gw2), gw); err != nil {
+			t.Fatal(err)
+		}
+		policyDiffs, err := ComputePolicyDiffsForGateway(ctx, cl, gw, []common.Referrer{policyKind}, WithBackReferenceStores(newStores(cl)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := policyDiffs[0]; len(diff.PoliciesWithValidGatewayRef) != 1 || len(diff.PoliciesMissingGatewayRef) != 0 || len(diff.PoliciesWithInvalidGatewayRef) != 0 {
+			t.Errorf("expected policy-2 with valid gateway ref only, but got %+v", diff)
+		}
+	})
+
+	t.Run("when collecting garbage then prune the stale back references from the stores", func(t *testing.T) {
+		cl := newClient()
+		gc := NewBackReferenceGarbageCollector(cl, 0, []PolicyKind{{
+			Referrer:  policyKind,
+			NewPolicy: func() client.Object { return &common.PolicyStub{} },
+			TargetRef: func(obj client.Object) gatewayapiv1alpha2.PolicyTargetReference {
+				return obj.(*common.PolicyStub).Spec.TargetRef
+			},
+		}}, WithBackReferenceStores(newStores(cl)))
+		if err := gc.CollectGarbage(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		gw := &gatewayapiv1beta1.Gateway{}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(gw1), gw); err != nil {
+			t.Fatal(err)
+		}
+		if condition := meta.FindStatusCondition(gw.Status.Conditions, BackReferencesConditionType(policyKind)); condition == nil || condition.Message != "gw-ns/policy-1" {
+			t.Errorf("expected the stale back reference pruned from the status condition, but got %v", condition)
+		}
+	})
+
+	t.Run("when reconciling the affected conditions then read the back references from the stores", func(t *testing.T) {
+		cl := newClient()
+		gw := &gatewayapiv1beta1.Gateway{}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(gw2), gw); err != nil {
+			t.Fatal(err)
+		}
+		r := &TargetRefReconciler{Client: cl, BackReferenceStores: newStores(cl)}
+		if err := r.ReconcileGatewayPolicyAffectedConditions(ctx, policy1, &GatewayDiffs{GatewaysWithInvalidPolicyRef: []GatewayWrapper{{gw, policyKind}}}); err != nil {
+			t.Fatal(err)
+		}
+		if condition := meta.FindStatusCondition(gw.Status.Conditions, PolicyAffectedConditionType(policyKind)); condition == nil || condition.Message != "Object affected by TestPolicy app-ns/policy-2" {
+			t.Errorf("expected the gateway affected by the policy in the store, but got %v", condition)
+		}
+	})
+}
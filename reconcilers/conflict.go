@@ -0,0 +1,123 @@
+package reconcilers
+
+import (
+	"context"
+	"sort"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+// PolicyConflict is the resolution of a conflict between policies of the same kind that target the same network object.
+// The losers are marked with the Accepted condition built by the status package, with reason Conflicted (see status.ConflictErr).
+type PolicyConflict struct {
+	// Winner is the policy that takes precedence
+	Winner client.Object
+	// Losers are the other policies, ranked
+	Losers []client.Object
+}
+
+// Lost tells whether a policy lost the conflict
+func (c *PolicyConflict) Lost(policy client.Object) bool {
+	policyKey := client.ObjectKeyFromObject(policy)
+	_, found := common.Find(c.Losers, func(loser client.Object) bool { return client.ObjectKeyFromObject(loser) == policyKey })
+	return found
+}
+
+// RankPolicies sorts the policies by precedence, as prescribed by GEP-713: the oldest first, then alphabetically by namespace/name
+func RankPolicies(policies []client.Object) []client.Object {
+	ranked := common.SliceCopy(policies)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		ti, tj := ranked[i].GetCreationTimestamp(), ranked[j].GetCreationTimestamp()
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		return client.ObjectKeyFromObject(ranked[i]).String() < client.ObjectKeyFromObject(ranked[j]).String()
+	})
+	return ranked
+}
+
+// ResolvePolicyConflict ranks conflicting policies and returns the winner and the losers; nil if there is no conflict (less than 2 policies)
+func ResolvePolicyConflict(policies ...client.Object) *PolicyConflict {
+	if len(policies) < 2 {
+		return nil
+	}
+	ranked := RankPolicies(policies)
+	return &PolicyConflict{Winner: ranked[0], Losers: ranked[1:]}
+}
+
+// ResolveTargetBackReference is like ReconcileTargetBackReference, but resolves the conflict, if the target object is already referenced by another policy,
+// instead of failing. The policy that takes precedence keeps (or takes over) the back reference.
+// The other policy is ranked only if it still targets the object; a policy re-targeted elsewhere loses the back reference without conflict.
+// newPolicy returns an empty object of the kind of the policy, to fetch the other policy into.
+// Returns the resolved conflict, if any, so the policy can be marked as not accepted, with reason Conflicted, if it lost.
+func (r *TargetRefReconciler) ResolveTargetBackReference(ctx context.Context, policy, targetNetworkObject client.Object, annotationName string, newPolicy func() client.Object) (*PolicyConflict, error) {
+	logger, _ := logr.FromContext(ctx)
+
+	policyKey := client.ObjectKeyFromObject(policy)
+
+	val, found := common.ReadAnnotationsFromObject(targetNetworkObject)[annotationName]
+	if !found || val == policyKey.String() {
+		return nil, r.ReconcileTargetBackReference(ctx, policyKey, targetNetworkObject, annotationName)
+	}
+
+	otherPolicyKey := common.NamespacedNameToObjectKey(val, targetNetworkObject.GetNamespace())
+	otherPolicy := newPolicy()
+	err := r.Client.Get(ctx, otherPolicyKey, otherPolicy)
+	logger.V(1).Info("ResolveTargetBackReference: fetch conflicting policy", "policy", otherPolicyKey, "err", err)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	var conflict *PolicyConflict
+	if err == nil && otherPolicy.GetDeletionTimestamp() == nil && targetsObject(otherPolicy, targetNetworkObject) {
+		conflict = ResolvePolicyConflict(policy, otherPolicy)
+		if conflict.Lost(policy) {
+			return conflict, nil
+		}
+	}
+
+	// the policy takes over the back reference from the missing, deleted, re-targeted or losing policy
+	annotations := common.ReadAnnotationsFromObject(targetNetworkObject)
+	annotations[annotationName] = policyKey.String()
+	targetNetworkObject.SetAnnotations(annotations)
+	err = r.Client.Update(ctx, targetNetworkObject)
+	logger.V(1).Info("ResolveTargetBackReference: update target object", "name", client.ObjectKeyFromObject(targetNetworkObject), "previous", otherPolicyKey, "err", err)
+	if err != nil {
+		return nil, err
+	}
+
+	return conflict, nil
+}
+
+// targetsObject tells whether any of the target references of the policy points directly to the object.
+// Policies that do not implement common.Policy are assumed to target the object.
+func targetsObject(policy, obj client.Object) bool {
+	p, ok := policy.(common.Policy)
+	if !ok {
+		return true
+	}
+
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	switch obj.(type) {
+	case *gatewayapiv1beta1.Gateway:
+		kind = "Gateway"
+	case *gatewayapiv1beta1.HTTPRoute:
+		kind = "HTTPRoute"
+	}
+
+	for _, targetRef := range p.GetTargetRefs() {
+		targetKey := client.ObjectKey{Name: string(targetRef.Name), Namespace: policy.GetNamespace()}
+		if targetRef.Namespace != nil {
+			targetKey.Namespace = string(*targetRef.Namespace)
+		}
+		if string(targetRef.Kind) == kind && targetKey == client.ObjectKeyFromObject(obj) {
+			return true
+		}
+	}
+	return false
+}
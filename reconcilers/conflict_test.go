@@ -0,0 +1,172 @@
+package reconcilers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func TestRankPolicies(t *testing.T) {
+	now := time.Now()
+	newPolicy := func(namespace, name string, created time.Time) client.Object {
+		return &common.PolicyStub{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, CreationTimestamp: metav1.Time{Time: created}}}
+	}
+
+	ranked := RankPolicies([]client.Object{
+		newPolicy("ns-b", "policy-1", now),
+		newPolicy("ns-a", "policy-2", now),
+		newPolicy("ns-c", "policy-3", now.Add(-time.Hour)),
+		newPolicy("ns-a", "policy-1", now),
+	})
+
+	expected := []string{"ns-c/policy-3", "ns-a/policy-1", "ns-a/policy-2", "ns-b/policy-1"}
+	for i, policy := range ranked {
+		if key := client.ObjectKeyFromObject(policy).String(); key != expected[i] {
+			t.Errorf("expected policy %s at position %d, but got %s", expected[i], i, key)
+		}
+	}
+
+	conflict := ResolvePolicyConflict(ranked[3], ranked[0])
+	if client.ObjectKeyFromObject(conflict.Winner).String() != "ns-c/policy-3" || !conflict.Lost(ranked[3]) || conflict.Lost(ranked[0]) {
+		t.Errorf("unexpected conflict resolution: %v", conflict)
+	}
+
+	if ResolvePolicyConflict(ranked[0]) != nil {
+		t.Error("expected no conflict with a single policy")
+	}
+}
+
+func TestResolveTargetBackReference(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), log.Log)
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := gatewayapiv1beta1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	s.AddKnownTypes(schema.GroupVersion{Group: "kuadrant.io", Version: "v1"}, &common.PolicyStub{})
+
+	annotationName := (&common.PolicyKindStub{}).DirectReferenceAnnotationName()
+	now := time.Now()
+
+	routeTargetRef := gatewayapiv1alpha2.PolicyTargetReference{Group: gatewayapiv1beta1.GroupName, Kind: "HTTPRoute", Name: "route-1"}
+	olderPolicy := &common.PolicyStub{ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "policy-1", CreationTimestamp: metav1.Time{Time: now.Add(-time.Hour)}}, Spec: common.PolicyStubSpec{TargetRef: routeTargetRef}}
+	newerPolicy := &common.PolicyStub{ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "policy-2", CreationTimestamp: metav1.Time{Time: now}}, Spec: common.PolicyStubSpec{TargetRef: routeTargetRef}}
+
+	newRoute := func(backRef string) *gatewayapiv1beta1.HTTPRoute {
+		return &gatewayapiv1beta1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "app-ns",
+				Name:        "route-1",
+				Annotations: map[string]string{annotationName: backRef},
+			},
+		}
+	}
+
+	newPolicy := func() client.Object { return &common.PolicyStub{} }
+
+	backRef := func(cl client.Client) string {
+		route := &gatewayapiv1beta1.HTTPRoute{}
+		if err := cl.Get(ctx, client.ObjectKey{Namespace: "app-ns", Name: "route-1"}, route); err != nil {
+			t.Fatal(err)
+		}
+		return route.GetAnnotations()[annotationName]
+	}
+
+	t.Run("when the policy loses the conflict then keep the back reference to the winner", func(t *testing.T) {
+		cl := fake.NewClientBuilder().WithScheme(s).WithObjects(olderPolicy.DeepCopyObject().(client.Object), newRoute("app-ns/policy-1")).Build()
+		r := &TargetRefReconciler{Client: cl}
+
+		route := &gatewayapiv1beta1.HTTPRoute{}
+		if err := cl.Get(ctx, client.ObjectKey{Namespace: "app-ns", Name: "route-1"}, route); err != nil {
+			t.Fatal(err)
+		}
+		conflict, err := r.ResolveTargetBackReference(ctx, newerPolicy, route, annotationName, newPolicy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conflict == nil || !conflict.Lost(newerPolicy) {
+			t.Errorf("expected the policy to lose the conflict, but got %v", conflict)
+		}
+		if ref := backRef(cl); ref != "app-ns/policy-1" {
+			t.Errorf("expected the back reference to the winner, but got %s", ref)
+		}
+	})
+
+	t.Run("when the policy wins the conflict then take over the back reference", func(t *testing.T) {
+		cl := fake.NewClientBuilder().WithScheme(s).WithObjects(newerPolicy.DeepCopyObject().(client.Object), newRoute("app-ns/policy-2")).Build()
+		r := &TargetRefReconciler{Client: cl}
+
+		route := &gatewayapiv1beta1.HTTPRoute{}
+		if err := cl.Get(ctx, client.ObjectKey{Namespace: "app-ns", Name: "route-1"}, route); err != nil {
+			t.Fatal(err)
+		}
+		conflict, err := r.ResolveTargetBackReference(ctx, olderPolicy, route, annotationName, newPolicy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conflict == nil || conflict.Lost(olderPolicy) || !conflict.Lost(newerPolicy) {
+			t.Errorf("expected the policy to win the conflict, but got %v", conflict)
+		}
+		if ref := backRef(cl); ref != "app-ns/policy-1" {
+			t.Errorf("expected the back reference to the policy, but got %s", ref)
+		}
+	})
+
+	t.Run("when the referenced policy no longer exists then take over the back reference without conflict", func(t *testing.T) {
+		cl := fake.NewClientBuilder().WithScheme(s).WithObjects(newRoute("app-ns/policy-1")).Build()
+		r := &TargetRefReconciler{Client: cl}
+
+		route := &gatewayapiv1beta1.HTTPRoute{}
+		if err := cl.Get(ctx, client.ObjectKey{Namespace: "app-ns", Name: "route-1"}, route); err != nil {
+			t.Fatal(err)
+		}
+		conflict, err := r.ResolveTargetBackReference(ctx, newerPolicy, route, annotationName, newPolicy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conflict != nil {
+			t.Errorf("expected no conflict, but got %v", conflict)
+		}
+		if ref := backRef(cl); ref != "app-ns/policy-2" {
+			t.Errorf("expected the back reference to the policy, but got %s", ref)
+		}
+	})
+
+	t.Run("when the referenced policy no longer targets the object then take over the back reference without conflict", func(t *testing.T) {
+		retargetedPolicy := olderPolicy.DeepCopyObject().(*common.PolicyStub)
+		retargetedPolicy.Spec.TargetRef.Name = "route-2"
+		cl := fake.NewClientBuilder().WithScheme(s).WithObjects(retargetedPolicy, newRoute("app-ns/policy-1")).Build()
+		r := &TargetRefReconciler{Client: cl}
+
+		route := &gatewayapiv1beta1.HTTPRoute{}
+		if err := cl.Get(ctx, client.ObjectKey{Namespace: "app-ns", Name: "route-1"}, route); err != nil {
+			t.Fatal(err)
+		}
+		conflict, err := r.ResolveTargetBackReference(ctx, newerPolicy, route, annotationName, newPolicy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conflict != nil {
+			t.Errorf("expected no conflict, but got %v", conflict)
+		}
+		if ref := backRef(cl); ref != "app-ns/policy-2" {
+			t.Errorf("expected the back reference to the policy, but got %s", ref)
+		}
+	})
+}
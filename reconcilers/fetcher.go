@@ -2,6 +2,7 @@ package reconcilers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 
@@ -10,10 +11,24 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
 )
 
+// ErrInvalidTargetRef is wrapped by the errors of FetchTargetRefObject when the target reference object exists but is not a valid target,
+// i.e. unknown kind, out of scope or not ready/accepted
+var ErrInvalidTargetRef = errors.New("invalid target reference")
+
+// ErrTargetNotReady is wrapped by the errors of FetchTargetRefObject when the target reference object is a gateway that is not programmed.
+// The gateway may only be temporarily not ready, so FetchTargetRefObject returns it along with the error. It wraps ErrInvalidTargetRef.
+var ErrTargetNotReady = fmt.Errorf("%w: target not ready", ErrInvalidTargetRef)
+
 // FetchTargetRefObject fetches the target reference object and checks the status is valid
-func FetchTargetRefObject(ctx context.Context, k8sClient client.Reader, targetRef gatewayapiv1alpha2.PolicyTargetReference, defaultNs string) (client.Object, error) {
+// Target objects out of scope of the lookup options (namespaces, labels, gateway classes) are rejected.
+// Gateways not programmed are returned along with an error that wraps ErrTargetNotReady.
+func FetchTargetRefObject(ctx context.Context, k8sClient client.Reader, targetRef gatewayapiv1alpha2.PolicyTargetReference, defaultNs string, o ...lookupOption) (client.Object, error) {
+	opts := applyLookupOptions(o...)
+
 	ns := defaultNs
 	if targetRef.Namespace != nil {
 		ns = string(*targetRef.Namespace)
@@ -21,14 +36,31 @@ func FetchTargetRefObject(ctx context.Context, k8sClient client.Reader, targetRe
 
 	objKey := client.ObjectKey{Name: string(targetRef.Name), Namespace: ns}
 
+	// do not even try to fetch objects from namespaces out of scope, whose access may not be allowed
+	if len(opts.namespaces) > 0 && !common.Contains(opts.namespaces, ns) {
+		return nil, fmt.Errorf("FetchValidTargetRef: targetRef (%v) to network resource in namespace out of scope: %w", targetRef, ErrInvalidTargetRef)
+	}
+
+	var obj client.Object
+	var err error
+
 	switch targetRef.Kind {
 	case "Gateway":
-		return fetchGateway(ctx, k8sClient, objKey)
+		obj, err = fetchGateway(ctx, k8sClient, objKey)
 	case "HTTPRoute":
-		return fetchHTTPRoute(ctx, k8sClient, objKey)
+		obj, err = fetchHTTPRoute(ctx, k8sClient, objKey)
 	default:
-		return nil, fmt.Errorf("FetchValidTargetRef: targetRef (%v) to unknown network resource", targetRef)
+		return nil, fmt.Errorf("FetchValidTargetRef: targetRef (%v) to unknown network resource: %w", targetRef, ErrInvalidTargetRef)
 	}
+	if err != nil && !errors.Is(err, ErrTargetNotReady) {
+		return nil, err
+	}
+
+	if !opts.inScope(obj) {
+		return nil, fmt.Errorf("FetchValidTargetRef: targetRef (%v) to network resource out of scope: %w", targetRef, ErrInvalidTargetRef)
+	}
+
+	return obj, err
 }
 
 func fetchGateway(ctx context.Context, k8sClient client.Reader, key client.ObjectKey) (*gatewayapiv1beta1.Gateway, error) {
@@ -42,7 +74,7 @@ func fetchGateway(ctx context.Context, k8sClient client.Reader, key client.Objec
 	}
 
 	if meta.IsStatusConditionFalse(gw.Status.Conditions, string(gatewayapiv1beta1.GatewayConditionProgrammed)) {
-		return nil, fmt.Errorf("gateway (%v) not ready", key)
+		return gw, fmt.Errorf("gateway (%v): %w", key, ErrTargetNotReady)
 	}
 
 	return gw, nil
@@ -59,7 +91,7 @@ func fetchHTTPRoute(ctx context.Context, k8sClient client.Reader, key client.Obj
 	}
 
 	if !httpRouteAccepted(httpRoute) {
-		return nil, fmt.Errorf("httproute (%v) not accepted", key)
+		return nil, fmt.Errorf("httproute (%v) not accepted: %w", key, ErrInvalidTargetRef)
 	}
 
 	return httpRoute, nil
@@ -93,3 +125,13 @@ func httpRouteAccepted(httpRoute *gatewayapiv1beta1.HTTPRoute) bool {
 
 	return true
 }
+
+// refreshObject fetches again an object into the same variable, e.g. after a conflict, without leftovers of the previous state
+func refreshObject(ctx context.Context, k8sClient client.Reader, obj client.Object) error {
+	fresh := newObjectOfKind(obj)()
+	if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(obj), fresh); err != nil {
+		return err
+	}
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(fresh).Elem())
+	return nil
+}
@@ -0,0 +1,183 @@
+package reconcilers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+type GatewayDiffReasonType string
+
+const (
+	// GatewayTargetedDirectly means the gateway is the target network object of the policy
+	GatewayTargetedDirectly GatewayDiffReasonType = "TargetedDirectly"
+	// GatewayTargetedViaRoute means the gateway is a parent of the route targeted by the policy
+	GatewayTargetedViaRoute GatewayDiffReasonType = "TargetedViaRoute"
+	// GatewayNoLongerTargeted means the gateway is neither the target network object of the policy nor a parent of it anymore
+	GatewayNoLongerTargeted GatewayDiffReasonType = "NoLongerTargeted"
+	// GatewayTargetDeleted means the target network object of the policy no longer exists
+	GatewayTargetDeleted GatewayDiffReasonType = "TargetDeleted"
+	// GatewayPolicyDeleted means the policy is being deleted
+	GatewayPolicyDeleted GatewayDiffReasonType = "PolicyDeleted"
+)
+
+// GatewayDiffReason tells why a gateway is listed in the gateway diffs of a policy
+type GatewayDiffReason struct {
+	Type GatewayDiffReasonType `json:"type"`
+	// Route is the namespaced name of the targeted route through which the gateway is targeted, if any
+	Route string `json:"route,omitempty"`
+	// ParentRef is the parentRef of the targeted route that points to the gateway, if any
+	ParentRef string `json:"parentRef,omitempty"`
+}
+
+func (r GatewayDiffReason) String() string {
+	switch r.Type {
+	case GatewayTargetedDirectly:
+		return "targeted directly"
+	case GatewayTargetedViaRoute:
+		return fmt.Sprintf("targeted via HTTPRoute %s parentRef %s", r.Route, r.ParentRef)
+	case GatewayNoLongerTargeted:
+		return "no longer targeted"
+	case GatewayTargetDeleted:
+		return "no longer targeted because the target was deleted"
+	case GatewayPolicyDeleted:
+		return "no longer targeted because the policy is being deleted"
+	default:
+		return "unknown"
+	}
+}
+
+// Reason returns why a gateway is listed in the diffs
+func (d *GatewayDiffs) Reason(gwKey client.ObjectKey) GatewayDiffReason {
+	return d.Reasons[gwKey]
+}
+
+// String renders the diffs in a human-readable format, one gateway per line along with the reason why it is listed
+func (d *GatewayDiffs) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "policy %s: %d gateway(s) missing policy ref, %d with valid policy ref, %d with invalid policy ref",
+		d.PolicyKey,
+		len(d.GatewaysMissingPolicyRef),
+		len(d.GatewaysWithValidPolicyRef),
+		len(d.GatewaysWithInvalidPolicyRef),
+	)
+	for _, entry := range d.entries() {
+		fmt.Fprintf(&sb, "\n- %s: %s (%s)", entry.Gateway, entry.Diff, entry.Reason)
+	}
+	return sb.String()
+}
+
+// MarshalJSON renders the diffs as JSON, listing the gateways by key instead of the full objects
+func (d *GatewayDiffs) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Policy   string             `json:"policy"`
+		Gateways []gatewayDiffEntry `json:"gateways"`
+	}{
+		Policy:   d.PolicyKey.String(),
+		Gateways: d.entries(),
+	})
+}
+
+type gatewayDiffEntry struct {
+	Gateway string            `json:"gateway"`
+	Diff    string            `json:"diff"`
+	Reason  GatewayDiffReason `json:"reason"`
+}
+
+func (d *GatewayDiffs) entries() []gatewayDiffEntry {
+	entries := make([]gatewayDiffEntry, 0, len(d.GatewaysMissingPolicyRef)+len(d.GatewaysWithValidPolicyRef)+len(d.GatewaysWithInvalidPolicyRef))
+	for _, set := range []struct {
+		diff     string
+		gateways []GatewayWrapper
+	}{
+		{"missing policy ref", d.GatewaysMissingPolicyRef},
+		{"valid policy ref", d.GatewaysWithValidPolicyRef},
+		{"invalid policy ref", d.GatewaysWithInvalidPolicyRef},
+	} {
+		for _, gw := range set.gateways {
+			entries = append(entries, gatewayDiffEntry{
+				Gateway: gw.Key().String(),
+				Diff:    set.diff,
+				Reason:  d.Reason(gw.Key()),
+			})
+		}
+	}
+	return entries
+}
+
+// gatewayDiffReasons tells why each gateway is listed in the diffs
+func gatewayDiffReasons(policy client.Object, targetNetworkObjects []client.Object, gwDiff *GatewayDiffs) map[client.ObjectKey]GatewayDiffReason {
+	reasons := make(map[client.ObjectKey]GatewayDiffReason)
+
+	for _, gws := range [][]GatewayWrapper{gwDiff.GatewaysMissingPolicyRef, gwDiff.GatewaysWithValidPolicyRef} {
+		for _, gw := range gws {
+			reasons[gw.Key()] = targetedGatewayReason(targetingNetworkObject(targetNetworkObjects, gw.Key()), gw.Key())
+		}
+	}
+
+	var targetNetworkObject client.Object
+	for _, obj := range targetNetworkObjects {
+		if obj != nil {
+			targetNetworkObject = obj
+			break
+		}
+	}
+	for _, gw := range gwDiff.GatewaysWithInvalidPolicyRef {
+		reasons[gw.Key()] = untargetedGatewayReason(policy, targetNetworkObject)
+	}
+
+	return reasons
+}
+
+// targetingNetworkObject returns the first of the target network objects in whose hierarchy a gateway is
+func targetingNetworkObject(targetNetworkObjects []client.Object, gwKey client.ObjectKey) client.Object {
+	for _, obj := range targetNetworkObjects {
+		if common.Contains(targetedGatewayKeys(obj), gwKey) {
+			return obj
+		}
+	}
+	return nil
+}
+
+// targetedGatewayReason tells how a gateway in the hierarchy of the target network object is targeted
+func targetedGatewayReason(targetNetworkObject client.Object, gwKey client.ObjectKey) GatewayDiffReason {
+	route, ok := targetNetworkObject.(*gatewayapiv1beta1.HTTPRoute)
+	if !ok {
+		return GatewayDiffReason{Type: GatewayTargetedDirectly}
+	}
+
+	reason := GatewayDiffReason{Type: GatewayTargetedViaRoute, Route: client.ObjectKeyFromObject(route).String()}
+	for _, parentRef := range route.Spec.CommonRouteSpec.ParentRefs {
+		parentKey := client.ObjectKey{Name: string(parentRef.Name), Namespace: route.Namespace}
+		if parentRef.Namespace != nil {
+			parentKey.Namespace = string(*parentRef.Namespace)
+		}
+		if parentKey != gwKey {
+			continue
+		}
+		reason.ParentRef = parentKey.String()
+		if parentRef.SectionName != nil {
+			reason.ParentRef = fmt.Sprintf("%s#%s", reason.ParentRef, *parentRef.SectionName)
+		}
+		break
+	}
+	return reason
+}
+
+// untargetedGatewayReason tells why gateways are no longer targeted by the policy
+func untargetedGatewayReason(policy, targetNetworkObject client.Object) GatewayDiffReason {
+	if policy.GetDeletionTimestamp() != nil {
+		return GatewayDiffReason{Type: GatewayPolicyDeleted}
+	}
+	switch targetNetworkObject.(type) {
+	case *gatewayapiv1beta1.HTTPRoute, *gatewayapiv1beta1.Gateway:
+		return GatewayDiffReason{Type: GatewayNoLongerTargeted}
+	default:
+		return GatewayDiffReason{Type: GatewayTargetDeleted}
+	}
+}
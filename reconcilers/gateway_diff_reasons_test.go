@@ -0,0 +1,128 @@
+package reconcilers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func TestGatewayDiffReasons(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), log.Log)
+
+	err := gatewayapiv1beta1.AddToScheme(scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cl := fake.NewFakeClient(
+		&gatewayapiv1beta1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "gw-ns",
+				Name:        "gw-1",
+				Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-1"}]`},
+			},
+		},
+		&gatewayapiv1beta1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "gw-ns",
+				Name:      "gw-2",
+			},
+		},
+	)
+
+	gwNamespace := gatewayapiv1beta1.Namespace("gw-ns")
+	sectionName := gatewayapiv1beta1.SectionName("http")
+
+	route := &gatewayapiv1beta1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "route-1"},
+		Spec: gatewayapiv1beta1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayapiv1beta1.CommonRouteSpec{
+				ParentRefs: []gatewayapiv1beta1.ParentReference{{Name: "gw-2", Namespace: &gwNamespace, SectionName: &sectionName}},
+			},
+		},
+	}
+
+	policy := &common.PolicyStub{ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "policy-1"}}
+
+	t.Run("when the policy targets a route then gateways are targeted via the route", func(t *testing.T) {
+		gwDiff, err := ComputeGatewayDiffs(ctx, cl, policy, route)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := GatewayDiffReason{Type: GatewayTargetedViaRoute, Route: "app-ns/route-1", ParentRef: "gw-ns/gw-2#http"}
+		if reason := gwDiff.Reason(client.ObjectKey{Namespace: "gw-ns", Name: "gw-2"}); reason != expected {
+			t.Errorf("reason (%+v) does not match expected (%+v)", reason, expected)
+		}
+
+		expected = GatewayDiffReason{Type: GatewayNoLongerTargeted}
+		if reason := gwDiff.Reason(client.ObjectKey{Namespace: "gw-ns", Name: "gw-1"}); reason != expected {
+			t.Errorf("reason (%+v) does not match expected (%+v)", reason, expected)
+		}
+
+		str := gwDiff.String()
+		for _, line := range []string{
+			"policy app-ns/policy-1: 1 gateway(s) missing policy ref, 0 with valid policy ref, 1 with invalid policy ref",
+			"- gw-ns/gw-2: missing policy ref (targeted via HTTPRoute app-ns/route-1 parentRef gw-ns/gw-2#http)",
+			"- gw-ns/gw-1: invalid policy ref (no longer targeted)",
+		} {
+			if !strings.Contains(str, line) {
+				t.Errorf("expected %q to contain %q", str, line)
+			}
+		}
+
+		serialized, err := json.Marshal(gwDiff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedJSON := `{"policy":"app-ns/policy-1","gateways":[{"gateway":"gw-ns/gw-2","diff":"missing policy ref","reason":{"type":"TargetedViaRoute","route":"app-ns/route-1","parentRef":"gw-ns/gw-2#http"}},{"gateway":"gw-ns/gw-1","diff":"invalid policy ref","reason":{"type":"NoLongerTargeted"}}]}`
+		if string(serialized) != expectedJSON {
+			t.Errorf("JSON (%s) does not match expected (%s)", serialized, expectedJSON)
+		}
+	})
+
+	t.Run("when the policy targets a gateway then the gateway is targeted directly", func(t *testing.T) {
+		gateway := &gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1"}}
+		gwDiff, err := ComputeGatewayDiffs(ctx, cl, policy, gateway)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason := gwDiff.Reason(client.ObjectKey{Namespace: "gw-ns", Name: "gw-1"}); reason.Type != GatewayTargetedDirectly {
+			t.Errorf("reason (%+v) expected to be %s", reason, GatewayTargetedDirectly)
+		}
+	})
+
+	t.Run("when the target no longer exists then gateways are no longer targeted because the target was deleted", func(t *testing.T) {
+		gwDiff, err := ComputeGatewayDiffs(ctx, cl, policy, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason := gwDiff.Reason(client.ObjectKey{Namespace: "gw-ns", Name: "gw-1"}); reason.Type != GatewayTargetDeleted {
+			t.Errorf("reason (%+v) expected to be %s", reason, GatewayTargetDeleted)
+		}
+	})
+
+	t.Run("when the policy is being deleted then gateways are no longer targeted because the policy is being deleted", func(t *testing.T) {
+		deletedPolicy := policy.DeepCopyObject().(*common.PolicyStub)
+		deletedPolicy.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		gwDiff, err := ComputeGatewayDiffs(ctx, cl, deletedPolicy, route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason := gwDiff.Reason(client.ObjectKey{Namespace: "gw-ns", Name: "gw-1"}); reason.Type != GatewayPolicyDeleted {
+			t.Errorf("reason (%+v) expected to be %s", reason, GatewayPolicyDeleted)
+		}
+	})
+}
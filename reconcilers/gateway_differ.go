@@ -0,0 +1,131 @@
+package reconcilers
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+// GatewayDiffer computes gateway diffs memoizing the back references read from the annotations of the gateways.
+// The annotations of each gateway are parsed only once per resourceVersion of the gateway and kind of policy.
+// A GatewayDiffer is safe for concurrent use and is meant to be shared across reconciliations of a policy controller.
+type GatewayDiffer struct {
+	cache *BackReferenceCache
+}
+
+func NewGatewayDiffer() *GatewayDiffer {
+	return &GatewayDiffer{cache: NewBackReferenceCache()}
+}
+
+// ComputeGatewayDiffs works as the package-level ComputeGatewayDiffs function, except that it reuses previously parsed back references.
+// The back references kept in other stores than the annotations (see WithBackReferenceStores) are read from the stores every time.
+func (d *GatewayDiffer) ComputeGatewayDiffs(ctx context.Context, k8sClient client.Reader, policy, targetNetworkObject client.Object, o ...lookupOption) (*GatewayDiffs, error) {
+	policyKind, err := policyReferrer(policy)
+	if err != nil {
+		return nil, err
+	}
+	opts := applyLookupOptions(o...)
+	backRefs := opts.backReferences(ctx)
+	if opts.annotatesBackReferences(policyKind) {
+		backRefs = d.cache.BackReferences
+	}
+	return computeGatewayDiffs(ctx, k8sClient, policy, policyKind, []client.Object{targetNetworkObject}, backRefs, opts)
+}
+
+// DefaultBackReferenceCacheSize is the default maximum number of entries of a BackReferenceCache
+const DefaultBackReferenceCacheSize = 10000
+
+// BackReferenceCache memoizes the back references read from the annotations of the objects, for as long as the resourceVersion of the objects does not change.
+// Entries are keyed by UID, so objects deleted and recreated with the same name do not share entries, and the least recently used entries
+// are evicted beyond the maximum size of the cache. Objects without a resourceVersion are never cached.
+type BackReferenceCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[backReferenceCacheKey]*list.Element
+	lru        *list.List
+}
+
+type backReferenceCacheKey struct {
+	uid            types.UID
+	object         client.ObjectKey
+	annotationName string
+}
+
+type backReferenceCacheEntry struct {
+	key             backReferenceCacheKey
+	resourceVersion string
+	refs            []client.ObjectKey
+}
+
+// NewBackReferenceCache returns a BackReferenceCache of DefaultBackReferenceCacheSize entries at most
+func NewBackReferenceCache() *BackReferenceCache {
+	return NewBoundedBackReferenceCache(DefaultBackReferenceCacheSize)
+}
+
+// NewBoundedBackReferenceCache returns a BackReferenceCache of maxEntries entries at most
+func NewBoundedBackReferenceCache(maxEntries int) *BackReferenceCache {
+	return &BackReferenceCache{
+		maxEntries: maxEntries,
+		entries:    make(map[backReferenceCacheKey]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// BackReferences returns the back references to the referrer objects listed in the annotations of the object
+// The returned slice is shared with the cache and must not be modified.
+func (c *BackReferenceCache) BackReferences(obj client.Object, referrer common.Referrer) []client.ObjectKey {
+	resourceVersion := obj.GetResourceVersion()
+	if resourceVersion == "" {
+		return common.BackReferencesFromObject(obj, referrer)
+	}
+
+	key := backReferenceCacheKey{uid: obj.GetUID(), object: client.ObjectKeyFromObject(obj), annotationName: referrer.BackReferenceAnnotationName()}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, found := c.entries[key]; found {
+		entry := elem.Value.(*backReferenceCacheEntry)
+		if entry.resourceVersion == resourceVersion {
+			c.lru.MoveToFront(elem)
+			return entry.refs
+		}
+		c.remove(elem)
+	}
+
+	refs := common.BackReferencesFromObject(obj, referrer)
+	c.entries[key] = c.lru.PushFront(&backReferenceCacheEntry{key: key, resourceVersion: resourceVersion, refs: refs})
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+
+	return refs
+}
+
+// Forget removes from the cache all the entries of an object, e.g. after the object is deleted
+func (c *BackReferenceCache) Forget(objKey client.ObjectKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, elem := range c.entries {
+		if key.object == objKey {
+			c.remove(elem)
+		}
+	}
+}
+
+// Len returns the number of entries in the cache
+func (c *BackReferenceCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *BackReferenceCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*backReferenceCacheEntry).key)
+}
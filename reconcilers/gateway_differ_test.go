@@ -0,0 +1,230 @@
+package reconcilers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func TestBackReferenceCache(t *testing.T) {
+	gateway := &gatewayapiv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "gw-ns",
+			Name:            "gw-1",
+			ResourceVersion: "1",
+			Annotations:     map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-1"}]`},
+		},
+	}
+	policyKind := &common.PolicyKindStub{}
+	cache := NewBackReferenceCache()
+
+	if refs := cache.BackReferences(gateway, policyKind); len(refs) != 1 {
+		t.Fatalf("back references length is %d and it was expected to be 1", len(refs))
+	}
+
+	// same resourceVersion → memoized value is returned even if the annotations are changed in memory
+	gateway.SetAnnotations(map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-1"},{"Namespace":"app-ns","Name":"policy-2"}]`})
+	if refs := cache.BackReferences(gateway, policyKind); len(refs) != 1 {
+		t.Errorf("back references length is %d and it was expected to be 1", len(refs))
+	}
+
+	// new resourceVersion → annotations are parsed again
+	gateway.SetResourceVersion("2")
+	if refs := cache.BackReferences(gateway, policyKind); len(refs) != 2 {
+		t.Errorf("back references length is %d and it was expected to be 2", len(refs))
+	}
+
+	if cache.Len() != 1 {
+		t.Errorf("cache length is %d and it was expected to be 1", cache.Len())
+	}
+
+	cache.Forget(client.ObjectKeyFromObject(gateway))
+	if cache.Len() != 0 {
+		t.Errorf("cache length is %d and it was expected to be 0", cache.Len())
+	}
+
+	// no resourceVersion → never cached
+	gateway.SetResourceVersion("")
+	if refs := cache.BackReferences(gateway, policyKind); len(refs) != 2 {
+		t.Errorf("back references length is %d and it was expected to be 2", len(refs))
+	}
+	if cache.Len() != 0 {
+		t.Errorf("cache length is %d and it was expected to be 0", cache.Len())
+	}
+
+	t.Run("when the object is recreated with the same name then do not reuse the entry of the previous object", func(t *testing.T) {
+		cache := NewBackReferenceCache()
+		gateway := gateway.DeepCopy()
+		gateway.SetUID("uid-1")
+		gateway.SetResourceVersion("1")
+		_ = cache.BackReferences(gateway, policyKind)
+		gateway.SetUID("uid-2")
+		gateway.SetAnnotations(map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-3"}]`})
+		if refs := cache.BackReferences(gateway, policyKind); len(refs) != 1 || refs[0].Name != "policy-3" {
+			t.Errorf("unexpected back references: %v", refs)
+		}
+	})
+
+	t.Run("when the cache is full then evict the least recently used entries", func(t *testing.T) {
+		cache := NewBoundedBackReferenceCache(2)
+		for i := 0; i < 5; i++ {
+			gateway := gateway.DeepCopy()
+			gateway.SetName(fmt.Sprintf("gw-%d", i))
+			gateway.SetResourceVersion("1")
+			_ = cache.BackReferences(gateway, policyKind)
+		}
+		if cache.Len() != 2 {
+			t.Errorf("cache length is %d and it was expected to be 2", cache.Len())
+		}
+	})
+}
+
+func TestGatewayDifferComputeGatewayDiffs(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), log.Log)
+
+	err := gatewayapiv1beta1.AddToScheme(scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cl := fake.NewFakeClient(
+		&gatewayapiv1beta1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "gw-ns",
+				Name:        "gw-1",
+				Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"gw-ns","Name":"policy-1"}]`},
+			},
+		},
+		&gatewayapiv1beta1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "gw-ns",
+				Name:        "gw-2",
+				Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"gw-ns","Name":"policy-1"}]`},
+			},
+		},
+		&gatewayapiv1beta1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "gw-ns",
+				Name:      "gw-3",
+			},
+		},
+	)
+
+	policy := &common.PolicyStub{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "policy-1"}}
+	target := &gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-3"}}
+
+	differ := NewGatewayDiffer()
+
+	for i := 0; i < 2; i++ {
+		gwDiff, err := differ.ComputeGatewayDiffs(ctx, cl, policy, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gwName := func(gw GatewayWrapper) string { return gw.Gateway.Name }
+		if gws := common.Map(gwDiff.GatewaysMissingPolicyRef, gwName); len(gws) != 1 || gws[0] != "gw-3" {
+			t.Errorf("gateways missing policy ref (%v) do not match expected ([gw-3])", gws)
+		}
+		if gws := common.Map(gwDiff.GatewaysWithValidPolicyRef, gwName); len(gws) != 0 {
+			t.Errorf("gateways with valid policy ref (%v) expected to be empty", gws)
+		}
+		if gws := common.Map(gwDiff.GatewaysWithInvalidPolicyRef, gwName); len(gws) != 2 {
+			t.Errorf("gateways with invalid policy ref (%v) do not match expected ([gw-1 gw-2])", gws)
+		}
+	}
+
+	if differ.cache.Len() != 3 {
+		t.Errorf("cache length is %d and it was expected to be 3", differ.cache.Len())
+	}
+}
+
+func BenchmarkGatewayDiffs(b *testing.B) {
+	policyKind := &common.PolicyKindStub{}
+	policyKey := client.ObjectKey{Namespace: "app-ns", Name: "policy-1"}
+
+	for _, size := range []int{100, 1000, 5000} {
+		gwList := &gatewayapiv1beta1.GatewayList{Items: make([]gatewayapiv1beta1.Gateway, size)}
+		policyGwKeys := make([]client.ObjectKey, 0, size/2)
+		for i := range gwList.Items {
+			gwList.Items[i] = gatewayapiv1beta1.Gateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:       "gw-ns",
+					Name:            fmt.Sprintf("gw-%d", i),
+					ResourceVersion: "1",
+					Annotations:     map[string]string{"kuadrant.io/testpolicies": fmt.Sprintf(`[{"Namespace":"app-ns","Name":"policy-%d"},{"Namespace":"app-ns","Name":"policy-%d"}]`, i%3, i%5)},
+				},
+			}
+			if i%2 == 0 {
+				policyGwKeys = append(policyGwKeys, client.ObjectKeyFromObject(&gwList.Items[i]))
+			}
+		}
+
+		b.Run(fmt.Sprintf("three-passes/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = threePassesGatewaysMissingPolicyRef(gwList, policyKey, policyGwKeys, policyKind)
+				_ = threePassesGatewaysWithValidPolicyRef(gwList, policyKey, policyGwKeys, policyKind)
+				_ = threePassesGatewaysWithInvalidPolicyRef(gwList, policyKey, policyGwKeys, policyKind)
+			}
+		})
+
+		b.Run(fmt.Sprintf("single-pass/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = gatewayDiffs(gwList, policyKey, policyGwKeys, policyKind, common.BackReferencesFromObject)
+			}
+		})
+
+		b.Run(fmt.Sprintf("memoized/%d", size), func(b *testing.B) {
+			cache := NewBackReferenceCache()
+			for i := 0; i < b.N; i++ {
+				_ = gatewayDiffs(gwList, policyKey, policyGwKeys, policyKind, cache.BackReferences)
+			}
+		})
+	}
+}
+
+// the three-passes functions below are the classification of the gateways as it was before gatewayDiffs, kept as the baseline of the benchmark
+
+func threePassesGatewaysMissingPolicyRef(gwList *gatewayapiv1beta1.GatewayList, policyKey client.ObjectKey, policyGwKeys []client.ObjectKey, policyKind common.Referrer) []GatewayWrapper {
+	gateways := make([]GatewayWrapper, 0)
+	for i := range gwList.Items {
+		gateway := gwList.Items[i]
+		gw := GatewayWrapper{&gateway, policyKind}
+		if common.Contains(policyGwKeys, client.ObjectKeyFromObject(&gateway)) && !gw.ContainsPolicy(policyKey) {
+			gateways = append(gateways, gw)
+		}
+	}
+	return gateways
+}
+
+func threePassesGatewaysWithValidPolicyRef(gwList *gatewayapiv1beta1.GatewayList, policyKey client.ObjectKey, policyGwKeys []client.ObjectKey, policyKind common.Referrer) []GatewayWrapper {
+	gateways := make([]GatewayWrapper, 0)
+	for i := range gwList.Items {
+		gateway := gwList.Items[i]
+		gw := GatewayWrapper{&gateway, policyKind}
+		if common.Contains(policyGwKeys, client.ObjectKeyFromObject(&gateway)) && gw.ContainsPolicy(policyKey) {
+			gateways = append(gateways, gw)
+		}
+	}
+	return gateways
+}
+
+func threePassesGatewaysWithInvalidPolicyRef(gwList *gatewayapiv1beta1.GatewayList, policyKey client.ObjectKey, policyGwKeys []client.ObjectKey, policyKind common.Referrer) []GatewayWrapper {
+	gateways := make([]GatewayWrapper, 0)
+	for i := range gwList.Items {
+		gateway := gwList.Items[i]
+		gw := GatewayWrapper{&gateway, policyKind}
+		if !common.Contains(policyGwKeys, client.ObjectKeyFromObject(&gateway)) && gw.ContainsPolicy(policyKey) {
+			gateways = append(gateways, gw)
+		}
+	}
+	return gateways
+}
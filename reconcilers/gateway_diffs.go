@@ -15,6 +15,11 @@ type GatewayDiffs struct {
 	GatewaysMissingPolicyRef     []GatewayWrapper
 	GatewaysWithValidPolicyRef   []GatewayWrapper
 	GatewaysWithInvalidPolicyRef []GatewayWrapper
+
+	// PolicyKey is the key of the policy the diffs were computed for
+	PolicyKey client.ObjectKey
+	// Reasons tells why each gateway is listed in the diffs, indexed by gateway key
+	Reasons map[client.ObjectKey]GatewayDiffReason
 }
 
 // ComputeGatewayDiffs computes all the differences to reconcile regarding the gateways whose behaviors should/should not be extended by the policy.
@@ -22,33 +27,50 @@ type GatewayDiffs struct {
 // * list of gateways to which the policy applies for the first time
 // * list of gateways to which the policy no longer applies
 // * list of gateways to which the policy still applies
+// Only gateways in scope of the lookup options (namespaces, labels, gateway classes) are considered.
+// The back references are read from the stores set WithBackReferenceStores, if any, or from the annotations of the gateways.
 // TODO(@guicassolato): unit test
-func ComputeGatewayDiffs(ctx context.Context, k8sClient client.Reader, policy, targetNetworkObject client.Object) (*GatewayDiffs, error) {
-	logger, _ := logr.FromContext(ctx)
-
-	var gwKeys []client.ObjectKey
-	if policy.GetDeletionTimestamp() == nil {
-		gwKeys = targetedGatewayKeys(targetNetworkObject)
-	}
-
-	// TODO(rahulanand16nov): maybe think about optimizing it with a label later
-	allGwList := &gatewayapiv1beta1.GatewayList{}
-	err := k8sClient.List(ctx, allGwList)
+func ComputeGatewayDiffs(ctx context.Context, k8sClient client.Reader, policy, targetNetworkObject client.Object, o ...lookupOption) (*GatewayDiffs, error) {
+	policyKind, err := policyReferrer(policy)
 	if err != nil {
 		return nil, err
 	}
+	opts := applyLookupOptions(o...)
+	return computeGatewayDiffs(ctx, k8sClient, policy, policyKind, []client.Object{targetNetworkObject}, opts.backReferences(ctx), opts)
+}
 
+// policyReferrer returns the policy as a referrer, failing if the policy does not implement the common.Referrer interface
+func policyReferrer(policy client.Object) (common.Referrer, error) {
 	policyKind, ok := policy.(common.Referrer)
 	if !ok {
 		return nil, fmt.Errorf("policy %s is not a referrer", policy.GetObjectKind().GroupVersionKind())
 	}
+	return policyKind, nil
+}
 
-	gwDiff := &GatewayDiffs{
-		GatewaysMissingPolicyRef:     gatewaysMissingPolicyRef(allGwList, client.ObjectKeyFromObject(policy), gwKeys, policyKind),
-		GatewaysWithValidPolicyRef:   gatewaysWithValidPolicyRef(allGwList, client.ObjectKeyFromObject(policy), gwKeys, policyKind),
-		GatewaysWithInvalidPolicyRef: gatewaysWithInvalidPolicyRef(allGwList, client.ObjectKeyFromObject(policy), gwKeys, policyKind),
+// computeGatewayDiffs computes the gateway diffs of a policy of a kind with any number of target network objects (nil if deleted)
+func computeGatewayDiffs(ctx context.Context, k8sClient client.Reader, policy client.Object, policyKind common.Referrer, targetNetworkObjects []client.Object, backRefs backReferencesFunc, opts lookupOptions) (*GatewayDiffs, error) {
+	logger, _ := logr.FromContext(ctx)
+
+	gwKeys := make([]client.ObjectKey, 0)
+	if policy.GetDeletionTimestamp() == nil {
+		for _, targetNetworkObject := range targetNetworkObjects {
+			for _, gwKey := range targetedGatewayKeys(targetNetworkObject) {
+				if !common.Contains(gwKeys, gwKey) {
+					gwKeys = append(gwKeys, gwKey)
+				}
+			}
+		}
+	}
+
+	allGwList, err := opts.listGateways(ctx, k8sClient)
+	if err != nil {
+		return nil, err
 	}
 
+	gwDiff := gatewayDiffs(allGwList, client.ObjectKeyFromObject(policy), gwKeys, policyKind, backRefs)
+	gwDiff.Reasons = gatewayDiffReasons(policy, targetNetworkObjects, gwDiff)
+
 	logger.V(1).Info("ComputeGatewayDiffs",
 		"missing-policy-ref", len(gwDiff.GatewaysMissingPolicyRef),
 		"valid-policy-ref", len(gwDiff.GatewaysWithValidPolicyRef),
@@ -58,43 +80,52 @@ func ComputeGatewayDiffs(ctx context.Context, k8sClient client.Reader, policy, t
 	return gwDiff, nil
 }
 
-// gatewaysMissingPolicyRef returns gateways referenced by the policy but that miss the reference to it the annotations
-func gatewaysMissingPolicyRef(gwList *gatewayapiv1beta1.GatewayList, policyKey client.ObjectKey, policyGwKeys []client.ObjectKey, policyKind common.Referrer) []GatewayWrapper {
-	gateways := make([]GatewayWrapper, 0)
+// backReferencesFunc reads the back references to the referrer objects from a target object
+type backReferencesFunc func(client.Object, common.Referrer) []client.ObjectKey
+
+// gatewayDiffs classifies the gateways as missing, with valid or with invalid policy ref in a single pass,
+// reading the back references of each gateway only once
+func gatewayDiffs(gwList *gatewayapiv1beta1.GatewayList, policyKey client.ObjectKey, policyGwKeys []client.ObjectKey, policyKind common.Referrer, backRefs backReferencesFunc) *GatewayDiffs {
+	gwDiff := &GatewayDiffs{
+		GatewaysMissingPolicyRef:     make([]GatewayWrapper, 0),
+		GatewaysWithValidPolicyRef:   make([]GatewayWrapper, 0),
+		GatewaysWithInvalidPolicyRef: make([]GatewayWrapper, 0),
+		PolicyKey:                    policyKey,
+	}
+	targetedGwKeys := make(map[client.ObjectKey]struct{}, len(policyGwKeys))
+	for _, gwKey := range policyGwKeys {
+		targetedGwKeys[gwKey] = struct{}{}
+	}
 	for i := range gwList.Items {
 		gateway := gwList.Items[i]
 		gw := GatewayWrapper{&gateway, policyKind}
-		if common.Contains(policyGwKeys, client.ObjectKeyFromObject(&gateway)) && !gw.ContainsPolicy(policyKey) {
-			gateways = append(gateways, gw)
+		_, targeted := targetedGwKeys[client.ObjectKeyFromObject(&gateway)]
+		referred := common.Contains(backRefs(&gateway, policyKind), policyKey)
+		switch {
+		case targeted && !referred:
+			gwDiff.GatewaysMissingPolicyRef = append(gwDiff.GatewaysMissingPolicyRef, gw)
+		case targeted && referred:
+			gwDiff.GatewaysWithValidPolicyRef = append(gwDiff.GatewaysWithValidPolicyRef, gw)
+		case !targeted && referred:
+			gwDiff.GatewaysWithInvalidPolicyRef = append(gwDiff.GatewaysWithInvalidPolicyRef, gw)
 		}
 	}
-	return gateways
+	return gwDiff
+}
+
+// gatewaysMissingPolicyRef returns gateways referenced by the policy but that miss the reference to it the annotations
+func gatewaysMissingPolicyRef(gwList *gatewayapiv1beta1.GatewayList, policyKey client.ObjectKey, policyGwKeys []client.ObjectKey, policyKind common.Referrer) []GatewayWrapper {
+	return gatewayDiffs(gwList, policyKey, policyGwKeys, policyKind, common.BackReferencesFromObject).GatewaysMissingPolicyRef
 }
 
 // gatewaysWithValidPolicyRef returns gateways referenced by the policy that also have the reference in the annotations
 func gatewaysWithValidPolicyRef(gwList *gatewayapiv1beta1.GatewayList, policyKey client.ObjectKey, policyGwKeys []client.ObjectKey, policyKind common.Referrer) []GatewayWrapper {
-	gateways := make([]GatewayWrapper, 0)
-	for i := range gwList.Items {
-		gateway := gwList.Items[i]
-		gw := GatewayWrapper{&gateway, policyKind}
-		if common.Contains(policyGwKeys, client.ObjectKeyFromObject(&gateway)) && gw.ContainsPolicy(policyKey) {
-			gateways = append(gateways, gw)
-		}
-	}
-	return gateways
+	return gatewayDiffs(gwList, policyKey, policyGwKeys, policyKind, common.BackReferencesFromObject).GatewaysWithValidPolicyRef
 }
 
 // gatewaysWithInvalidPolicyRef returns gateways not referenced by the policy that still have the reference in the annotations
 func gatewaysWithInvalidPolicyRef(gwList *gatewayapiv1beta1.GatewayList, policyKey client.ObjectKey, policyGwKeys []client.ObjectKey, policyKind common.Referrer) []GatewayWrapper {
-	gateways := make([]GatewayWrapper, 0)
-	for i := range gwList.Items {
-		gateway := gwList.Items[i]
-		gw := GatewayWrapper{&gateway, policyKind}
-		if !common.Contains(policyGwKeys, client.ObjectKeyFromObject(&gateway)) && gw.ContainsPolicy(policyKey) {
-			gateways = append(gateways, gw)
-		}
-	}
-	return gateways
+	return gatewayDiffs(gwList, policyKey, policyGwKeys, policyKind, common.BackReferencesFromObject).GatewaysWithInvalidPolicyRef
 }
 
 // targetedGatewayKeys returns the list of gateways in the hierarchy of a target network object
@@ -1,6 +1,7 @@
 package reconcilers
 
 import (
+	"reflect"
 	"testing"
 
 	appsv1 "k8s.io/api/apps/v1"
@@ -237,6 +238,70 @@ func TestGatewaysWithInvalidPolicyRef(t *testing.T) {
 	}
 }
 
+func TestGatewayDiffs(t *testing.T) {
+	gwList := &gatewayapiv1beta1.GatewayList{
+		Items: []gatewayapiv1beta1.Gateway{
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "gw-ns",
+					Name:        "gw-1",
+					Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-1"}]`},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "gw-ns",
+					Name:        "gw-2",
+					Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"app-ns","Name":"policy-1"}]`},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "gw-ns",
+					Name:      "gw-3",
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "gw-ns",
+					Name:      "gw-4",
+				},
+			},
+		},
+	}
+
+	policyKind := &common.PolicyKindStub{}
+	policyKey := client.ObjectKey{Namespace: "app-ns", Name: "policy-1"}
+	gwName := func(gw GatewayWrapper) string { return gw.Gateway.Name }
+
+	reads := 0
+	backRefs := func(obj client.Object, referrer common.Referrer) []client.ObjectKey {
+		reads++
+		return common.BackReferencesFromObject(obj, referrer)
+	}
+
+	gwDiff := gatewayDiffs(gwList, policyKey, []client.ObjectKey{
+		{Namespace: "gw-ns", Name: "gw-2"},
+		{Namespace: "gw-ns", Name: "gw-3"},
+	}, policyKind, backRefs)
+
+	if gws := common.Map(gwDiff.GatewaysMissingPolicyRef, gwName); !reflect.DeepEqual(gws, []string{"gw-3"}) {
+		t.Errorf("gateways missing policy ref (%v) do not match expected ([gw-3])", gws)
+	}
+	if gws := common.Map(gwDiff.GatewaysWithValidPolicyRef, gwName); !reflect.DeepEqual(gws, []string{"gw-2"}) {
+		t.Errorf("gateways with valid policy ref (%v) do not match expected ([gw-2])", gws)
+	}
+	if gws := common.Map(gwDiff.GatewaysWithInvalidPolicyRef, gwName); !reflect.DeepEqual(gws, []string{"gw-1"}) {
+		t.Errorf("gateways with invalid policy ref (%v) do not match expected ([gw-1])", gws)
+	}
+	if gwDiff.PolicyKey != policyKey {
+		t.Errorf("policy key (%v) does not match expected (%v)", gwDiff.PolicyKey, policyKey)
+	}
+	if reads != len(gwList.Items) {
+		t.Errorf("back references read %d times and they were expected to be read once per gateway (%d)", reads, len(gwList.Items))
+	}
+}
+
 func TestTargetedGatewayKeys(t *testing.T) {
 	var (
 		namespace = "operator-unittest"
@@ -1,8 +1,6 @@
 package reconcilers
 
 import (
-	"encoding/json"
-
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
@@ -33,46 +31,42 @@ func (g GatewayWrapper) ContainsPolicy(policyKey client.ObjectKey) bool {
 // AddPolicy tries to add a policy to the existing ref list.
 // Returns true if policy was added, false otherwise
 func (g GatewayWrapper) AddPolicy(policyKey client.ObjectKey) bool {
+	added, _ := g.AddPolicyWithError(policyKey)
+	return added
+}
+
+// AddPolicyWithError is AddPolicy that also returns the error that prevented adding the policy, e.g. a common.AnnotationsTooLargeError
+// if the annotations of the gateway would exceed the size accepted by the API server
+func (g GatewayWrapper) AddPolicyWithError(policyKey client.ObjectKey) (bool, error) {
 	if g.Gateway == nil {
-		return false
+		return false, nil
 	}
 
 	// annotation exists and contains a back reference to the policy → nothing to do
 	if g.ContainsPolicy(policyKey) {
-		return false
-	}
-
-	gwAnnotations := common.ReadAnnotationsFromObject(g)
-	_, annotationFound := gwAnnotations[g.BackReferenceAnnotationName()]
-
-	// annotation does not exist → create it
-	if !annotationFound {
-		refs := []client.ObjectKey{policyKey}
-		serialized, err := json.Marshal(refs)
-		if err != nil {
-			return false
-		}
-		gwAnnotations[g.BackReferenceAnnotationName()] = string(serialized)
-		g.SetAnnotations(gwAnnotations)
-		return true
+		return false, nil
 	}
 
-	// annotation exists and does not contain a back reference to the policy → add the policy to it
+	// annotation does not exist or does not contain a back reference to the policy → add the policy to it
 	refs := append(common.BackReferencesFromObject(g.Gateway, g.Referrer), policyKey)
-	serialized, err := json.Marshal(refs)
-	if err != nil {
-		return false
+	if err := common.SetBackReferencesInObject(g.Gateway, g.Referrer, refs); err != nil {
+		return false, err
 	}
-	gwAnnotations[g.BackReferenceAnnotationName()] = string(serialized)
-	g.SetAnnotations(gwAnnotations)
-	return true
+	return true, nil
 }
 
 // DeletePolicy tries to delete a policy from the existing ref list.
 // Returns true if the policy was deleted, false otherwise
 func (g GatewayWrapper) DeletePolicy(policyKey client.ObjectKey) bool {
+	deleted, _ := g.DeletePolicyWithError(policyKey)
+	return deleted
+}
+
+// DeletePolicyWithError is DeletePolicy that also returns the error that prevented deleting the policy.
+// A corrupt annotation holds no back references, thus nothing to delete.
+func (g GatewayWrapper) DeletePolicyWithError(policyKey client.ObjectKey) (bool, error) {
 	if g.Gateway == nil {
-		return false
+		return false, nil
 	}
 
 	gwAnnotations := common.ReadAnnotationsFromObject(g)
@@ -80,27 +74,23 @@ func (g GatewayWrapper) DeletePolicy(policyKey client.ObjectKey) bool {
 	// annotation does not exist → nothing to do
 	refsAsStr, annotationFound := gwAnnotations[g.BackReferenceAnnotationName()]
 	if !annotationFound {
-		return false
+		return false, nil
 	}
 
-	var refs []client.ObjectKey
-	err := json.Unmarshal([]byte(refsAsStr), &refs)
+	refs, err := common.DecodeBackReferences(refsAsStr, g.GetNamespace())
 	if err != nil {
-		return false
+		return false, nil
 	}
 
 	// annotation exists and contains a back reference to the policy → remove the policy from it
 	if idx := common.IndexOf(refs, policyKey); idx >= 0 {
 		refs = append(refs[:idx], refs[idx+1:]...)
-		serialized, err := json.Marshal(refs)
-		if err != nil {
-			return false
+		if err := common.SetBackReferencesInObject(g.Gateway, g.Referrer, refs); err != nil {
+			return false, err
 		}
-		gwAnnotations[g.BackReferenceAnnotationName()] = string(serialized)
-		g.SetAnnotations(gwAnnotations)
-		return true
+		return true, nil
 	}
 
 	// annotation exists and does not contain a back reference the policy → nothing to do
-	return false
+	return false, nil
 }
@@ -1,6 +1,8 @@
 package reconcilers
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -71,6 +73,27 @@ func TestGatewayWrapperAddPolicy(t *testing.T) {
 	}
 }
 
+func TestGatewayWrapperAddPolicyWithError(t *testing.T) {
+	gw := GatewayWrapper{
+		Gateway: &gatewayapiv1beta1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "gw-ns",
+				Name:        "gw-1",
+				Annotations: map[string]string{"large": strings.Repeat("x", common.MaxAnnotationsSize)},
+			},
+		},
+		Referrer: &common.PolicyKindStub{},
+	}
+	added, err := gw.AddPolicyWithError(client.ObjectKey{Namespace: "app-ns", Name: "policy-1"})
+	var sizeErr *common.AnnotationsTooLargeError
+	if added || !errors.As(err, &sizeErr) {
+		t.Errorf("GatewayWrapper.AddPolicyWithError() expected to fail with an annotations too large error, but got %v, %v", added, err)
+	}
+	if gw.AddPolicy(client.ObjectKey{Namespace: "app-ns", Name: "policy-1"}) {
+		t.Error("GatewayWrapper.AddPolicy() expected to return false")
+	}
+}
+
 func TestGatewayDeletePolicy(t *testing.T) {
 	gateway := gatewayapiv1beta1.Gateway{
 		ObjectMeta: metav1.ObjectMeta{
@@ -0,0 +1,187 @@
+package reconcilers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+// options
+
+// WithNamespaces restricts the lookup of network objects to the given namespaces.
+// Objects are listed namespace by namespace, which works with caches and RBAC restricted to those namespaces.
+func WithNamespaces(namespaces ...string) lookupOption {
+	return newFuncLookupOption(func(o *lookupOptions) {
+		o.namespaces = append(o.namespaces, namespaces...)
+	})
+}
+
+// WithLabelSelector restricts the lookup of network objects to the ones whose labels match the selector
+func WithLabelSelector(selector labels.Selector) lookupOption {
+	return newFuncLookupOption(func(o *lookupOptions) {
+		o.labelSelector = selector
+	})
+}
+
+// WithGatewayClassNames restricts the lookup of gateways to the ones of the given gateway classes
+func WithGatewayClassNames(gatewayClassNames ...string) lookupOption {
+	return newFuncLookupOption(func(o *lookupOptions) {
+		o.gatewayClassNames = append(o.gatewayClassNames, gatewayClassNames...)
+	})
+}
+
+// WithBackReferenceStores makes the back references from the network objects to the policies be read from the back reference stores
+// selected for each kind of policy, instead of from the annotations of the objects
+func WithBackReferenceStores(stores *BackReferenceStores) lookupOption {
+	return newFuncLookupOption(func(o *lookupOptions) {
+		o.backReferenceStores = stores
+	})
+}
+
+type lookupOption interface {
+	apply(*lookupOptions)
+}
+
+type lookupOptions struct {
+	namespaces        []string
+	labelSelector     labels.Selector
+	gatewayClassNames []string
+
+	backReferenceStores *BackReferenceStores
+}
+
+func newFuncLookupOption(f func(*lookupOptions)) *funcLookupOption {
+	return &funcLookupOption{
+		f: f,
+	}
+}
+
+type funcLookupOption struct {
+	f func(*lookupOptions)
+}
+
+func (flo *funcLookupOption) apply(opts *lookupOptions) {
+	flo.f(opts)
+}
+
+func applyLookupOptions(opt ...lookupOption) lookupOptions {
+	opts := lookupOptions{}
+	for _, o := range opt {
+		o.apply(&opts)
+	}
+	return opts
+}
+
+// inScope returns true if the object matches the namespaces, label selector and gateway classes of the lookup options
+func (o lookupOptions) inScope(obj client.Object) bool {
+	if len(o.namespaces) > 0 && !common.Contains(o.namespaces, obj.GetNamespace()) {
+		return false
+	}
+	if o.labelSelector != nil && !o.labelSelector.Matches(labels.Set(obj.GetLabels())) {
+		return false
+	}
+	if gateway, ok := obj.(*gatewayapiv1beta1.Gateway); ok && len(o.gatewayClassNames) > 0 {
+		return common.Contains(o.gatewayClassNames, string(gateway.Spec.GatewayClassName))
+	}
+	return true
+}
+
+// listOptions returns the options to list the objects in scope of the lookup options, one namespace at a time ("" for all namespaces)
+func (o lookupOptions) listOptions(namespace string) []client.ListOption {
+	listOpts := []client.ListOption{client.InNamespace(namespace)}
+	if o.labelSelector != nil {
+		listOpts = append(listOpts, client.MatchingLabelsSelector{Selector: o.labelSelector})
+	}
+	return listOpts
+}
+
+// listNamespaces returns the namespaces to list the objects from, one at a time, or "" for all namespaces
+func (o lookupOptions) listNamespaces() []string {
+	if len(o.namespaces) == 0 {
+		return []string{""}
+	}
+	return o.namespaces
+}
+
+// listGateways lists the gateways in scope of the lookup options
+func (o lookupOptions) listGateways(ctx context.Context, k8sClient client.Reader) (*gatewayapiv1beta1.GatewayList, error) {
+	gwList := &gatewayapiv1beta1.GatewayList{}
+	for _, namespace := range o.listNamespaces() {
+		nsGwList := &gatewayapiv1beta1.GatewayList{}
+		if err := k8sClient.List(ctx, nsGwList, o.listOptions(namespace)...); err != nil {
+			return nil, err
+		}
+		for i := range nsGwList.Items {
+			if o.inScope(&nsGwList.Items[i]) {
+				gwList.Items = append(gwList.Items, nsGwList.Items[i])
+			}
+		}
+	}
+	return gwList, nil
+}
+
+// listHTTPRoutes lists the httproutes in scope of the lookup options
+func (o lookupOptions) listHTTPRoutes(ctx context.Context, k8sClient client.Reader) (*gatewayapiv1beta1.HTTPRouteList, error) {
+	routeList := &gatewayapiv1beta1.HTTPRouteList{}
+	for _, namespace := range o.listNamespaces() {
+		nsRouteList := &gatewayapiv1beta1.HTTPRouteList{}
+		if err := k8sClient.List(ctx, nsRouteList, o.listOptions(namespace)...); err != nil {
+			return nil, err
+		}
+		routeList.Items = append(routeList.Items, nsRouteList.Items...)
+	}
+	return routeList, nil
+}
+
+// listHTTPRoutesAttachedToGateway lists the httproutes in scope of the lookup options whose parentRefs point to a gateway,
+// by the parentRefs index registered with common.IndexHTTPRouteParentRefs
+func (o lookupOptions) listHTTPRoutesAttachedToGateway(ctx context.Context, k8sClient client.Reader, gwKey client.ObjectKey) ([]*gatewayapiv1beta1.HTTPRoute, error) {
+	routes := make([]*gatewayapiv1beta1.HTTPRoute, 0)
+	for _, namespace := range o.listNamespaces() {
+		nsRouteList := &gatewayapiv1beta1.HTTPRouteList{}
+		listOpts := append(o.listOptions(namespace), client.MatchingFields{common.HTTPRouteParentRefsIndexField: gwKey.String()})
+		if err := k8sClient.List(ctx, nsRouteList, listOpts...); err != nil {
+			return nil, err
+		}
+		for i := range nsRouteList.Items {
+			routes = append(routes, &nsRouteList.Items[i])
+		}
+	}
+	return routes, nil
+}
+
+// backReferences returns the function that reads the back references from the network objects, from the back reference stores if set.
+// Errors reading from the stores are logged and treated as no back references.
+func (o lookupOptions) backReferences(ctx context.Context) backReferencesFunc {
+	if o.backReferenceStores == nil {
+		return common.BackReferencesFromObject
+	}
+	return func(obj client.Object, referrer common.Referrer) []client.ObjectKey {
+		refs, err := common.ReadBackReferences(ctx, o.backReferenceStores, obj, referrer)
+		if err != nil {
+			logger, _ := logr.FromContext(ctx)
+			logger.Error(err, "failed to read back references", "kind", referrer.Kind(), "name", client.ObjectKeyFromObject(obj))
+			return make([]client.ObjectKey, 0)
+		}
+		return refs
+	}
+}
+
+// annotatesBackReferences tells whether the back references to the policies of a kind are kept in the annotations of the network objects,
+// and can therefore be memoized per resourceVersion of the objects
+func (o lookupOptions) annotatesBackReferences(referrer common.Referrer) bool {
+	if o.backReferenceStores == nil {
+		return true
+	}
+	switch o.backReferenceStores.For(referrer).(type) {
+	case nil, *AnnotationBackReferenceStore:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,121 @@
+package reconcilers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func TestLookupOptionsListGateways(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), log.Log)
+
+	err := gatewayapiv1beta1.AddToScheme(scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newGateway := func(namespace, name, gatewayClassName string, lbls map[string]string) *gatewayapiv1beta1.Gateway {
+		return &gatewayapiv1beta1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: lbls},
+			Spec:       gatewayapiv1beta1.GatewaySpec{GatewayClassName: gatewayapiv1beta1.ObjectName(gatewayClassName)},
+		}
+	}
+
+	cl := fake.NewFakeClient(
+		newGateway("tenant-a", "gw-1", "istio", map[string]string{"tier": "external"}),
+		newGateway("tenant-a", "gw-2", "envoy", map[string]string{"tier": "internal"}),
+		newGateway("tenant-b", "gw-3", "istio", map[string]string{"tier": "external"}),
+		newGateway("tenant-c", "gw-4", "istio", nil),
+	)
+
+	testCases := []struct {
+		name     string
+		opts     []lookupOption
+		expected []string
+	}{
+		{
+			name:     "when no option is provided then list all gateways",
+			expected: []string{"gw-1", "gw-2", "gw-3", "gw-4"},
+		},
+		{
+			name:     "when namespaces are provided then list only gateways in those namespaces",
+			opts:     []lookupOption{WithNamespaces("tenant-a", "tenant-c")},
+			expected: []string{"gw-1", "gw-2", "gw-4"},
+		},
+		{
+			name:     "when a label selector is provided then list only gateways with matching labels",
+			opts:     []lookupOption{WithLabelSelector(labels.SelectorFromSet(labels.Set{"tier": "external"}))},
+			expected: []string{"gw-1", "gw-3"},
+		},
+		{
+			name:     "when gateway class names are provided then list only gateways of those classes",
+			opts:     []lookupOption{WithGatewayClassNames("istio")},
+			expected: []string{"gw-1", "gw-3", "gw-4"},
+		},
+		{
+			name:     "when multiple options are provided then list only gateways matching all of them",
+			opts:     []lookupOption{WithNamespaces("tenant-a"), WithGatewayClassNames("istio")},
+			expected: []string{"gw-1"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gwList, err := applyLookupOptions(tc.opts...).listGateways(ctx, cl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gws := common.Map(gwList.Items, func(gw gatewayapiv1beta1.Gateway) string { return gw.Name })
+			if len(gws) != len(tc.expected) {
+				t.Errorf("expected gateways %v, but got %v", tc.expected, gws)
+			}
+			for _, gw := range tc.expected {
+				if !common.Contains(gws, gw) {
+					t.Errorf("expected gateways %v, but got %v", tc.expected, gws)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchTargetRefObjectOutOfScope(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), log.Log)
+
+	err := gatewayapiv1beta1.AddToScheme(scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cl := fake.NewFakeClient(&gatewayapiv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tenant-a", Name: "gw-1"},
+		Spec:       gatewayapiv1beta1.GatewaySpec{GatewayClassName: "istio"},
+	})
+
+	targetRef := gatewayapiv1alpha2.PolicyTargetReference{
+		Group: "gateway.networking.k8s.io",
+		Kind:  "Gateway",
+		Name:  "gw-1",
+	}
+
+	if _, err := FetchTargetRefObject(ctx, cl, targetRef, "tenant-a", WithNamespaces("tenant-a"), WithGatewayClassNames("istio")); err != nil {
+		t.Errorf("target expected to be in scope, but got error: %v", err)
+	}
+
+	if _, err := FetchTargetRefObject(ctx, cl, targetRef, "tenant-a", WithNamespaces("tenant-b")); err == nil {
+		t.Error("target expected to be out of scope due to its namespace")
+	}
+
+	if _, err := FetchTargetRefObject(ctx, cl, targetRef, "tenant-a", WithGatewayClassNames("envoy")); err == nil {
+		t.Error("target expected to be out of scope due to its gateway class")
+	}
+}
@@ -0,0 +1,102 @@
+package reconcilers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+// PolicyDiffs lists, for a kind of policy, the differences to reconcile regarding the back references to the policies in the annotations of a gateway
+type PolicyDiffs struct {
+	PolicyKind                    common.Referrer
+	PoliciesMissingGatewayRef     []client.ObjectKey
+	PoliciesWithValidGatewayRef   []client.ObjectKey
+	PoliciesWithInvalidGatewayRef []client.ObjectKey
+}
+
+// ComputePolicyDiffsForGateway computes, for each kind of policy, all the differences to reconcile regarding the policies that should/should not extend the behavior of the gateway.
+// These include policies that directly target the gateway and policies that target the routes attached to the gateway.
+// * list of policies that apply to the gateway but are not referred back from it yet
+// * list of policies referred back from the gateway that no longer apply to it (stale references)
+// * list of policies referred back from the gateway that still apply to it
+// Only routes in scope of the lookup options (namespaces, labels) are considered. The routes attached to the gateway are looked up by the
+// parentRefs index, which must be registered beforehand with common.IndexHTTPRouteParentRefs.
+// The back references are read from the stores set WithBackReferenceStores, if any, or from the annotations of the gateway and the routes.
+func ComputePolicyDiffsForGateway(ctx context.Context, k8sClient client.Reader, gateway *gatewayapiv1beta1.Gateway, policyKinds []common.Referrer, o ...lookupOption) ([]PolicyDiffs, error) {
+	logger, _ := logr.FromContext(ctx)
+
+	opts := applyLookupOptions(o...)
+	routes, err := opts.listHTTPRoutesAttachedToGateway(ctx, k8sClient, client.ObjectKeyFromObject(gateway))
+	if err != nil {
+		return nil, err
+	}
+
+	backRefs := opts.backReferences(ctx)
+
+	policyDiffs := make([]PolicyDiffs, 0, len(policyKinds))
+	for _, policyKind := range policyKinds {
+		policyKeys := policiesTargetingGateway(gateway, routes, policyKind, backRefs)
+		policyRefs := backRefs(gateway, policyKind)
+
+		diff := PolicyDiffs{
+			PolicyKind:                    policyKind,
+			PoliciesMissingGatewayRef:     make([]client.ObjectKey, 0),
+			PoliciesWithValidGatewayRef:   make([]client.ObjectKey, 0),
+			PoliciesWithInvalidGatewayRef: make([]client.ObjectKey, 0),
+		}
+		for _, policyKey := range policyKeys {
+			if common.Contains(policyRefs, policyKey) {
+				diff.PoliciesWithValidGatewayRef = append(diff.PoliciesWithValidGatewayRef, policyKey)
+			} else {
+				diff.PoliciesMissingGatewayRef = append(diff.PoliciesMissingGatewayRef, policyKey)
+			}
+		}
+		for _, policyRef := range policyRefs {
+			if !common.Contains(policyKeys, policyRef) {
+				diff.PoliciesWithInvalidGatewayRef = append(diff.PoliciesWithInvalidGatewayRef, policyRef)
+			}
+		}
+
+		logger.V(1).Info("ComputePolicyDiffsForGateway",
+			"gateway", client.ObjectKeyFromObject(gateway),
+			"kind", policyKind.Kind(),
+			"missing-gateway-ref", len(diff.PoliciesMissingGatewayRef),
+			"valid-gateway-ref", len(diff.PoliciesWithValidGatewayRef),
+			"invalid-gateway-ref", len(diff.PoliciesWithInvalidGatewayRef),
+		)
+
+		policyDiffs = append(policyDiffs, diff)
+	}
+
+	return policyDiffs, nil
+}
+
+// policiesTargetingGateway returns the policies of a kind that directly target the gateway or any of the given routes,
+// based on the direct back references and the back references of the routes
+func policiesTargetingGateway(gateway *gatewayapiv1beta1.Gateway, routes []*gatewayapiv1beta1.HTTPRoute, policyKind common.Referrer, backRefs backReferencesFunc) []client.ObjectKey {
+	policyKeys := make([]client.ObjectKey, 0)
+	add := func(policyKey client.ObjectKey) {
+		if !common.Contains(policyKeys, policyKey) {
+			policyKeys = append(policyKeys, policyKey)
+		}
+	}
+
+	if policyKey, found := common.DirectReferenceFromObject(gateway, policyKind); found {
+		add(policyKey)
+	}
+
+	for _, route := range routes {
+		if policyKey, found := common.DirectReferenceFromObject(route, policyKind); found {
+			add(policyKey)
+		}
+		for _, policyKey := range backRefs(route, policyKind) {
+			add(policyKey)
+		}
+	}
+
+	return policyKeys
+}
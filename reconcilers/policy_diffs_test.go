@@ -0,0 +1,116 @@
+package reconcilers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func TestComputePolicyDiffsForGateway(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), log.Log)
+
+	err := gatewayapiv1beta1.AddToScheme(scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gwNamespace := gatewayapiv1beta1.Namespace("gw-ns")
+
+	gateway := &gatewayapiv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "gw-ns",
+			Name:      "gw-1",
+			Annotations: map[string]string{
+				"kuadrant.io/testpolicy-direct-backref": "gw-ns/policy-1",
+				"kuadrant.io/testpolicies":              `[{"Namespace":"gw-ns","Name":"policy-1"},{"Namespace":"app-ns","Name":"policy-stale"}]`,
+			},
+		},
+	}
+
+	attachedRoute := &gatewayapiv1beta1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "app-ns",
+			Name:        "route-1",
+			Annotations: map[string]string{"kuadrant.io/testpolicy-direct-backref": "app-ns/policy-2"},
+		},
+		Spec: gatewayapiv1beta1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayapiv1beta1.CommonRouteSpec{
+				ParentRefs: []gatewayapiv1beta1.ParentReference{{Name: "gw-1", Namespace: &gwNamespace}},
+			},
+		},
+	}
+
+	otherRoute := &gatewayapiv1beta1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "app-ns",
+			Name:        "route-2",
+			Annotations: map[string]string{"kuadrant.io/testpolicy-direct-backref": "app-ns/policy-3"},
+		},
+		Spec: gatewayapiv1beta1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayapiv1beta1.CommonRouteSpec{
+				ParentRefs: []gatewayapiv1beta1.ParentReference{{Name: "gw-2", Namespace: &gwNamespace}},
+			},
+		},
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithIndex(&gatewayapiv1beta1.HTTPRoute{}, common.HTTPRouteParentRefsIndexField, common.HTTPRouteParentRefsIndexerFunc).WithRuntimeObjects(gateway, attachedRoute, otherRoute).Build()
+
+	diffs, err := ComputePolicyDiffsForGateway(ctx, cl, gateway, []common.Referrer{&common.PolicyKindStub{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diffs) != 1 {
+		t.Fatalf("policy diffs length is %d and it was expected to be 1", len(diffs))
+	}
+
+	diff := diffs[0]
+
+	if expected := []client.ObjectKey{{Namespace: "app-ns", Name: "policy-2"}}; !reflect.DeepEqual(diff.PoliciesMissingGatewayRef, expected) {
+		t.Errorf("policies missing gateway ref (%v) do not match expected (%v)", diff.PoliciesMissingGatewayRef, expected)
+	}
+	if expected := []client.ObjectKey{{Namespace: "gw-ns", Name: "policy-1"}}; !reflect.DeepEqual(diff.PoliciesWithValidGatewayRef, expected) {
+		t.Errorf("policies with valid gateway ref (%v) do not match expected (%v)", diff.PoliciesWithValidGatewayRef, expected)
+	}
+	if expected := []client.ObjectKey{{Namespace: "app-ns", Name: "policy-stale"}}; !reflect.DeepEqual(diff.PoliciesWithInvalidGatewayRef, expected) {
+		t.Errorf("policies with invalid gateway ref (%v) do not match expected (%v)", diff.PoliciesWithInvalidGatewayRef, expected)
+	}
+}
+
+func TestPoliciesTargetingGateway(t *testing.T) {
+	gateway := &gatewayapiv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "gw-ns",
+			Name:      "gw-1",
+		},
+	}
+
+	routes := []*gatewayapiv1beta1.HTTPRoute{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "app-ns",
+				Name:      "route-1",
+				Annotations: map[string]string{
+					"kuadrant.io/testpolicy-direct-backref": "app-ns/policy-1",
+					"kuadrant.io/testpolicies":              `[{"Namespace":"app-ns","Name":"policy-1"},{"Namespace":"app-ns","Name":"policy-2"}]`,
+				},
+			},
+		},
+	}
+
+	policyKeys := common.Map(policiesTargetingGateway(gateway, routes, &common.PolicyKindStub{}, common.BackReferencesFromObject), func(key client.ObjectKey) string { return key.String() })
+
+	if expected := []string{"app-ns/policy-1", "app-ns/policy-2"}; !reflect.DeepEqual(policyKeys, expected) {
+		t.Errorf("policies targeting the gateway (%v) do not match expected (%v)", policyKeys, expected)
+	}
+}
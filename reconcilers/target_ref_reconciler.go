@@ -2,9 +2,12 @@ package reconcilers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
 
 	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/kuadrant/controller-runtime-ext/common"
@@ -12,6 +15,9 @@ import (
 
 type TargetRefReconciler struct {
 	client.Client
+	// BackReferenceStores selects where the back references from the gateways to the policies of each kind are stored.
+	// If nil, the back references are stored in the annotations of the gateways.
+	BackReferenceStores *BackReferenceStores
 }
 
 // ReconcileTargetBackReference adds the policy key in the annotations of the target object
@@ -70,9 +76,17 @@ func (r *TargetRefReconciler) DeleteTargetBackReference(ctx context.Context, pol
 func (r *TargetRefReconciler) ReconcileGatewayPolicyReferences(ctx context.Context, policy client.Object, gwDiffObj *GatewayDiffs) error {
 	logger, _ := logr.FromContext(ctx)
 
+	if r.BackReferenceStores != nil {
+		return r.reconcileStoredGatewayPolicyReferences(ctx, policy, gwDiffObj)
+	}
+
 	// delete the policy from the annotations of the gateways no longer targeted by the policy
 	for _, gw := range gwDiffObj.GatewaysWithInvalidPolicyRef {
-		if gw.DeletePolicy(client.ObjectKeyFromObject(policy)) {
+		deleted, err := gw.DeletePolicyWithError(client.ObjectKeyFromObject(policy))
+		if err != nil {
+			return err
+		}
+		if deleted {
 			err := r.Client.Update(ctx, gw.Gateway)
 			logger.V(1).Info("ReconcileGatewayPolicyReferences: update gateway", "gateway with invalid policy ref", gw.Key(), "err", err)
 			if err != nil {
@@ -83,7 +97,11 @@ func (r *TargetRefReconciler) ReconcileGatewayPolicyReferences(ctx context.Conte
 
 	// add the policy to the annotations of the gateways targeted by the policy
 	for _, gw := range gwDiffObj.GatewaysMissingPolicyRef {
-		if gw.AddPolicy(client.ObjectKeyFromObject(policy)) {
+		added, err := gw.AddPolicyWithError(client.ObjectKeyFromObject(policy))
+		if err != nil {
+			return err
+		}
+		if added {
 			err := r.Client.Update(ctx, gw.Gateway)
 			logger.V(1).Info("ReconcileGatewayPolicyReferences: update gateway", "gateway missinf policy ref", gw.Key(), "err", err)
 			if err != nil {
@@ -94,3 +112,198 @@ func (r *TargetRefReconciler) ReconcileGatewayPolicyReferences(ctx context.Conte
 
 	return nil
 }
+
+// reconcileStoredGatewayPolicyReferences is ReconcileGatewayPolicyReferences for the back references kept in the store of the kind of policy.
+// Only the policy is added to or removed from the back references, re-applied on conflict, so the changes made concurrently by other policies are kept.
+// It waits for the migration of the back references to the stores, if any, before writing to them.
+func (r *TargetRefReconciler) reconcileStoredGatewayPolicyReferences(ctx context.Context, policy client.Object, gwDiffObj *GatewayDiffs) error {
+	if err := r.BackReferenceStores.WaitForMigration(ctx); err != nil {
+		return err
+	}
+
+	policyKey := client.ObjectKeyFromObject(policy)
+
+	for _, gw := range gwDiffObj.GatewaysWithInvalidPolicyRef {
+		if err := r.BackReferenceStores.For(gw.Referrer).UpdateBackReferences(ctx, gw.Gateway, gw.Referrer, RemoveBackReferences(policyKey)); err != nil {
+			return err
+		}
+	}
+
+	for _, gw := range gwDiffObj.GatewaysMissingPolicyRef {
+		if err := r.BackReferenceStores.For(gw.Referrer).UpdateBackReferences(ctx, gw.Gateway, gw.Referrer, AddBackReferences(policyKey)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lookupOptions applies the lookup options, reading the back references from the stores of the reconciler unless set otherwise
+func (r *TargetRefReconciler) lookupOptions(o ...lookupOption) lookupOptions {
+	opts := applyLookupOptions(o...)
+	if opts.backReferenceStores == nil {
+		opts.backReferenceStores = r.BackReferenceStores
+	}
+	return opts
+}
+
+// ReconcilePolicy reconciles all the back references to a policy, driven by the policy object only:
+// * fetches the network objects targeted by the policy (target objects not found or not valid targets are considered deleted,
+// except for gateways only temporarily not ready, see ErrTargetNotReady)
+// * if the policy is a DirectReferrer, adds the policy key to the direct back reference annotation of the targets;
+// a target already referenced by another policy of the kind goes to the policy that takes precedence (see ResolveTargetBackReference),
+// and the targets the policy lost are not considered targeted by the policy.
+// The direct back references to the policy from the objects it no longer targets, or from all the objects if the policy is being deleted, are removed.
+// * if the policy attachment mode is InheritedAttachment, computes the gateway diffs and updates the back reference annotations of the gateways;
+// the gateways only temporarily not ready keep their back references to the policy but do not get new ones
+// Returns the gateway diffs, nil if the policy attachment mode is DirectAttachment, and the first conflict lost by the policy, if any.
+// Waits for the migration of the back references to the stores of the reconciler, if any.
+func (r *TargetRefReconciler) ReconcilePolicy(ctx context.Context, policy common.Policy, o ...lookupOption) (*GatewayDiffs, *PolicyConflict, error) {
+	logger, _ := logr.FromContext(ctx)
+
+	// the back references are not computed from the stores before the migration to the stores is done
+	if err := r.BackReferenceStores.WaitForMigration(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	policyKey := client.ObjectKeyFromObject(policy)
+	deleting := policy.GetDeletionTimestamp() != nil
+
+	targetNetworkObjects := make([]client.Object, 0, len(policy.GetTargetRefs()))
+	notReadyTargetNetworkObjects := make([]client.Object, 0)
+	for _, targetRef := range policy.GetTargetRefs() {
+		targetNetworkObject, err := FetchTargetRefObject(ctx, r.Client, targetRef, policy.GetNamespace(), o...)
+		if errors.Is(err, ErrTargetNotReady) {
+			logger.V(1).Info("ReconcilePolicy: target network object not ready", "policy", policyKey, "targetRef", targetRef, "err", err)
+			notReadyTargetNetworkObjects = append(notReadyTargetNetworkObjects, targetNetworkObject)
+			continue
+		}
+		if err != nil {
+			if apierrors.IsNotFound(err) || errors.Is(err, ErrInvalidTargetRef) {
+				logger.V(1).Info("ReconcilePolicy: target network object not found or not valid", "policy", policyKey, "targetRef", targetRef, "err", err)
+				continue
+			}
+			return nil, nil, err
+		}
+		targetNetworkObjects = append(targetNetworkObjects, targetNetworkObject)
+	}
+
+	var lostConflict *PolicyConflict
+	if directReferrer, ok := policy.(common.DirectReferrer); ok {
+		annotationName := directReferrer.DirectReferenceAnnotationName()
+		wonTargetNetworkObjects := make([]client.Object, 0, len(targetNetworkObjects))
+		for _, targetNetworkObject := range targetNetworkObjects {
+			if deleting {
+				continue
+			}
+			conflict, err := r.ResolveTargetBackReference(ctx, policy, targetNetworkObject, annotationName, newObjectOfKind(policy))
+			if err != nil {
+				return nil, nil, err
+			}
+			if conflict != nil && conflict.Lost(policy) {
+				logger.V(1).Info("ReconcilePolicy: target network object referenced by a policy that takes precedence", "policy", policyKey, "target", client.ObjectKeyFromObject(targetNetworkObject), "winner", client.ObjectKeyFromObject(conflict.Winner))
+				if lostConflict == nil {
+					lostConflict = conflict
+				}
+				continue
+			}
+			wonTargetNetworkObjects = append(wonTargetNetworkObjects, targetNetworkObject)
+		}
+		var keptTargetNetworkObjects []client.Object
+		if !deleting {
+			targetNetworkObjects = wonTargetNetworkObjects
+			keptTargetNetworkObjects = append(append(keptTargetNetworkObjects, targetNetworkObjects...), notReadyTargetNetworkObjects...)
+		}
+		if err := r.deleteStaleTargetBackReferences(ctx, policyKey, directReferrer, keptTargetNetworkObjects, o...); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if policy.GetAttachmentMode() == common.DirectAttachment {
+		return nil, lostConflict, nil
+	}
+
+	opts := r.lookupOptions(o...)
+	gwDiffObj, err := computeGatewayDiffs(ctx, r.Client, policy, policy, append(targetNetworkObjects, notReadyTargetNetworkObjects...), opts.backReferences(ctx), opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	withoutNotReadyGateways(gwDiffObj, targetNetworkObjects, notReadyTargetNetworkObjects)
+
+	if err := r.ReconcileGatewayPolicyReferences(ctx, policy, gwDiffObj); err != nil {
+		return nil, nil, err
+	}
+
+	return gwDiffObj, lostConflict, nil
+}
+
+// deleteStaleTargetBackReferences removes the direct back reference to the policy from the gateways and httproutes in scope
+// that are not among the kept target network objects
+func (r *TargetRefReconciler) deleteStaleTargetBackReferences(ctx context.Context, policyKey client.ObjectKey, directReferrer common.DirectReferrer, keptTargetNetworkObjects []client.Object, o ...lookupOption) error {
+	logger, _ := logr.FromContext(ctx)
+
+	opts := r.lookupOptions(o...)
+	gwList, err := opts.listGateways(ctx, r.Client)
+	if err != nil {
+		return err
+	}
+	routeList, err := opts.listHTTPRoutes(ctx, r.Client)
+	if err != nil {
+		return err
+	}
+
+	objs := make([]client.Object, 0, len(gwList.Items)+len(routeList.Items))
+	for i := range gwList.Items {
+		objs = append(objs, &gwList.Items[i])
+	}
+	for i := range routeList.Items {
+		objs = append(objs, &routeList.Items[i])
+	}
+
+	for _, obj := range objs {
+		if ref, found := common.DirectReferenceFromObject(obj, directReferrer); !found || ref != policyKey || containsObject(keptTargetNetworkObjects, obj) {
+			continue
+		}
+		logger.V(1).Info("ReconcilePolicy: removing stale direct back reference", "policy", policyKey, "object", client.ObjectKeyFromObject(obj))
+		if err := r.DeleteTargetBackReference(ctx, policyKey, obj, directReferrer.DirectReferenceAnnotationName()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// containsObject tells whether an object of the same type and with the same key as obj is in the list
+func containsObject(objs []client.Object, obj client.Object) bool {
+	for _, o := range objs {
+		if reflect.TypeOf(o) == reflect.TypeOf(obj) && client.ObjectKeyFromObject(o) == client.ObjectKeyFromObject(obj) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutNotReadyGateways removes the gateways only temporarily not ready, and not otherwise targeted, from the gateways missing the back reference
+// to the policy, so they keep the back references they have but do not get new ones until they are ready again
+func withoutNotReadyGateways(gwDiffObj *GatewayDiffs, targetNetworkObjects, notReadyTargetNetworkObjects []client.Object) {
+	if len(notReadyTargetNetworkObjects) == 0 {
+		return
+	}
+	missing := make([]GatewayWrapper, 0, len(gwDiffObj.GatewaysMissingPolicyRef))
+	for _, gw := range gwDiffObj.GatewaysMissingPolicyRef {
+		if containsObject(notReadyTargetNetworkObjects, gw.Gateway) && targetingNetworkObject(targetNetworkObjects, gw.Key()) == nil {
+			delete(gwDiffObj.Reasons, gw.Key())
+			continue
+		}
+		missing = append(missing, gw)
+	}
+	gwDiffObj.GatewaysMissingPolicyRef = missing
+}
+
+// newObjectOfKind returns a function that returns empty objects of the same type as the given object
+func newObjectOfKind(obj client.Object) func() client.Object {
+	objType := reflect.TypeOf(obj).Elem()
+	return func() client.Object {
+		return reflect.New(objType).Interface().(client.Object)
+	}
+}
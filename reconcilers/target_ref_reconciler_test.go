@@ -3,16 +3,21 @@ package reconcilers
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
 )
 
 func TestReconcileTargetBackReference(t *testing.T) {
@@ -204,3 +209,265 @@ func TestDeleteTargetBackReference(t *testing.T) {
 		}
 	}
 }
+
+func TestReconcilePolicy(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), log.Log)
+
+	err := gatewayapiv1beta1.AddToScheme(scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policyKind := &common.PolicyKindStub{}
+	policyKey := client.ObjectKey{Namespace: "gw-ns", Name: "policy-1"}
+
+	newClient := func() client.Client {
+		return fake.NewFakeClient(
+			&gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1"}},
+			&gatewayapiv1beta1.Gateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "gw-ns",
+					Name:        "gw-2",
+					Annotations: map[string]string{"kuadrant.io/testpolicies": `[{"Namespace":"gw-ns","Name":"policy-1"}]`},
+				},
+			},
+		)
+	}
+
+	newPolicy := func(mode common.AttachmentMode) *common.PolicyStub {
+		return &common.PolicyStub{
+			ObjectMeta: metav1.ObjectMeta{Namespace: policyKey.Namespace, Name: policyKey.Name},
+			Spec: common.PolicyStubSpec{
+				TargetRef:      gatewayapiv1alpha2.PolicyTargetReference{Group: gatewayapiv1beta1.GroupName, Kind: "Gateway", Name: "gw-1"},
+				AttachmentMode: mode,
+			},
+		}
+	}
+
+	fetchGateway := func(cl client.Client, name string) *gatewayapiv1beta1.Gateway {
+		gw := &gatewayapiv1beta1.Gateway{}
+		if err := cl.Get(ctx, client.ObjectKey{Namespace: "gw-ns", Name: name}, gw); err != nil {
+			t.Fatal(err)
+		}
+		return gw
+	}
+
+	t.Run("when the policy attachment is inherited then reconcile the direct and the gateway back references", func(t *testing.T) {
+		cl := newClient()
+		r := &TargetRefReconciler{Client: cl}
+
+		gwDiffObj, _, err := r.ReconcilePolicy(ctx, newPolicy(common.InheritedAttachment))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gwDiffObj == nil || len(gwDiffObj.GatewaysMissingPolicyRef) != 1 || len(gwDiffObj.GatewaysWithInvalidPolicyRef) != 1 {
+			t.Errorf("unexpected gateway diffs: %v", gwDiffObj)
+		}
+
+		gw1 := fetchGateway(cl, "gw-1")
+		if ref, found := common.DirectReferenceFromObject(gw1, policyKind); !found || ref != policyKey {
+			t.Errorf("expected gw-1 to be directly referenced by %s, but got %s", policyKey, ref)
+		}
+		if refs := common.BackReferencesFromObject(gw1, policyKind); !common.Contains(refs, policyKey) {
+			t.Errorf("expected gw-1 back references (%v) to contain %s", refs, policyKey)
+		}
+		if refs := common.BackReferencesFromObject(fetchGateway(cl, "gw-2"), policyKind); common.Contains(refs, policyKey) {
+			t.Errorf("expected gw-2 back references (%v) not to contain %s", refs, policyKey)
+		}
+
+		deletedPolicy := newPolicy(common.InheritedAttachment)
+		deletedPolicy.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		if _, _, err := r.ReconcilePolicy(ctx, deletedPolicy); err != nil {
+			t.Fatal(err)
+		}
+
+		gw1 = fetchGateway(cl, "gw-1")
+		if _, found := common.DirectReferenceFromObject(gw1, policyKind); found {
+			t.Error("expected gw-1 direct back reference to be removed")
+		}
+		if refs := common.BackReferencesFromObject(gw1, policyKind); common.Contains(refs, policyKey) {
+			t.Errorf("expected gw-1 back references (%v) not to contain %s", refs, policyKey)
+		}
+	})
+
+	t.Run("when the policy attachment is direct then reconcile the direct back reference only", func(t *testing.T) {
+		cl := newClient()
+		r := &TargetRefReconciler{Client: cl}
+
+		gwDiffObj, _, err := r.ReconcilePolicy(ctx, newPolicy(common.DirectAttachment))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gwDiffObj != nil {
+			t.Errorf("expected no gateway diffs, but got %v", gwDiffObj)
+		}
+
+		gw1 := fetchGateway(cl, "gw-1")
+		if ref, found := common.DirectReferenceFromObject(gw1, policyKind); !found || ref != policyKey {
+			t.Errorf("expected gw-1 to be directly referenced by %s, but got %s", policyKey, ref)
+		}
+		if refs := common.BackReferencesFromObject(gw1, policyKind); len(refs) != 0 {
+			t.Errorf("expected gw-1 to have no back references, but got %v", refs)
+		}
+	})
+
+	t.Run("when the target does not exist then remove the gateway back references", func(t *testing.T) {
+		cl := newClient()
+		r := &TargetRefReconciler{Client: cl}
+
+		policy := newPolicy(common.InheritedAttachment)
+		policy.Spec.TargetRef.Name = "gw-3"
+		gwDiffObj, _, err := r.ReconcilePolicy(ctx, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason := gwDiffObj.Reason(client.ObjectKey{Namespace: "gw-ns", Name: "gw-2"}); reason.Type != GatewayTargetDeleted {
+			t.Errorf("reason (%+v) expected to be %s", reason, GatewayTargetDeleted)
+		}
+	})
+
+	t.Run("when the target is directly referenced by a policy that takes precedence then report the conflict and remove the gateway back references", func(t *testing.T) {
+		s := runtime.NewScheme()
+		if err := scheme.AddToScheme(s); err != nil {
+			t.Fatal(err)
+		}
+		if err := gatewayapiv1beta1.AddToScheme(s); err != nil {
+			t.Fatal(err)
+		}
+		s.AddKnownTypes(schema.GroupVersion{Group: "kuadrant.io", Version: "v1"}, &common.PolicyStub{})
+
+		winner := newPolicy(common.InheritedAttachment)
+		winner.ObjectMeta = metav1.ObjectMeta{Namespace: "gw-ns", Name: "policy-0", CreationTimestamp: metav1.Time{Time: time.Now().Add(-time.Hour)}}
+		cl := fake.NewClientBuilder().WithScheme(s).WithObjects(
+			winner,
+			&gatewayapiv1beta1.Gateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "gw-ns",
+					Name:      "gw-1",
+					Annotations: map[string]string{
+						"kuadrant.io/testpolicy-direct-backref": "gw-ns/policy-0",
+						"kuadrant.io/testpolicies":              `[{"Namespace":"gw-ns","Name":"policy-0"},{"Namespace":"gw-ns","Name":"policy-1"}]`,
+					},
+				},
+			},
+		).Build()
+		r := &TargetRefReconciler{Client: cl}
+
+		policy := newPolicy(common.InheritedAttachment)
+		policy.CreationTimestamp = metav1.Time{Time: time.Now()}
+		gwDiffObj, conflict, err := r.ReconcilePolicy(ctx, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conflict == nil || !conflict.Lost(policy) || client.ObjectKeyFromObject(conflict.Winner) != client.ObjectKeyFromObject(winner) {
+			t.Errorf("expected the policy to lose the conflict to %s, but got %v", client.ObjectKeyFromObject(winner), conflict)
+		}
+		if len(gwDiffObj.GatewaysWithInvalidPolicyRef) != 1 {
+			t.Errorf("unexpected gateway diffs: %v", gwDiffObj)
+		}
+
+		gw1 := fetchGateway(cl, "gw-1")
+		if ref, _ := common.DirectReferenceFromObject(gw1, policyKind); ref != client.ObjectKeyFromObject(winner) {
+			t.Errorf("expected gw-1 to be directly referenced by the winner, but got %s", ref)
+		}
+		if refs := common.BackReferencesFromObject(gw1, policyKind); common.Contains(refs, policyKey) || !common.Contains(refs, client.ObjectKeyFromObject(winner)) {
+			t.Errorf("expected gw-1 back references (%v) to contain the winner only", refs)
+		}
+	})
+
+	t.Run("when the target is not valid and the policy is deleted then remove the gateway back references", func(t *testing.T) {
+		cl := newClient()
+		r := &TargetRefReconciler{Client: cl}
+
+		policy := newPolicy(common.InheritedAttachment)
+		policy.Spec.TargetRef.Kind = "TCPRoute"
+		policy.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		if _, _, err := r.ReconcilePolicy(ctx, policy); err != nil {
+			t.Fatal(err)
+		}
+		if refs := common.BackReferencesFromObject(fetchGateway(cl, "gw-2"), policyKind); common.Contains(refs, policyKey) {
+			t.Errorf("expected gw-2 back references (%v) not to contain %s", refs, policyKey)
+		}
+	})
+
+	t.Run("when the target changes or is no longer valid then remove the direct back reference from the previous target", func(t *testing.T) {
+		cl := newClient()
+		r := &TargetRefReconciler{Client: cl}
+
+		if _, _, err := r.ReconcilePolicy(ctx, newPolicy(common.InheritedAttachment)); err != nil {
+			t.Fatal(err)
+		}
+
+		policy := newPolicy(common.InheritedAttachment)
+		policy.Spec.TargetRef.Name = "gw-2"
+		if _, _, err := r.ReconcilePolicy(ctx, policy); err != nil {
+			t.Fatal(err)
+		}
+		gw1 := fetchGateway(cl, "gw-1")
+		if ref, found := common.DirectReferenceFromObject(gw1, policyKind); found {
+			t.Errorf("expected gw-1 direct back reference to be removed, but got %s", ref)
+		}
+		if refs := common.BackReferencesFromObject(gw1, policyKind); common.Contains(refs, policyKey) {
+			t.Errorf("expected gw-1 back references (%v) not to contain %s", refs, policyKey)
+		}
+		if ref, found := common.DirectReferenceFromObject(fetchGateway(cl, "gw-2"), policyKind); !found || ref != policyKey {
+			t.Errorf("expected gw-2 to be directly referenced by %s, but got %s", policyKey, ref)
+		}
+
+		deletedPolicy := newPolicy(common.InheritedAttachment)
+		deletedPolicy.Spec.TargetRef.Kind = "TCPRoute"
+		deletedPolicy.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		if _, _, err := r.ReconcilePolicy(ctx, deletedPolicy); err != nil {
+			t.Fatal(err)
+		}
+		if ref, found := common.DirectReferenceFromObject(fetchGateway(cl, "gw-2"), policyKind); found {
+			t.Errorf("expected gw-2 direct back reference to be removed, but got %s", ref)
+		}
+	})
+
+	t.Run("when the gateway is not programmed then keep its back references without adding new ones", func(t *testing.T) {
+		notProgrammed := gatewayapiv1beta1.GatewayStatus{
+			Conditions: []metav1.Condition{{Type: string(gatewayapiv1beta1.GatewayConditionProgrammed), Status: metav1.ConditionFalse, Reason: "Pending"}},
+		}
+		cl := fake.NewFakeClient(
+			&gatewayapiv1beta1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1"}, Status: notProgrammed},
+			&gatewayapiv1beta1.Gateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "gw-ns",
+					Name:      "gw-2",
+					Annotations: map[string]string{
+						"kuadrant.io/testpolicy-direct-backref": "gw-ns/policy-1",
+						"kuadrant.io/testpolicies":              `[{"Namespace":"gw-ns","Name":"policy-1"}]`,
+					},
+				},
+				Status: notProgrammed,
+			},
+		)
+		r := &TargetRefReconciler{Client: cl}
+
+		policy := newPolicy(common.InheritedAttachment)
+		policy.Spec.TargetRefs = []gatewayapiv1alpha2.PolicyTargetReference{
+			{Group: gatewayapiv1beta1.GroupName, Kind: "Gateway", Name: "gw-1"},
+			{Group: gatewayapiv1beta1.GroupName, Kind: "Gateway", Name: "gw-2"},
+		}
+		gwDiffObj, _, err := r.ReconcilePolicy(ctx, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(gwDiffObj.GatewaysMissingPolicyRef) != 0 || len(gwDiffObj.GatewaysWithValidPolicyRef) != 1 || len(gwDiffObj.GatewaysWithInvalidPolicyRef) != 0 {
+			t.Errorf("unexpected gateway diffs: %v", gwDiffObj)
+		}
+
+		gw1 := fetchGateway(cl, "gw-1")
+		if refs := common.BackReferencesFromObject(gw1, policyKind); len(refs) != 0 {
+			t.Errorf("expected gw-1 to have no back references, but got %v", refs)
+		}
+		gw2 := fetchGateway(cl, "gw-2")
+		if ref, found := common.DirectReferenceFromObject(gw2, policyKind); !found || ref != policyKey {
+			t.Errorf("expected gw-2 to be directly referenced by %s, but got %s", policyKey, ref)
+		}
+		if refs := common.BackReferencesFromObject(gw2, policyKind); !common.Contains(refs, policyKey) {
+			t.Errorf("expected gw-2 back references (%v) to contain %s", refs, policyKey)
+		}
+	})
+}
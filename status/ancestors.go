@@ -0,0 +1,195 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+// MaxPolicyAncestors is the maximum number of ancestors in the status of a policy, as limited by the Gateway API spec
+const MaxPolicyAncestors = 16
+
+// PolicyAncestorStatus is the status of a policy with respect to one of its ancestors, as reported by one controller.
+// It mirrors the PolicyAncestorStatus type of Gateway API v0.8+, with the same serialization.
+type PolicyAncestorStatus struct {
+	// AncestorRef is the reference to the ancestor (typically a gateway) the status refers to
+	AncestorRef gatewayapiv1beta1.ParentReference `json:"ancestorRef"`
+	// ControllerName is the name of the controller that wrote the status
+	ControllerName gatewayapiv1beta1.GatewayController `json:"controllerName"`
+	// Conditions describe the status of the policy with respect to the ancestor
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// PolicyAncestors returns the ancestors of a policy, i.e. the gateways the policy applies to:
+// the gateways targeted directly and the parent gateways of the httproutes targeted.
+// Targets not found are skipped. The ancestors are fully qualified (group, kind and namespace set) and deduplicated.
+func PolicyAncestors(ctx context.Context, k8sClient client.Reader, policy common.Policy) ([]gatewayapiv1beta1.ParentReference, error) {
+	ancestors := make([]gatewayapiv1beta1.ParentReference, 0)
+	add := func(ref gatewayapiv1beta1.ParentReference, defaultNs string) {
+		ref = normalizeAncestorRef(ref, defaultNs)
+		if _, found := common.Find(ancestors, func(a gatewayapiv1beta1.ParentReference) bool { return ancestorKey(a) == ancestorKey(ref) }); !found {
+			ancestors = append(ancestors, ref)
+		}
+	}
+
+	for _, targetRef := range policy.GetTargetRefs() {
+		ns := policy.GetNamespace()
+		if targetRef.Namespace != nil {
+			ns = string(*targetRef.Namespace)
+		}
+		switch targetRef.Kind {
+		case "Gateway":
+			add(gatewayapiv1beta1.ParentReference{Name: gatewayapiv1beta1.ObjectName(targetRef.Name)}, ns)
+		case "HTTPRoute":
+			route := &gatewayapiv1beta1.HTTPRoute{}
+			if err := k8sClient.Get(ctx, client.ObjectKey{Namespace: ns, Name: string(targetRef.Name)}, route); err != nil {
+				if client.IgnoreNotFound(err) == nil {
+					continue
+				}
+				return nil, err
+			}
+			for _, parentRef := range route.Spec.ParentRefs {
+				if parentRef.Kind != nil && *parentRef.Kind != "Gateway" {
+					continue
+				}
+				add(parentRef, route.Namespace)
+			}
+		}
+	}
+
+	return ancestors, nil
+}
+
+// SetAncestorCondition sets a condition in the status of a policy with respect to an ancestor, as reported by a controller,
+// adding the ancestor status if missing. The ancestor reference is normalized (group, kind and namespace set), defaulting to the namespace of the policy.
+func SetAncestorCondition(ancestors []PolicyAncestorStatus, ancestorRef gatewayapiv1beta1.ParentReference, policyNamespace string, controllerName gatewayapiv1beta1.GatewayController, condition metav1.Condition) []PolicyAncestorStatus {
+	ancestorRef = normalizeAncestorRef(ancestorRef, policyNamespace)
+	for i := range ancestors {
+		if ancestors[i].ControllerName == controllerName && ancestorKey(normalizeAncestorRef(ancestors[i].AncestorRef, policyNamespace)) == ancestorKey(ancestorRef) {
+			ancestors[i].AncestorRef = ancestorRef
+			meta.SetStatusCondition(&ancestors[i].Conditions, condition)
+			return ancestors
+		}
+	}
+	ancestorStatus := PolicyAncestorStatus{AncestorRef: ancestorRef, ControllerName: controllerName}
+	meta.SetStatusCondition(&ancestorStatus.Conditions, condition)
+	return append(ancestors, ancestorStatus)
+}
+
+// ReconcileAncestors updates the ancestor statuses reported by a controller: sets the conditions for each of the ancestors,
+// removes the statuses of the controller for ancestors no longer in the list, and keeps the statuses reported by other controllers.
+// Ancestor references are normalized, defaulting to the namespace of the policy.
+// The statuses of the controller are capped to the room left by the other controllers within MaxPolicyAncestors, dropping the last ones
+// sorted by ancestor, so the truncation is deterministic; the statuses of other controllers are never dropped. The result is sorted by ancestor and controller.
+// Returns the number of ancestor statuses of the controller dropped.
+func ReconcileAncestors(current []PolicyAncestorStatus, ancestorRefs []gatewayapiv1beta1.ParentReference, policyNamespace string, controllerName gatewayapiv1beta1.GatewayController, conditions ...metav1.Condition) ([]PolicyAncestorStatus, int) {
+	wanted := make(map[string]struct{}, len(ancestorRefs))
+	for _, ref := range ancestorRefs {
+		wanted[ancestorKey(normalizeAncestorRef(ref, policyNamespace))] = struct{}{}
+	}
+
+	others := make([]PolicyAncestorStatus, 0, len(current))
+	owned := make([]PolicyAncestorStatus, 0, len(ancestorRefs))
+	for _, ancestorStatus := range current {
+		if ancestorStatus.ControllerName != controllerName {
+			others = append(others, *ancestorStatus.DeepCopy())
+			continue
+		}
+		if _, ok := wanted[ancestorKey(normalizeAncestorRef(ancestorStatus.AncestorRef, policyNamespace))]; ok {
+			owned = append(owned, *ancestorStatus.DeepCopy())
+		}
+	}
+
+	for _, ref := range ancestorRefs {
+		for _, condition := range conditions {
+			owned = SetAncestorCondition(owned, ref, policyNamespace, controllerName, condition)
+		}
+	}
+
+	sortAncestors(owned)
+
+	dropped := 0
+	if room := MaxPolicyAncestors - len(others); len(owned) > room {
+		if room < 0 {
+			room = 0
+		}
+		dropped = len(owned) - room
+		owned = owned[:room]
+	}
+
+	ancestors := append(others, owned...)
+	sortAncestors(ancestors)
+	return ancestors, dropped
+}
+
+// sortAncestors sorts ancestor statuses by ancestor and controller
+func sortAncestors(ancestors []PolicyAncestorStatus) {
+	sort.SliceStable(ancestors, func(i, j int) bool {
+		ki, kj := ancestorKey(ancestors[i].AncestorRef), ancestorKey(ancestors[j].AncestorRef)
+		if ki != kj {
+			return ki < kj
+		}
+		return ancestors[i].ControllerName < ancestors[j].ControllerName
+	})
+}
+
+// DeepCopy returns a deep copy of the ancestor status
+func (in *PolicyAncestorStatus) DeepCopy() *PolicyAncestorStatus {
+	out := &PolicyAncestorStatus{ControllerName: in.ControllerName}
+	in.AncestorRef.DeepCopyInto(&out.AncestorRef)
+	if in.Conditions != nil {
+		out.Conditions = make([]metav1.Condition, len(in.Conditions))
+		for i := range in.Conditions {
+			in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+	return out
+}
+
+// normalizeAncestorRef sets the default group, kind and namespace of an ancestor reference
+func normalizeAncestorRef(ref gatewayapiv1beta1.ParentReference, defaultNs string) gatewayapiv1beta1.ParentReference {
+	ref = *ref.DeepCopy()
+	if ref.Group == nil {
+		group := gatewayapiv1beta1.Group(gatewayapiv1beta1.GroupName)
+		ref.Group = &group
+	}
+	if ref.Kind == nil {
+		kind := gatewayapiv1beta1.Kind("Gateway")
+		ref.Kind = &kind
+	}
+	if ref.Namespace == nil {
+		ns := gatewayapiv1beta1.Namespace(defaultNs)
+		ref.Namespace = &ns
+	}
+	return ref
+}
+
+// ancestorKey returns a string that identifies an ancestor reference, in the <group>/<kind>/<namespace>/<name>#<section> format,
+// followed by :<port> if the reference sets a port
+func ancestorKey(ref gatewayapiv1beta1.ParentReference) string {
+	var group, kind, ns, section string
+	if ref.Group != nil {
+		group = string(*ref.Group)
+	}
+	if ref.Kind != nil {
+		kind = string(*ref.Kind)
+	}
+	if ref.Namespace != nil {
+		ns = string(*ref.Namespace)
+	}
+	if ref.SectionName != nil {
+		section = string(*ref.SectionName)
+	}
+	key := fmt.Sprintf("%s/%s/%s/%s#%s", group, kind, ns, ref.Name, section)
+	if ref.Port != nil {
+		key = fmt.Sprintf("%s:%d", key, *ref.Port)
+	}
+	return key
+}
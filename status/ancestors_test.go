@@ -0,0 +1,181 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func TestPolicyAncestors(t *testing.T) {
+	err := gatewayapiv1beta1.AddToScheme(scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gwNamespace := gatewayapiv1beta1.Namespace("gw-ns")
+
+	cl := fake.NewFakeClient(&gatewayapiv1beta1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "route-1"},
+		Spec: gatewayapiv1beta1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayapiv1beta1.CommonRouteSpec{
+				ParentRefs: []gatewayapiv1beta1.ParentReference{{Name: "gw-1", Namespace: &gwNamespace}, {Name: "gw-2"}},
+			},
+		},
+	})
+
+	newPolicy := func(kind, name string) *common.PolicyStub {
+		return &common.PolicyStub{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "policy-1"},
+			Spec:       common.PolicyStubSpec{TargetRef: gatewayapiv1alpha2.PolicyTargetReference{Kind: gatewayapiv1alpha2.Kind(kind), Name: gatewayapiv1alpha2.ObjectName(name)}},
+		}
+	}
+
+	t.Run("when the policy targets a route then the ancestors are the parent gateways of the route", func(t *testing.T) {
+		ancestors, err := PolicyAncestors(context.Background(), cl, newPolicy("HTTPRoute", "route-1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := common.Map(ancestors, ancestorKey)
+		expected := []string{"gateway.networking.k8s.io/Gateway/gw-ns/gw-1#", "gateway.networking.k8s.io/Gateway/app-ns/gw-2#"}
+		if len(keys) != len(expected) || keys[0] != expected[0] || keys[1] != expected[1] {
+			t.Errorf("expected ancestors %v, but got %v", expected, keys)
+		}
+	})
+
+	t.Run("when the policy targets a gateway then the ancestor is the gateway", func(t *testing.T) {
+		ancestors, err := PolicyAncestors(context.Background(), cl, newPolicy("Gateway", "gw-3"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ancestors) != 1 || ancestorKey(ancestors[0]) != "gateway.networking.k8s.io/Gateway/app-ns/gw-3#" {
+			t.Errorf("unexpected ancestors %v", ancestors)
+		}
+	})
+
+	t.Run("when the target route does not exist then no ancestors", func(t *testing.T) {
+		ancestors, err := PolicyAncestors(context.Background(), cl, newPolicy("HTTPRoute", "route-2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ancestors) != 0 {
+			t.Errorf("expected no ancestors, but got %v", ancestors)
+		}
+	})
+}
+
+func TestReconcileAncestors(t *testing.T) {
+	const controllerName = gatewayapiv1beta1.GatewayController("kuadrant.io/policy-controller")
+	const otherControllerName = gatewayapiv1beta1.GatewayController("example.com/other-controller")
+
+	gatewayRef := func(name string) gatewayapiv1beta1.ParentReference {
+		return normalizeAncestorRef(gatewayapiv1beta1.ParentReference{Name: gatewayapiv1beta1.ObjectName(name)}, "gw-ns")
+	}
+
+	accepted := metav1.Condition{Type: ConditionAccepted, Status: metav1.ConditionTrue, Reason: ReasonAccepted}
+
+	current := []PolicyAncestorStatus{
+		{AncestorRef: gatewayRef("gw-old"), ControllerName: controllerName, Conditions: []metav1.Condition{accepted}},
+		{AncestorRef: gatewayRef("gw-old"), ControllerName: otherControllerName, Conditions: []metav1.Condition{accepted}},
+	}
+
+	t.Run("when reconciling then replace the statuses of the controller and keep the ones of other controllers", func(t *testing.T) {
+		ancestors, dropped := ReconcileAncestors(current, []gatewayapiv1beta1.ParentReference{gatewayRef("gw-2"), gatewayRef("gw-1")}, "gw-ns", controllerName, accepted)
+		if dropped != 0 {
+			t.Errorf("expected no ancestors dropped, but got %d", dropped)
+		}
+		got := common.Map(ancestors, func(a PolicyAncestorStatus) string { return fmt.Sprintf("%s %s", a.AncestorRef.Name, a.ControllerName) })
+		expected := []string{"gw-1 kuadrant.io/policy-controller", "gw-2 kuadrant.io/policy-controller", "gw-old example.com/other-controller"}
+		if len(got) != len(expected) {
+			t.Fatalf("expected ancestors %v, but got %v", expected, got)
+		}
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Errorf("expected ancestors %v, but got %v", expected, got)
+			}
+		}
+		if len(current[0].Conditions) != 1 {
+			t.Error("expected the current statuses not to be modified")
+		}
+	})
+
+	t.Run("when there are more ancestors than the limit then truncate deterministically", func(t *testing.T) {
+		refs := make([]gatewayapiv1beta1.ParentReference, 0, 20)
+		for i := 19; i >= 0; i-- {
+			refs = append(refs, gatewayRef(fmt.Sprintf("gw-%02d", i)))
+		}
+		ancestors, dropped := ReconcileAncestors(nil, refs, "gw-ns", controllerName, accepted)
+		if len(ancestors) != MaxPolicyAncestors || dropped != 4 {
+			t.Errorf("expected %d ancestors and 4 dropped, but got %d and %d", MaxPolicyAncestors, len(ancestors), dropped)
+		}
+		if ancestors[0].AncestorRef.Name != "gw-00" || ancestors[MaxPolicyAncestors-1].AncestorRef.Name != "gw-15" {
+			t.Errorf("unexpected truncation: first %s, last %s", ancestors[0].AncestorRef.Name, ancestors[MaxPolicyAncestors-1].AncestorRef.Name)
+		}
+	})
+
+	t.Run("when truncating then keep the statuses of other controllers and cap the ones of the controller to the room left", func(t *testing.T) {
+		current := make([]PolicyAncestorStatus, 0, 10)
+		for i := 0; i < 10; i++ {
+			current = append(current, PolicyAncestorStatus{AncestorRef: gatewayRef(fmt.Sprintf("gw-%02d", i)), ControllerName: otherControllerName, Conditions: []metav1.Condition{accepted}})
+		}
+		refs := make([]gatewayapiv1beta1.ParentReference, 0, 10)
+		for i := 0; i < 10; i++ {
+			refs = append(refs, gatewayRef(fmt.Sprintf("gw-%02d", i)))
+		}
+		ancestors, dropped := ReconcileAncestors(current, refs, "gw-ns", controllerName, accepted)
+		if len(ancestors) != MaxPolicyAncestors || dropped != 4 {
+			t.Errorf("expected %d ancestors and 4 dropped, but got %d and %d", MaxPolicyAncestors, len(ancestors), dropped)
+		}
+		others := 0
+		for _, a := range ancestors {
+			if a.ControllerName == otherControllerName {
+				others++
+			}
+		}
+		if others != 10 {
+			t.Errorf("expected the 10 statuses of the other controller to be kept, but got %d", others)
+		}
+	})
+
+	t.Run("when the ancestor references are not normalized then match them with the normalized ones", func(t *testing.T) {
+		ancestors, _ := ReconcileAncestors(current, []gatewayapiv1beta1.ParentReference{{Name: "gw-old"}}, "gw-ns", controllerName, accepted)
+		if len(ancestors) != 2 {
+			t.Fatalf("expected 2 ancestors, but got %v", ancestors)
+		}
+		for _, a := range ancestors {
+			if a.AncestorRef.Namespace == nil || *a.AncestorRef.Namespace != "gw-ns" || a.AncestorRef.Kind == nil || *a.AncestorRef.Kind != "Gateway" {
+				t.Errorf("expected a normalized ancestor reference, but got %+v", a.AncestorRef)
+			}
+		}
+	})
+
+	t.Run("when the ancestor references differ only by port then keep a status for each", func(t *testing.T) {
+		port80, port443 := gatewayapiv1beta1.PortNumber(80), gatewayapiv1beta1.PortNumber(443)
+		ref80, ref443 := gatewayRef("gw-1"), gatewayRef("gw-1")
+		ref80.Port, ref443.Port = &port80, &port443
+		if ancestorKey(ref80) == ancestorKey(ref443) {
+			t.Errorf("expected different keys, but got %s for both", ancestorKey(ref80))
+		}
+
+		ancestors, dropped := ReconcileAncestors(nil, []gatewayapiv1beta1.ParentReference{ref443, ref80}, "gw-ns", controllerName, accepted)
+		if len(ancestors) != 2 || dropped != 0 {
+			t.Fatalf("expected 2 ancestors and none dropped, but got %v and %d", ancestors, dropped)
+		}
+		ports := common.Map(ancestors, func(a PolicyAncestorStatus) gatewayapiv1beta1.PortNumber { return *a.AncestorRef.Port })
+		if !common.Contains(ports, port80) || !common.Contains(ports, port443) {
+			t.Errorf("expected ancestors for ports 80 and 443, but got %v", ports)
+		}
+
+		ancestors, _ = ReconcileAncestors(ancestors, []gatewayapiv1beta1.ParentReference{ref80}, "gw-ns", controllerName, accepted)
+		if len(ancestors) != 1 || *ancestors[0].AncestorRef.Port != port80 {
+			t.Errorf("expected the ancestor for port 80 only, but got %v", ancestors)
+		}
+	})
+}
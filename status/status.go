@@ -0,0 +1,219 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+	"github.com/kuadrant/controller-runtime-ext/merge"
+	"github.com/kuadrant/controller-runtime-ext/reconcilers"
+)
+
+// Condition types
+const (
+	// ConditionAccepted tells whether the policy has been accepted by its targets (GEP-713)
+	ConditionAccepted = string(gatewayapiv1alpha2.PolicyConditionAccepted)
+	// ConditionEnforced tells whether the policy is enforced, i.e. not overridden by other policies
+	ConditionEnforced = "Enforced"
+)
+
+// Condition reasons
+const (
+	ReasonAccepted       = string(gatewayapiv1alpha2.PolicyReasonAccepted)
+	ReasonTargetNotFound = string(gatewayapiv1alpha2.PolicyReasonTargetNotFound)
+	ReasonConflicted     = string(gatewayapiv1alpha2.PolicyReasonConflicted)
+	ReasonInvalid        = string(gatewayapiv1alpha2.PolicyReasonInvalid)
+	ReasonEnforced       = "Enforced"
+	ReasonOverridden     = "Overridden"
+	ReasonUnknown        = "Unknown"
+)
+
+// InvalidError is an error of a syntactically or semantically invalid policy
+type InvalidError struct {
+	Err error
+}
+
+func (e *InvalidError) Error() string {
+	return fmt.Sprintf("invalid policy: %v", e.Err)
+}
+
+func (e *InvalidError) Unwrap() error {
+	return e.Err
+}
+
+// NewInvalidError wraps an error of validation of a policy, so AcceptedCondition reports the policy as invalid
+func NewInvalidError(err error) error {
+	return &InvalidError{Err: err}
+}
+
+// ConflictError is the error of a policy that lost a conflict with other policies of the same kind
+type ConflictError struct {
+	Conflict *reconcilers.PolicyConflict
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("policy conflicts with %s, which takes precedence", client.ObjectKeyFromObject(e.Conflict.Winner))
+}
+
+// ConflictErr returns a ConflictError if the policy lost the conflict, nil otherwise
+func ConflictErr(policy client.Object, conflict *reconcilers.PolicyConflict) error {
+	if conflict == nil || !conflict.Lost(policy) {
+		return nil
+	}
+	return &ConflictError{Conflict: conflict}
+}
+
+// AcceptedCondition returns the Accepted condition of a policy out of the error of its reconciliation, e.g. of FetchTargetRefObject:
+// * no error: True, Accepted
+// * target not found: False, TargetNotFound
+// * ConflictError: False, Conflicted
+// * InvalidError, or target found but not a valid target (reconcilers.ErrInvalidTargetRef): False, Invalid
+// * any other error: Unknown, Unknown
+func AcceptedCondition(policy client.Object, err error) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               ConditionAccepted,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonAccepted,
+		Message:            "policy has been accepted",
+		ObservedGeneration: policy.GetGeneration(),
+	}
+	if err == nil {
+		return condition
+	}
+
+	condition.Status = metav1.ConditionFalse
+	condition.Message = err.Error()
+
+	var conflictErr *ConflictError
+	var invalidErr *InvalidError
+	switch {
+	case apierrors.IsNotFound(err):
+		condition.Reason = ReasonTargetNotFound
+	case errors.As(err, &conflictErr):
+		condition.Reason = ReasonConflicted
+	case errors.As(err, &invalidErr), errors.Is(err, reconcilers.ErrInvalidTargetRef):
+		condition.Reason = ReasonInvalid
+	default:
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = ReasonUnknown
+	}
+	return condition
+}
+
+// EnforcedCondition returns the Enforced condition of a policy out of the effective policy it contributes to:
+// * error: Unknown, Unknown
+// * the policy contributes no rule to the effective policy: False, Overridden
+// * otherwise: True, Enforced
+func EnforcedCondition(policy client.Object, effective *merge.EffectivePolicy, err error) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               ConditionEnforced,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonEnforced,
+		Message:            "policy has been enforced",
+		ObservedGeneration: policy.GetGeneration(),
+	}
+	switch {
+	case err != nil:
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = ReasonUnknown
+		condition.Message = err.Error()
+	case effective != nil && !common.Contains(effective.Contributors(), client.ObjectKeyFromObject(policy)):
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = ReasonOverridden
+		condition.Message = fmt.Sprintf("policy is overridden by %v", effective.Contributors())
+	}
+	return condition
+}
+
+// PolicyWithConditions is a policy whose status holds conditions
+type PolicyWithConditions interface {
+	client.Object
+	GetConditions() []metav1.Condition
+	SetConditions([]metav1.Condition)
+}
+
+// PatchConditions sets the conditions in the status of a policy and patches the status subresource, if anything changed.
+// The observedGeneration of the conditions is set to the generation of the policy. The policy is not patched if any of its
+// conditions was observed at a newer generation than the one of the policy object, i.e. the policy object is stale.
+// The status is patched with optimistic locking: on conflict, the policy is fetched again and the conditions are set again on top of
+// the ones written meanwhile, unless the generation of the policy changed, in which case the conditions are left to the next reconcile.
+// Returns true if the status was patched.
+func PatchConditions(ctx context.Context, k8sClient client.Client, policy PolicyWithConditions, conditions ...metav1.Condition) (bool, error) {
+	logger, _ := logr.FromContext(ctx)
+
+	policyKey := client.ObjectKeyFromObject(policy)
+	generation := policy.GetGeneration()
+
+	patched := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if policy.GetGeneration() != generation {
+			logger.V(1).Info("PatchConditions: policy changed", "policy", policyKey, "generation", generation, "currentGeneration", policy.GetGeneration())
+			return nil
+		}
+
+		for _, condition := range policy.GetConditions() {
+			if condition.ObservedGeneration > policy.GetGeneration() {
+				logger.V(1).Info("PatchConditions: policy object is stale", "policy", policyKey, "generation", policy.GetGeneration(), "observedGeneration", condition.ObservedGeneration)
+				return nil
+			}
+		}
+
+		original := policy.DeepCopyObject().(client.Object)
+
+		current := make([]metav1.Condition, len(policy.GetConditions()))
+		copy(current, policy.GetConditions())
+
+		changed := false
+		for _, condition := range conditions {
+			condition.ObservedGeneration = policy.GetGeneration()
+			if existing := meta.FindStatusCondition(current, condition.Type); existing != nil &&
+				existing.Status == condition.Status &&
+				existing.Reason == condition.Reason &&
+				existing.Message == condition.Message &&
+				existing.ObservedGeneration == condition.ObservedGeneration {
+				continue
+			}
+			meta.SetStatusCondition(&current, condition)
+			changed = true
+		}
+
+		if !changed {
+			return nil
+		}
+
+		policy.SetConditions(current)
+		err := k8sClient.Status().Patch(ctx, policy, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+		logger.V(1).Info("PatchConditions: patch policy status", "policy", policyKey, "err", err)
+		if apierrors.IsConflict(err) {
+			if err := refreshPolicy(ctx, k8sClient, policy); err != nil {
+				return err
+			}
+		}
+		patched = err == nil
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return patched, nil
+}
+
+// refreshPolicy fetches the policy again into a new object of its kind, so no field of the stale object is left over, and copies it into the policy
+func refreshPolicy(ctx context.Context, k8sClient client.Reader, policy PolicyWithConditions) error {
+	fresh := reflect.New(reflect.TypeOf(policy).Elem()).Interface().(client.Object)
+	if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(policy), fresh); err != nil {
+		return err
+	}
+	reflect.ValueOf(policy).Elem().Set(reflect.ValueOf(fresh).Elem())
+	return nil
+}
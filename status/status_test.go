@@ -0,0 +1,172 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+	"github.com/kuadrant/controller-runtime-ext/merge"
+	"github.com/kuadrant/controller-runtime-ext/reconcilers"
+)
+
+func TestAcceptedCondition(t *testing.T) {
+	policy := &common.PolicyStub{ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "policy-1", Generation: 3}}
+	winner := &common.PolicyStub{ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "policy-0"}}
+
+	testCases := []struct {
+		name   string
+		err    error
+		status metav1.ConditionStatus
+		reason string
+	}{
+		{"when there is no error then accepted", nil, metav1.ConditionTrue, ReasonAccepted},
+		{"when the target is not found then target not found", apierrors.NewNotFound(schema.GroupResource{Resource: "httproutes"}, "route-1"), metav1.ConditionFalse, ReasonTargetNotFound},
+		{"when the target is not valid then invalid", fmt.Errorf("httproute (app-ns/route-1) not accepted: %w", reconcilers.ErrInvalidTargetRef), metav1.ConditionFalse, ReasonInvalid},
+		{"when the policy lost a conflict then conflicted", ConflictErr(policy, reconcilers.ResolvePolicyConflict(policy, winner)), metav1.ConditionFalse, ReasonConflicted},
+		{"when the policy is invalid then invalid", NewInvalidError(errors.New("missing limits")), metav1.ConditionFalse, ReasonInvalid},
+		{"when the error is unknown then unknown", errors.New("boom"), metav1.ConditionUnknown, ReasonUnknown},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			condition := AcceptedCondition(policy, tc.err)
+			if condition.Type != ConditionAccepted || condition.Status != tc.status || condition.Reason != tc.reason || condition.ObservedGeneration != 3 {
+				t.Errorf("unexpected condition %+v", condition)
+			}
+		})
+	}
+
+	if ConflictErr(winner, reconcilers.ResolvePolicyConflict(policy, winner)) != nil {
+		t.Error("expected no conflict error for the winner")
+	}
+}
+
+func TestEnforcedCondition(t *testing.T) {
+	policy := &common.PolicyStub{ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "policy-1"}}
+
+	effective := &merge.EffectivePolicy{
+		Rules:         merge.Rules{"limit": 10},
+		Contributions: map[string]client.ObjectKey{"limit": {Namespace: "gw-ns", Name: "policy-2"}},
+	}
+	if condition := EnforcedCondition(policy, effective, nil); condition.Status != metav1.ConditionFalse || condition.Reason != ReasonOverridden {
+		t.Errorf("expected overridden, but got %+v", condition)
+	}
+
+	effective.Contributions["window"] = client.ObjectKey{Namespace: "app-ns", Name: "policy-1"}
+	if condition := EnforcedCondition(policy, effective, nil); condition.Status != metav1.ConditionTrue || condition.Reason != ReasonEnforced {
+		t.Errorf("expected enforced, but got %+v", condition)
+	}
+
+	if condition := EnforcedCondition(policy, nil, errors.New("boom")); condition.Status != metav1.ConditionUnknown || condition.Reason != ReasonUnknown {
+		t.Errorf("expected unknown, but got %+v", condition)
+	}
+}
+
+func TestPatchConditions(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), log.Log)
+
+	s := runtime.NewScheme()
+	s.AddKnownTypes(schema.GroupVersion{Group: "kuadrant.io", Version: "v1"}, &common.PolicyStub{})
+
+	policy := &common.PolicyStub{ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "policy-1", Generation: 2}}
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(policy).WithStatusSubresource(policy).WithInterceptorFuncs(optimisticLockStatusPatch()).Build()
+
+	fetch := func() *common.PolicyStub {
+		p := &common.PolicyStub{}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(policy), p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	p := fetch()
+	patched, err := PatchConditions(ctx, cl, p, AcceptedCondition(p, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !patched {
+		t.Error("expected the status to be patched")
+	}
+	condition := meta.FindStatusCondition(fetch().Status.Conditions, ConditionAccepted)
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.ObservedGeneration != 2 {
+		t.Errorf("unexpected condition %+v", condition)
+	}
+
+	t.Run("when nothing changed then do not patch", func(t *testing.T) {
+		p := fetch()
+		patched, err := PatchConditions(ctx, cl, p, AcceptedCondition(p, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if patched {
+			t.Error("expected the status not to be patched")
+		}
+	})
+
+	t.Run("when the policy object is stale then do not patch", func(t *testing.T) {
+		stale := fetch()
+		stale.Generation = 1
+		patched, err := PatchConditions(ctx, cl, stale, AcceptedCondition(stale, errors.New("boom")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if patched {
+			t.Error("expected the status not to be patched")
+		}
+	})
+
+	t.Run("when the conditions were written concurrently then keep them", func(t *testing.T) {
+		p := fetch()
+
+		concurrent := fetch()
+		concurrent.Status.Conditions = append(concurrent.Status.Conditions, metav1.Condition{Type: ConditionEnforced, Status: metav1.ConditionTrue, Reason: ReasonEnforced, ObservedGeneration: 2})
+		if err := cl.Status().Update(ctx, concurrent); err != nil {
+			t.Fatal(err)
+		}
+
+		patched, err := PatchConditions(ctx, cl, p, AcceptedCondition(p, errors.New("boom")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !patched {
+			t.Error("expected the status to be patched")
+		}
+		conditions := fetch().Status.Conditions
+		if condition := meta.FindStatusCondition(conditions, ConditionEnforced); condition == nil {
+			t.Errorf("expected the concurrently written condition to be kept, but got %+v", conditions)
+		}
+		if condition := meta.FindStatusCondition(conditions, ConditionAccepted); condition == nil || condition.Message != "boom" {
+			t.Errorf("unexpected condition %+v", condition)
+		}
+	})
+}
+
+// optimisticLockStatusPatch returns interceptor functions that fail the status patches of objects whose resourceVersion is outdated,
+// as the API server does for patches with optimistic locking, which the fake client does not enforce
+func optimisticLockStatusPatch() interceptor.Funcs {
+	return interceptor.Funcs{
+		SubResourcePatch: func(ctx context.Context, cl client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+			current := obj.DeepCopyObject().(client.Object)
+			if err := cl.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+				return err
+			}
+			if current.GetResourceVersion() != obj.GetResourceVersion() {
+				return apierrors.NewConflict(schema.GroupResource{}, obj.GetName(), errors.New("object was modified"))
+			}
+			return cl.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+		},
+	}
+}
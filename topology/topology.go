@@ -0,0 +1,351 @@
+package topology
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+// NodeKind is the kind of a node of the topology
+type NodeKind string
+
+const (
+	GatewayClassKind  NodeKind = "GatewayClass"
+	GatewayKind       NodeKind = "Gateway"
+	ListenerKind      NodeKind = "Listener"
+	HTTPRouteKind     NodeKind = "HTTPRoute"
+	HTTPRouteRuleKind NodeKind = "HTTPRouteRule"
+	BackendKind       NodeKind = "Backend"
+)
+
+// NodeID identifies a node of the topology.
+// Section is the name of the listener of a gateway or the index of the rule of a route, empty for the other kinds of nodes.
+type NodeID struct {
+	Kind      NodeKind
+	Namespace string
+	Name      string
+	Section   string
+}
+
+func (id NodeID) String() string {
+	str := fmt.Sprintf("%s:%s", id.Kind, id.Name)
+	if id.Namespace != "" {
+		str = fmt.Sprintf("%s:%s", id.Kind, client.ObjectKey{Namespace: id.Namespace, Name: id.Name})
+	}
+	if id.Section != "" {
+		str = fmt.Sprintf("%s#%s", str, id.Section)
+	}
+	return str
+}
+
+func GatewayClassID(name string) NodeID {
+	return NodeID{Kind: GatewayClassKind, Name: name}
+}
+
+func GatewayID(gwKey client.ObjectKey) NodeID {
+	return NodeID{Kind: GatewayKind, Namespace: gwKey.Namespace, Name: gwKey.Name}
+}
+
+func ListenerID(gwKey client.ObjectKey, listenerName string) NodeID {
+	return NodeID{Kind: ListenerKind, Namespace: gwKey.Namespace, Name: gwKey.Name, Section: listenerName}
+}
+
+func HTTPRouteID(routeKey client.ObjectKey) NodeID {
+	return NodeID{Kind: HTTPRouteKind, Namespace: routeKey.Namespace, Name: routeKey.Name}
+}
+
+func HTTPRouteRuleID(routeKey client.ObjectKey, index int) NodeID {
+	return NodeID{Kind: HTTPRouteRuleKind, Namespace: routeKey.Namespace, Name: routeKey.Name, Section: fmt.Sprintf("%d", index)}
+}
+
+// BackendID identifies a backend service
+func BackendID(svcKey client.ObjectKey) NodeID {
+	return NodeID{Kind: BackendKind, Namespace: svcKey.Namespace, Name: svcKey.Name}
+}
+
+// Node is a node of the topology
+type Node struct {
+	ID NodeID
+	// Object is the Gateway API object of the node; for listeners and rules, the gateway and the route they belong to; nil for backends
+	Object client.Object
+
+	parents  []*Node
+	children []*Node
+	policies []common.Policy
+}
+
+// Parents returns the nodes directly above the node
+func (n *Node) Parents() []*Node {
+	return n.parents
+}
+
+// Children returns the nodes directly below the node
+func (n *Node) Children() []*Node {
+	return n.children
+}
+
+// Policies returns the policies attached to the node
+func (n *Node) Policies() []common.Policy {
+	return n.policies
+}
+
+// Topology is an in-memory directed acyclic graph of the Gateway API resources and the policies attached to them:
+// GatewayClass -> Gateway -> Listener -> HTTPRoute -> HTTPRouteRule -> Backend
+type Topology struct {
+	nodes map[NodeID]*Node
+	// order keeps the insertion order of the nodes, for deterministic queries
+	order []NodeID
+}
+
+// NewFromClient builds the topology from the GatewayClasses, Gateways and HTTPRoutes listed with the client (or cache),
+// attaching the given policies. The list options apply to the gateways and routes.
+func NewFromClient(ctx context.Context, k8sClient client.Reader, policies []common.Policy, opts ...client.ListOption) (*Topology, error) {
+	gwClassList := &gatewayapiv1beta1.GatewayClassList{}
+	if err := k8sClient.List(ctx, gwClassList); err != nil {
+		return nil, err
+	}
+
+	gwList := &gatewayapiv1beta1.GatewayList{}
+	if err := k8sClient.List(ctx, gwList, opts...); err != nil {
+		return nil, err
+	}
+
+	routeList := &gatewayapiv1beta1.HTTPRouteList{}
+	if err := k8sClient.List(ctx, routeList, opts...); err != nil {
+		return nil, err
+	}
+
+	return New(gwClassList.Items, gwList.Items, routeList.Items, policies), nil
+}
+
+// New builds the topology from the given objects.
+// Routes attach to all the listeners of their parent gateways, or only to the listener named in the sectionName of the parentRef.
+// Policies attach to the gatewayclass, gateway, httproute or backend service of their target references.
+func New(gatewayClasses []gatewayapiv1beta1.GatewayClass, gateways []gatewayapiv1beta1.Gateway, routes []gatewayapiv1beta1.HTTPRoute, policies []common.Policy) *Topology {
+	t := &Topology{nodes: make(map[NodeID]*Node)}
+
+	for i := range gatewayClasses {
+		t.addNode(GatewayClassID(gatewayClasses[i].Name), &gatewayClasses[i])
+	}
+
+	for i := range gateways {
+		gateway := &gateways[i]
+		gwKey := client.ObjectKeyFromObject(gateway)
+		gwNode := t.addNode(GatewayID(gwKey), gateway)
+		if gwClassNode, ok := t.nodes[GatewayClassID(string(gateway.Spec.GatewayClassName))]; ok {
+			link(gwClassNode, gwNode)
+		}
+		for _, listener := range gateway.Spec.Listeners {
+			link(gwNode, t.addNode(ListenerID(gwKey, string(listener.Name)), gateway))
+		}
+	}
+
+	for i := range routes {
+		route := &routes[i]
+		routeKey := client.ObjectKeyFromObject(route)
+		routeNode := t.addNode(HTTPRouteID(routeKey), route)
+
+		for _, parentRef := range route.Spec.ParentRefs {
+			if parentRef.Kind != nil && *parentRef.Kind != "Gateway" {
+				continue
+			}
+			gwKey := client.ObjectKey{Namespace: route.Namespace, Name: string(parentRef.Name)}
+			if parentRef.Namespace != nil {
+				gwKey.Namespace = string(*parentRef.Namespace)
+			}
+			gwNode, ok := t.nodes[GatewayID(gwKey)]
+			if !ok {
+				continue
+			}
+			for _, listenerNode := range gwNode.children {
+				if parentRef.SectionName == nil || string(*parentRef.SectionName) == listenerNode.ID.Section {
+					link(listenerNode, routeNode)
+				}
+			}
+		}
+
+		for j, rule := range route.Spec.Rules {
+			ruleNode := t.addNode(HTTPRouteRuleID(routeKey, j), route)
+			link(routeNode, ruleNode)
+			for _, backendRef := range rule.BackendRefs {
+				if backendRef.Kind != nil && *backendRef.Kind != "Service" {
+					continue
+				}
+				svcKey := client.ObjectKey{Namespace: route.Namespace, Name: string(backendRef.Name)}
+				if backendRef.Namespace != nil {
+					svcKey.Namespace = string(*backendRef.Namespace)
+				}
+				backendNode, ok := t.nodes[BackendID(svcKey)]
+				if !ok {
+					backendNode = t.addNode(BackendID(svcKey), nil)
+				}
+				link(ruleNode, backendNode)
+			}
+		}
+	}
+
+	for _, policy := range policies {
+		for _, targetRef := range policy.GetTargetRefs() {
+			ns := policy.GetNamespace()
+			if targetRef.Namespace != nil {
+				ns = string(*targetRef.Namespace)
+			}
+			var id NodeID
+			switch targetRef.Kind {
+			case "GatewayClass":
+				id = GatewayClassID(string(targetRef.Name))
+			case "Gateway":
+				id = GatewayID(client.ObjectKey{Namespace: ns, Name: string(targetRef.Name)})
+			case "HTTPRoute":
+				id = HTTPRouteID(client.ObjectKey{Namespace: ns, Name: string(targetRef.Name)})
+			case "Service":
+				id = BackendID(client.ObjectKey{Namespace: ns, Name: string(targetRef.Name)})
+			default:
+				continue
+			}
+			if node, ok := t.nodes[id]; ok {
+				node.policies = append(node.policies, policy)
+			}
+		}
+	}
+
+	return t
+}
+
+func (t *Topology) addNode(id NodeID, obj client.Object) *Node {
+	if node, ok := t.nodes[id]; ok {
+		return node
+	}
+	node := &Node{ID: id, Object: obj}
+	t.nodes[id] = node
+	t.order = append(t.order, id)
+	return node
+}
+
+func link(parent, child *Node) {
+	for _, c := range parent.children {
+		if c == child {
+			return
+		}
+	}
+	parent.children = append(parent.children, child)
+	child.parents = append(child.parents, parent)
+}
+
+// Node returns the node of the topology with the given id, nil if not found
+func (t *Topology) Node(id NodeID) *Node {
+	return t.nodes[id]
+}
+
+// Nodes returns all the nodes of a kind, in insertion order
+func (t *Topology) Nodes(kind NodeKind) []*Node {
+	nodes := make([]*Node, 0)
+	for _, id := range t.order {
+		if id.Kind == kind {
+			nodes = append(nodes, t.nodes[id])
+		}
+	}
+	return nodes
+}
+
+// Ancestors returns all the nodes above a node, closest first
+func (t *Topology) Ancestors(id NodeID) []*Node {
+	return t.walk(id, func(n *Node) []*Node { return n.parents })
+}
+
+// Descendants returns all the nodes below a node, closest first
+func (t *Topology) Descendants(id NodeID) []*Node {
+	return t.walk(id, func(n *Node) []*Node { return n.children })
+}
+
+// PoliciesAtOrAbove returns the policies attached to a node or to any of its ancestors, closest first
+func (t *Topology) PoliciesAtOrAbove(id NodeID) []common.Policy {
+	node, ok := t.nodes[id]
+	if !ok {
+		return nil
+	}
+	policies := make([]common.Policy, 0)
+	for _, n := range append([]*Node{node}, t.Ancestors(id)...) {
+		for _, policy := range n.policies {
+			if !containsPolicy(policies, policy) {
+				policies = append(policies, policy)
+			}
+		}
+	}
+	return policies
+}
+
+// PoliciesOnPath returns the policies attached to the given nodes, in the order of the nodes,
+// e.g. the gateway, the listener, the route and the rule of a path of the hierarchy, from the most general to the most specific
+func (t *Topology) PoliciesOnPath(path ...NodeID) []common.Policy {
+	policies := make([]common.Policy, 0)
+	for _, id := range path {
+		node, ok := t.nodes[id]
+		if !ok {
+			continue
+		}
+		for _, policy := range node.policies {
+			if !containsPolicy(policies, policy) {
+				policies = append(policies, policy)
+			}
+		}
+	}
+	return policies
+}
+
+// RoutesFromGateway returns the httproutes reachable from a gateway
+func (t *Topology) RoutesFromGateway(gwKey client.ObjectKey) []*gatewayapiv1beta1.HTTPRoute {
+	routes := make([]*gatewayapiv1beta1.HTTPRoute, 0)
+	for _, n := range t.Descendants(GatewayID(gwKey)) {
+		if n.ID.Kind == HTTPRouteKind {
+			routes = append(routes, n.Object.(*gatewayapiv1beta1.HTTPRoute))
+		}
+	}
+	return routes
+}
+
+// GatewaysOfRoute returns the gateways an httproute is attached to
+func (t *Topology) GatewaysOfRoute(routeKey client.ObjectKey) []*gatewayapiv1beta1.Gateway {
+	gateways := make([]*gatewayapiv1beta1.Gateway, 0)
+	for _, n := range t.Ancestors(HTTPRouteID(routeKey)) {
+		if n.ID.Kind == GatewayKind {
+			gateways = append(gateways, n.Object.(*gatewayapiv1beta1.Gateway))
+		}
+	}
+	return gateways
+}
+
+// walk traverses the graph breadth-first from a node, excluding the node
+func (t *Topology) walk(id NodeID, next func(*Node) []*Node) []*Node {
+	node, ok := t.nodes[id]
+	if !ok {
+		return nil
+	}
+	visited := map[NodeID]struct{}{id: {}}
+	result := make([]*Node, 0)
+	queue := next(node)
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if _, seen := visited[n.ID]; seen {
+			continue
+		}
+		visited[n.ID] = struct{}{}
+		result = append(result, n)
+		queue = append(queue, next(n)...)
+	}
+	return result
+}
+
+func containsPolicy(policies []common.Policy, policy common.Policy) bool {
+	for _, p := range policies {
+		if p.GetNamespace() == policy.GetNamespace() && p.GetName() == policy.GetName() && p.Kind() == policy.Kind() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package topology
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/kuadrant/controller-runtime-ext/common"
+)
+
+func nodeIDs(nodes []*Node) []string {
+	return common.Map(nodes, func(n *Node) string { return n.ID.String() })
+}
+
+func policyNames(policies []common.Policy) []string {
+	return common.Map(policies, func(p common.Policy) string { return p.GetName() })
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTopology(t *testing.T) {
+	err := gatewayapiv1beta1.AddToScheme(scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gwNamespace := gatewayapiv1beta1.Namespace("gw-ns")
+	httpsSection := gatewayapiv1beta1.SectionName("https")
+
+	newPolicy := func(name, kind, targetName string) *common.PolicyStub {
+		return &common.PolicyStub{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: name},
+			Spec: common.PolicyStubSpec{TargetRef: gatewayapiv1alpha2.PolicyTargetReference{
+				Group: gatewayapiv1beta1.GroupName,
+				Kind:  gatewayapiv1alpha2.Kind(kind),
+				Name:  gatewayapiv1alpha2.ObjectName(targetName),
+			}},
+		}
+	}
+	routePolicy := newPolicy("policy-2", "HTTPRoute", "route-1")
+	routePolicy.Namespace = "app-ns"
+
+	cl := fake.NewFakeClient(
+		&gatewayapiv1beta1.GatewayClass{ObjectMeta: metav1.ObjectMeta{Name: "istio"}},
+		&gatewayapiv1beta1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "gw-ns", Name: "gw-1"},
+			Spec: gatewayapiv1beta1.GatewaySpec{
+				GatewayClassName: "istio",
+				Listeners:        []gatewayapiv1beta1.Listener{{Name: "http"}, {Name: "https"}},
+			},
+		},
+		&gatewayapiv1beta1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "route-1"},
+			Spec: gatewayapiv1beta1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayapiv1beta1.CommonRouteSpec{
+					ParentRefs: []gatewayapiv1beta1.ParentReference{{Name: "gw-1", Namespace: &gwNamespace, SectionName: &httpsSection}},
+				},
+				Rules: []gatewayapiv1beta1.HTTPRouteRule{{
+					BackendRefs: []gatewayapiv1beta1.HTTPBackendRef{{BackendRef: gatewayapiv1beta1.BackendRef{BackendObjectReference: gatewayapiv1beta1.BackendObjectReference{Name: "svc-1"}}}},
+				}},
+			},
+		},
+		&gatewayapiv1beta1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "app-ns", Name: "route-2"},
+			Spec: gatewayapiv1beta1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayapiv1beta1.CommonRouteSpec{
+					ParentRefs: []gatewayapiv1beta1.ParentReference{{Name: "gw-2", Namespace: &gwNamespace}},
+				},
+			},
+		},
+	)
+
+	topology, err := NewFromClient(context.Background(), cl, []common.Policy{
+		newPolicy("policy-1", "Gateway", "gw-1"),
+		routePolicy,
+		newPolicy("policy-3", "GatewayClass", "istio"),
+		newPolicy("policy-4", "Gateway", "gw-2"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	route1Key := client.ObjectKey{Namespace: "app-ns", Name: "route-1"}
+	gw1Key := client.ObjectKey{Namespace: "gw-ns", Name: "gw-1"}
+
+	t.Run("ancestors of a route", func(t *testing.T) {
+		ancestors := nodeIDs(topology.Ancestors(HTTPRouteID(route1Key)))
+		expected := []string{"Listener:gw-ns/gw-1#https", "Gateway:gw-ns/gw-1", "GatewayClass:istio"}
+		if !equalStrings(ancestors, expected) {
+			t.Errorf("expected ancestors %v, but got %v", expected, ancestors)
+		}
+	})
+
+	t.Run("descendants of a gateway", func(t *testing.T) {
+		descendants := nodeIDs(topology.Descendants(GatewayID(gw1Key)))
+		expected := []string{"Listener:gw-ns/gw-1#http", "Listener:gw-ns/gw-1#https", "HTTPRoute:app-ns/route-1", "HTTPRouteRule:app-ns/route-1#0", "Backend:app-ns/svc-1"}
+		if !equalStrings(descendants, expected) {
+			t.Errorf("expected descendants %v, but got %v", expected, descendants)
+		}
+	})
+
+	t.Run("policies attached at or above a listener", func(t *testing.T) {
+		policies := policyNames(topology.PoliciesAtOrAbove(ListenerID(gw1Key, "https")))
+		expected := []string{"policy-1", "policy-3"}
+		if !equalStrings(policies, expected) {
+			t.Errorf("expected policies %v, but got %v", expected, policies)
+		}
+	})
+
+	t.Run("policies attached at or above a route rule", func(t *testing.T) {
+		policies := policyNames(topology.PoliciesAtOrAbove(HTTPRouteRuleID(route1Key, 0)))
+		expected := []string{"policy-2", "policy-1", "policy-3"}
+		if !equalStrings(policies, expected) {
+			t.Errorf("expected policies %v, but got %v", expected, policies)
+		}
+	})
+
+	t.Run("policies on a path", func(t *testing.T) {
+		policies := policyNames(topology.PoliciesOnPath(GatewayID(gw1Key), ListenerID(gw1Key, "https"), HTTPRouteID(route1Key), HTTPRouteRuleID(route1Key, 0)))
+		expected := []string{"policy-1", "policy-2"}
+		if !equalStrings(policies, expected) {
+			t.Errorf("expected policies %v, but got %v", expected, policies)
+		}
+	})
+
+	t.Run("routes reachable from a gateway", func(t *testing.T) {
+		routes := topology.RoutesFromGateway(gw1Key)
+		if len(routes) != 1 || client.ObjectKeyFromObject(routes[0]) != route1Key {
+			t.Errorf("expected routes [%s], but got %v", route1Key, routes)
+		}
+	})
+
+	t.Run("gateways of a route", func(t *testing.T) {
+		gateways := topology.GatewaysOfRoute(route1Key)
+		if len(gateways) != 1 || client.ObjectKeyFromObject(gateways[0]) != gw1Key {
+			t.Errorf("expected gateways [%s], but got %v", gw1Key, gateways)
+		}
+		if gateways := topology.GatewaysOfRoute(client.ObjectKey{Namespace: "app-ns", Name: "route-2"}); len(gateways) != 0 {
+			t.Errorf("expected no gateways for a route whose parent does not exist, but got %v", gateways)
+		}
+	})
+
+	t.Run("unknown node", func(t *testing.T) {
+		if topology.Node(GatewayID(client.ObjectKey{Namespace: "gw-ns", Name: "gw-2"})) != nil {
+			t.Error("expected no node")
+		}
+		if policies := topology.PoliciesAtOrAbove(GatewayID(client.ObjectKey{Namespace: "gw-ns", Name: "gw-2"})); len(policies) != 0 {
+			t.Errorf("expected no policies, but got %v", policies)
+		}
+	})
+}